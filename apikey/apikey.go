@@ -0,0 +1,157 @@
+package apikey
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+var (
+	ErrUnknown  = errors.New("unknown api key")
+	ErrDisabled = errors.New("api key is disabled")
+	ErrExpired  = errors.New("api key has expired")
+)
+
+// Key es una entrada del archivo de claves. Nunca se guarda la clave en
+// claro: Hash es "sha256:<hex>" de la clave (ver Hash).
+type Key struct {
+	Name      string    `json:"name" yaml:"name"`
+	Hash      string    `json:"hash" yaml:"hash"`
+	Scopes    []string  `json:"scopes" yaml:"scopes"`
+	Roles     []string  `json:"roles" yaml:"roles"`
+	ExpiresAt time.Time `json:"expiresAt" yaml:"expiresAt"`
+	Enabled   bool      `json:"enabled" yaml:"enabled"`
+}
+
+// Usage es el uso acumulado de una clave desde que arrancó el gateway
+type Usage struct {
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	Scopes    []string  `json:"scopes"`
+	Uses      int64     `json:"uses"`
+	Rejected  int64     `json:"rejected"`
+	LastUsed  time.Time `json:"lastUsed,omitempty"`
+}
+
+type entry struct {
+	key      Key
+	uses     atomic.Int64
+	rejected atomic.Int64
+	lastUsed atomic.Int64 // unix nanos
+}
+
+// Store resuelve claves por hash y cuenta su uso
+type Store struct {
+	mu     sync.RWMutex
+	byHash map[string]*entry
+	now    func() time.Time
+}
+
+// Hash devuelve el valor a guardar en el archivo para la clave raw
+func Hash(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Load lee el archivo de claves (YAML o JSON, con la lista bajo "keys")
+func Load(path string) (*Store, error) {
+	var doc struct {
+		Keys []Key `json:"keys" yaml:"keys"`
+	}
+	if err := config.DecodeFile(path, &doc); err != nil {
+		return nil, err
+	}
+	return New(doc.Keys)
+}
+
+// New arma un Store validando nombres y hashes
+func New(keys []Key) (*Store, error) {
+	s := &Store{byHash: map[string]*entry{}, now: time.Now}
+	names := map[string]bool{}
+	var errs []error
+
+	for i, k := range keys {
+		where := fmt.Sprintf("keys[%d] (%s)", i, k.Name)
+		if k.Name == "" {
+			errs = append(errs, fmt.Errorf("%s: name is required", where))
+		}
+		if names[k.Name] {
+			errs = append(errs, fmt.Errorf("%s: duplicate name", where))
+		}
+		names[k.Name] = true
+
+		hash := strings.ToLower(k.Hash)
+		if !strings.HasPrefix(hash, "sha256:") || len(hash) != len("sha256:")+64 {
+			errs = append(errs, fmt.Errorf("%s: hash must be sha256:<64 hex chars>", where))
+			continue
+		}
+		if _, dup := s.byHash[hash]; dup {
+			errs = append(errs, fmt.Errorf("%s: duplicate hash", where))
+			continue
+		}
+		k.Hash = hash
+		s.byHash[hash] = &entry{key: k}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Lookup valida la clave raw y registra su uso
+func (s *Store) Lookup(raw string) (Key, error) {
+	s.mu.RLock()
+	e, ok := s.byHash[Hash(raw)]
+	s.mu.RUnlock()
+	if !ok {
+		return Key{}, ErrUnknown
+	}
+
+	now := s.now()
+	switch {
+	case !e.key.Enabled:
+		e.rejected.Add(1)
+		return Key{}, ErrDisabled
+	case !e.key.ExpiresAt.IsZero() && !now.Before(e.key.ExpiresAt):
+		e.rejected.Add(1)
+		return Key{}, ErrExpired
+	}
+
+	e.uses.Add(1)
+	e.lastUsed.Store(now.UnixNano())
+	return e.key, nil
+}
+
+// Usage devuelve el uso de cada clave, ordenado por nombre
+func (s *Store) Usage() []Usage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Usage, 0, len(s.byHash))
+	for _, e := range s.byHash {
+		u := Usage{
+			Name:      e.key.Name,
+			Enabled:   e.key.Enabled,
+			ExpiresAt: e.key.ExpiresAt,
+			Scopes:    e.key.Scopes,
+			Uses:      e.uses.Load(),
+			Rejected:  e.rejected.Load(),
+		}
+		if ns := e.lastUsed.Load(); ns != 0 {
+			u.LastUsed = time.Unix(0, ns)
+		}
+		out = append(out, u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,86 @@
+package apikey
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T) *Store {
+	s, err := New([]Key{
+		{Name: "batch", Hash: Hash("batch-secret"), Scopes: []string{"users:read"}, Enabled: true},
+		{Name: "old", Hash: Hash("old-secret"), ExpiresAt: time.Now().Add(-time.Hour), Enabled: true},
+		{Name: "off", Hash: Hash("off-secret"), Enabled: false},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestLookup(t *testing.T) {
+	s := testStore(t)
+
+	k, err := s.Lookup("batch-secret")
+	if err != nil || k.Name != "batch" {
+		t.Fatalf("Expected key 'batch', got %v (%v)", k.Name, err)
+	}
+
+	cases := map[string]error{
+		"nope":       ErrUnknown,
+		"old-secret": ErrExpired,
+		"off-secret": ErrDisabled,
+	}
+	for raw, want := range cases {
+		if _, err := s.Lookup(raw); !errors.Is(err, want) {
+			t.Errorf("Expected %v for %q, got %v", want, raw, err)
+		}
+	}
+}
+
+func TestUsageCounts(t *testing.T) {
+	s := testStore(t)
+	s.Lookup("batch-secret")
+	s.Lookup("batch-secret")
+	s.Lookup("off-secret")
+
+	usage := map[string]Usage{}
+	for _, u := range s.Usage() {
+		usage[u.Name] = u
+	}
+	if u := usage["batch"]; u.Uses != 2 || u.LastUsed.IsZero() {
+		t.Errorf("Expected 2 uses with lastUsed for 'batch', got %+v", u)
+	}
+	if u := usage["off"]; u.Uses != 0 || u.Rejected != 1 {
+		t.Errorf("Expected 1 rejection for 'off', got %+v", u)
+	}
+}
+
+func TestNewRejectsInvalidKeys(t *testing.T) {
+	_, err := New([]Key{
+		{Name: "a", Hash: "plain-text"},
+		{Name: "b", Hash: Hash("x")},
+		{Name: "b", Hash: Hash("x")},
+	})
+	if err == nil {
+		t.Fatal("Expected error for invalid hash and duplicates")
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	data := "keys:\n  - name: partner\n    hash: " + Hash("p") + "\n    scopes: [profiles:read]\n    enabled: true\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if k, err := s.Lookup("p"); err != nil || len(k.Scopes) != 1 {
+		t.Errorf("Expected partner key with one scope, got %+v (%v)", k, err)
+	}
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+// Principal es la identidad verificada de quien hace la petición
+type Principal struct {
+	// Method: cómo se autenticó (jwt, introspection, apikey, mtls)
+	Method string
+	// APIKey: nombre de la API key usada, si hubo una
+	APIKey string
+	// Certificate: identidad del certificado de cliente verificado, si hubo uno
+	Certificate string
+
+	Subject   string
+	Email     string
+	Roles     []string
+	Scopes    []string
+	ExpiresAt time.Time
+	// Claims son los claims originales (JWT o respuesta de introspección)
+	Claims map[string]interface{}
+}
+
+// contextKey no exportado: ningún otro paquete puede pisar ni falsificar
+// el Principal guardado en el contexto
+type contextKey struct{}
+
+// WithPrincipal devuelve un contexto que lleva p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext devuelve el Principal del contexto, si lo hay
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// FromRequest es FromContext(r.Context())
+func FromRequest(r *http.Request) (*Principal, bool) {
+	return FromContext(r.Context())
+}
+
+// NewPrincipal arma un Principal a partir de claims verificados, usando
+// los nombres de claim configurados para subject, roles y scopes.
+func NewPrincipal(claims map[string]interface{}, cfg config.AuthzConfig) *Principal {
+	p := &Principal{
+		Subject: ClaimString(claims[cfg.SubjectClaim]),
+		Email:   ClaimString(claims["email"]),
+		Roles:   ClaimList(claims[cfg.RolesClaim]),
+		Scopes:  ClaimList(claims[cfg.ScopeClaim]),
+		Claims:  claims,
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		p.ExpiresAt = time.Unix(int64(exp), 0)
+	}
+	return p
+}
+
+// FromCertificate arma un Principal a partir de un certificado de cliente ya
+// verificado. El subject es el CN o, si no tiene, el primer SAN (URI, DNS,
+// email); las OU del certificado se usan como roles.
+func FromCertificate(cert *x509.Certificate) *Principal {
+	var uris []string
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+	}
+
+	subject := cert.Subject.CommonName
+	for _, sans := range [][]string{uris, cert.DNSNames, cert.EmailAddresses} {
+		if subject == "" && len(sans) > 0 {
+			subject = sans[0]
+		}
+	}
+
+	p := &Principal{
+		Method:      "mtls",
+		Certificate: subject,
+		Subject:     subject,
+		Roles:       cert.Subject.OrganizationalUnit,
+		ExpiresAt:   cert.NotAfter,
+		Claims: map[string]interface{}{
+			"sub":           subject,
+			"roles":         cert.Subject.OrganizationalUnit,
+			"cert_subject":  cert.Subject.String(),
+			"cert_issuer":   cert.Issuer.String(),
+			"cert_serial":   cert.SerialNumber.String(),
+			"cert_dns_sans": cert.DNSNames,
+			"cert_uri_sans": uris,
+		},
+	}
+	if len(cert.EmailAddresses) > 0 {
+		p.Email = cert.EmailAddresses[0]
+		p.Claims["email"] = p.Email
+	}
+	return p
+}
+
+// HasRole indica si el Principal tiene alguno de roles
+func (p *Principal) HasRole(roles ...string) bool {
+	return containsAny(p.Roles, roles)
+}
+
+// HasScope indica si el Principal tiene el scope s
+func (p *Principal) HasScope(s string) bool {
+	return containsAny(p.Scopes, []string{s})
+}
+
+// ClaimString convierte un claim escalar a string (los números JSON llegan como float64)
+func ClaimString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return fmt.Sprintf("%.0f", t)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// ClaimList acepta tanto arrays JSON como strings separados por espacios o comas
+// ("scope": "users:read users:write" es la forma OAuth2 habitual)
+func ClaimList(v interface{}) []string {
+	switch t := v.(type) {
+	case []interface{}:
+		out := make([]string, 0, len(t))
+		for _, item := range t {
+			out = append(out, ClaimString(item))
+		}
+		return out
+	case []string:
+		return t
+	case string:
+		return strings.FieldsFunc(t, func(r rune) bool { return r == ' ' || r == ',' })
+	}
+	return nil
+}
+
+func containsAny(have, want []string) bool {
+	for _, w := range want {
+		for _, h := range have {
+			if h == w {
+				return true
+			}
+		}
+	}
+	return false
+}
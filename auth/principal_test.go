@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+func TestWithPrincipal_RoundTrip(t *testing.T) {
+	p := &Principal{Subject: "42"}
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(WithPrincipal(req.Context(), p))
+
+	got, ok := FromRequest(req)
+	if !ok || got != p {
+		t.Errorf("Expected principal to round-trip through the context, got %v", got)
+	}
+}
+
+func TestFromContext_IgnoresForeignKeys(t *testing.T) {
+	// El antiguo key "tokenData" como string ya no afecta ni hace panic
+	ctx := context.WithValue(context.Background(), "tokenData", "not claims")
+
+	if _, ok := FromContext(ctx); ok {
+		t.Error("Expected no principal in a context without one")
+	}
+}
+
+func TestNewPrincipal(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Unix()
+	cfg := config.AuthzConfig{SubjectClaim: "sub", RolesClaim: "roles", ScopeClaim: "scope"}
+	p := NewPrincipal(map[string]interface{}{
+		"sub":   "42",
+		"email": "a@example.com",
+		"roles": []interface{}{"user", "admin"},
+		"scope": "users:read users:write",
+		"exp":   float64(exp),
+	}, cfg)
+
+	if p.Subject != "42" || p.Email != "a@example.com" || p.ExpiresAt.Unix() != exp {
+		t.Errorf("Unexpected principal: %+v", p)
+	}
+	if !p.HasRole("admin") || p.HasRole("ops") {
+		t.Errorf("Unexpected roles: %v", p.Roles)
+	}
+	if !p.HasScope("users:write") || p.HasScope("users:delete") {
+		t.Errorf("Unexpected scopes: %v", p.Scopes)
+	}
+}
+
+func TestFromCertificate(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/batch")
+	cert := &x509.Certificate{
+		Subject:        pkix.Name{OrganizationalUnit: []string{"admin"}},
+		Issuer:         pkix.Name{CommonName: "test-ca"},
+		SerialNumber:   big.NewInt(7),
+		URIs:           []*url.URL{spiffe},
+		DNSNames:       []string{"batch.internal"},
+		EmailAddresses: []string{"batch@example.org"},
+		NotAfter:       time.Now().Add(time.Hour),
+	}
+
+	p := FromCertificate(cert)
+	if p.Method != "mtls" || p.Subject != "spiffe://example.org/batch" {
+		t.Errorf("Expected mtls principal from the URI SAN, got %s %s", p.Method, p.Subject)
+	}
+	if !p.HasRole("admin") || p.Email != "batch@example.org" {
+		t.Errorf("Expected role from OU and email SAN, got %+v", p)
+	}
+
+	cert.Subject.CommonName = "batch-job"
+	if p := FromCertificate(cert); p.Subject != "batch-job" {
+		t.Errorf("Expected CN to take precedence, got '%s'", p.Subject)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"servicio-gateway/apikey"
+	"servicio-gateway/auth"
+	"servicio-gateway/handlers"
+)
+
+// API keys para clientes máquina; nil si no hay apiKeys.file
+var apiKeys *apikey.Store
+
+// authFailure es una respuesta de error de autenticación pendiente de escribir
+type authFailure struct {
+	status  int
+	code    string
+	message string
+}
+
+func (f *authFailure) write(w http.ResponseWriter) {
+	if f.status == http.StatusUnauthorized && strings.HasPrefix(f.code, "token_") {
+		writeUnauthorized(w, f.code, f.message)
+		return
+	}
+	handlers.WriteError(w, f.status, f.code, f.message)
+}
+
+// ---------------------------------------------------------
+// Autenticación por ruta según su AuthSpec
+// ---------------------------------------------------------
+func Authenticate(spec handlers.AuthSpec) handlers.Middleware {
+	return handlers.Middleware{
+		Name: spec.String(),
+		Wrap: func(next http.Handler) http.Handler {
+			return authMiddleware(spec, next)
+		},
+	}
+}
+
+func authMiddleware(spec handlers.AuthSpec, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		who, fail := authenticate(r, spec)
+		if fail != nil {
+			fail.write(w)
+			return
+		}
+
+		// Insertar la identidad verificada en el contexto
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), who)))
+	})
+}
+
+func authenticate(r *http.Request, spec handlers.AuthSpec) (*auth.Principal, *authFailure) {
+	if spec.MTLS == handlers.MTLSOnly {
+		return certPrincipal(r)
+	}
+
+	who, fail := credentialPrincipal(r, spec)
+	if fail != nil || spec.MTLS != handlers.MTLSBoth {
+		return who, fail
+	}
+
+	cert, fail := certPrincipal(r)
+	if fail != nil {
+		return nil, fail
+	}
+	who.Certificate = cert.Certificate
+	return who, nil
+}
+
+// credentialPrincipal autentica con token y/o API key según spec.APIKey
+func credentialPrincipal(r *http.Request, spec handlers.AuthSpec) (*auth.Principal, *authFailure) {
+	switch spec.APIKey {
+	case handlers.APIKeyEither:
+		// Sin Authorization pero con API key: cliente máquina
+		if r.Header.Get("Authorization") == "" && extractAPIKey(r) != "" {
+			return apiKeyPrincipal(r)
+		}
+		return tokenPrincipal(r, spec.Validator)
+
+	case handlers.APIKeyBoth:
+		key, fail := apiKeyPrincipal(r)
+		if fail != nil {
+			return nil, fail
+		}
+		who, fail := tokenPrincipal(r, spec.Validator)
+		if fail != nil {
+			return nil, fail
+		}
+		who.APIKey = key.APIKey
+		return who, nil
+	}
+
+	return tokenPrincipal(r, spec.Validator)
+}
+
+// certPrincipal usa el certificado de cliente que el handshake TLS ya verificó
+// contra TLS_CLIENT_CA_FILE (sin cadena verificada no hay identidad)
+func certPrincipal(r *http.Request) (*auth.Principal, *authFailure) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return nil, &authFailure{http.StatusUnauthorized, "client_cert_missing", "a verified client certificate is required"}
+	}
+	who := auth.FromCertificate(r.TLS.PeerCertificates[0])
+	if who.Subject == "" {
+		return nil, &authFailure{http.StatusUnauthorized, "client_cert_invalid", "client certificate has no subject or SAN"}
+	}
+	return who, nil
+}
+
+// tokenPrincipal valida el Bearer token con el validador elegido
+func tokenPrincipal(r *http.Request, validator string) (*auth.Principal, *authFailure) {
+	if validator == "" {
+		validator = handlers.ValidatorJWT
+	}
+
+	tokenString, err := extractToken(r)
+	if err != nil {
+		return nil, &authFailure{http.StatusUnauthorized, tokenErrorCode(err), err.Error()}
+	}
+
+	claims, err := validateToken(r.Context(), validator, tokenString)
+	if errors.Is(err, errIntrospectionUnavailable) {
+		log.Printf("[jwt] %v\n", err)
+		return nil, &authFailure{http.StatusServiceUnavailable, "introspection_unavailable", "token introspection unavailable"}
+	}
+	if err != nil {
+		return nil, &authFailure{http.StatusUnauthorized, tokenErrorCode(err), "invalid token: " + err.Error()}
+	}
+
+	if err := checkRevoked(claims); err != nil {
+		return nil, &authFailure{http.StatusUnauthorized, tokenErrorCode(err), "invalid token: " + err.Error()}
+	}
+
+	who := auth.NewPrincipal(claims, handlers.CurrentConfig().Authz)
+	who.Method = validator
+	return who, nil
+}
+
+// apiKeyPrincipal valida la API key y arma un Principal con sus scopes/roles
+func apiKeyPrincipal(r *http.Request) (*auth.Principal, *authFailure) {
+	raw := extractAPIKey(r)
+	if raw == "" {
+		return nil, &authFailure{http.StatusUnauthorized, "apikey_missing", "missing API key"}
+	}
+	if apiKeys == nil {
+		return nil, &authFailure{http.StatusUnauthorized, "apikey_invalid", "API keys are not enabled"}
+	}
+
+	key, err := apiKeys.Lookup(raw)
+	if err != nil {
+		code := "apikey_invalid"
+		switch {
+		case errors.Is(err, apikey.ErrDisabled):
+			code = "apikey_disabled"
+		case errors.Is(err, apikey.ErrExpired):
+			code = "apikey_expired"
+		}
+		return nil, &authFailure{http.StatusUnauthorized, code, err.Error()}
+	}
+
+	return &auth.Principal{
+		Method:    "apikey",
+		APIKey:    key.Name,
+		Subject:   "apikey:" + key.Name,
+		Roles:     key.Roles,
+		Scopes:    key.Scopes,
+		ExpiresAt: key.ExpiresAt,
+		Claims:    map[string]interface{}{"sub": "apikey:" + key.Name, "client_id": key.Name},
+	}, nil
+}
+
+// ---------------------------------------------------------
+// Extraer API key desde el header (o query param si está habilitado)
+// ---------------------------------------------------------
+func extractAPIKey(r *http.Request) string {
+	cfg := handlers.CurrentConfig().APIKeys
+	if v := strings.TrimSpace(r.Header.Get(cfg.Header)); v != "" {
+		return v
+	}
+	if cfg.QueryParam != "" {
+		return r.URL.Query().Get(cfg.QueryParam)
+	}
+	return ""
+}
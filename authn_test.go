@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"servicio-gateway/apikey"
+	"servicio-gateway/auth"
+	"servicio-gateway/config"
+	"servicio-gateway/handlers"
+)
+
+func useAPIKeys(t *testing.T, queryParam string) {
+	store, err := apikey.New([]apikey.Key{
+		{Name: "batch", Hash: apikey.Hash("batch-secret"), Scopes: []string{"users:read"}, Enabled: true},
+		{Name: "off", Hash: apikey.Hash("off-secret")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apiKeys = store
+
+	cfg := config.LoadConfigFromEnv()
+	cfg.APIKeys.QueryParam = queryParam
+	handlers.ConfigStore = config.NewStaticStore(cfg)
+	jwtRules = config.JWTConfig{}
+
+	t.Cleanup(func() {
+		apiKeys = nil
+		handlers.ConfigStore = nil
+	})
+}
+
+// runAuth pasa la petición por Authenticate(spec) y devuelve el principal o el código de error
+func runAuth(t *testing.T, spec handlers.AuthSpec, req *http.Request) (*auth.Principal, int, string) {
+	var who *auth.Principal
+	h := Authenticate(spec).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		who, _ = auth.FromRequest(r)
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	var body handlers.ErrorBody
+	json.NewDecoder(w.Body).Decode(&body)
+	return who, w.Code, body.Code
+}
+
+func TestAuthenticate_APIKeyEither(t *testing.T) {
+	useAPIKeys(t, "")
+	spec := handlers.AuthSpec{Validator: handlers.ValidatorJWT, APIKey: handlers.APIKeyEither}
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("X-API-Key", "batch-secret")
+	who, code, _ := runAuth(t, spec, req)
+	if code != http.StatusOK || who == nil {
+		t.Fatalf("Expected API key to authenticate, got %d", code)
+	}
+	if who.Method != "apikey" || who.Subject != "apikey:batch" || !who.HasScope("users:read") {
+		t.Errorf("Expected apikey principal with scope users:read, got %+v", who)
+	}
+
+	req = httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer "+signHS256(t, jwt.MapClaims{"sub": "7", "exp": time.Now().Add(time.Hour).Unix()}))
+	who, code, _ = runAuth(t, spec, req)
+	if code != http.StatusOK || who == nil || who.Subject != "7" || who.Method != "jwt" {
+		t.Errorf("Expected JWT principal for subject 7, got %d %+v", code, who)
+	}
+
+	req = httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("X-API-Key", "off-secret")
+	if _, code, errCode := runAuth(t, spec, req); code != http.StatusUnauthorized || errCode != "apikey_disabled" {
+		t.Errorf("Expected 401 apikey_disabled, got %d %s", code, errCode)
+	}
+
+	req = httptest.NewRequest("GET", "/users", nil)
+	if _, code, errCode := runAuth(t, spec, req); code != http.StatusUnauthorized || errCode != "token_missing" {
+		t.Errorf("Expected 401 token_missing without credentials, got %d %s", code, errCode)
+	}
+}
+
+func TestAuthenticate_APIKeyBoth(t *testing.T) {
+	useAPIKeys(t, "")
+	spec := handlers.AuthSpec{Validator: handlers.ValidatorJWT, APIKey: handlers.APIKeyBoth}
+	token := signHS256(t, jwt.MapClaims{"sub": "7", "exp": time.Now().Add(time.Hour).Unix()})
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if _, code, errCode := runAuth(t, spec, req); code != http.StatusUnauthorized || errCode != "apikey_missing" {
+		t.Errorf("Expected 401 apikey_missing, got %d %s", code, errCode)
+	}
+
+	req = httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("X-API-Key", "batch-secret")
+	if _, code, errCode := runAuth(t, spec, req); code != http.StatusUnauthorized || errCode != "token_missing" {
+		t.Errorf("Expected 401 token_missing, got %d %s", code, errCode)
+	}
+
+	req = httptest.NewRequest("GET", "/users", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-API-Key", "batch-secret")
+	who, code, _ := runAuth(t, spec, req)
+	if code != http.StatusOK || who == nil || who.Subject != "7" || who.APIKey != "batch" {
+		t.Errorf("Expected JWT principal tagged with key 'batch', got %d %+v", code, who)
+	}
+}
+
+func TestExtractAPIKey_QueryParam(t *testing.T) {
+	useAPIKeys(t, "api_key")
+
+	req := httptest.NewRequest("GET", "/users?api_key=batch-secret", nil)
+	if got := extractAPIKey(req); got != "batch-secret" {
+		t.Errorf("Expected key from query param, got '%s'", got)
+	}
+
+	useAPIKeys(t, "")
+	if got := extractAPIKey(req); got != "" {
+		t.Errorf("Expected query param to be ignored when disabled, got '%s'", got)
+	}
+}
+
+func TestAuthenticate_MTLS(t *testing.T) {
+	useAPIKeys(t, "")
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "batch-job", OrganizationalUnit: []string{"jobs"}}, SerialNumber: big.NewInt(1)}
+	withCert := func(req *http.Request) *http.Request {
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert},
+			VerifiedChains:   [][]*x509.Certificate{{cert}},
+		}
+		return req
+	}
+	token := signHS256(t, jwt.MapClaims{"sub": "7", "exp": time.Now().Add(time.Hour).Unix()})
+
+	only := handlers.AuthSpec{MTLS: handlers.MTLSOnly}
+	who, code, _ := runAuth(t, only, withCert(httptest.NewRequest("GET", "/jobs", nil)))
+	if code != http.StatusOK || who == nil || who.Subject != "batch-job" || !who.HasRole("jobs") {
+		t.Errorf("Expected certificate principal, got %d %+v", code, who)
+	}
+
+	// Certificado presentado pero no verificado (sin cadena) no cuenta
+	req := httptest.NewRequest("GET", "/jobs", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if _, code, errCode := runAuth(t, only, req); code != http.StatusUnauthorized || errCode != "client_cert_missing" {
+		t.Errorf("Expected 401 client_cert_missing, got %d %s", code, errCode)
+	}
+
+	both := handlers.AuthSpec{MTLS: handlers.MTLSBoth}
+	req = httptest.NewRequest("GET", "/jobs", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if _, code, errCode := runAuth(t, both, req); code != http.StatusUnauthorized || errCode != "client_cert_missing" {
+		t.Errorf("Expected 401 client_cert_missing with token only, got %d %s", code, errCode)
+	}
+
+	req = withCert(httptest.NewRequest("GET", "/jobs", nil))
+	req.Header.Set("Authorization", "Bearer "+token)
+	who, code, _ = runAuth(t, both, req)
+	if code != http.StatusOK || who == nil || who.Subject != "7" || who.Certificate != "batch-job" {
+		t.Errorf("Expected JWT principal tagged with the certificate, got %d %+v", code, who)
+	}
+}
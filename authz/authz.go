@@ -0,0 +1,76 @@
+package authz
+
+import (
+	"fmt"
+	"strings"
+
+	"servicio-gateway/auth"
+	"servicio-gateway/config"
+)
+
+// Policy declara qué tiene que cumplir el token para acceder a una ruta.
+// Una Policy vacía no exige nada más allá de estar autenticado.
+type Policy struct {
+	// Roles: basta con tener uno de ellos
+	Roles []string `json:"roles,omitempty" yaml:"roles"`
+	// Scopes: hay que tenerlos todos
+	Scopes []string `json:"scopes,omitempty" yaml:"scopes"`
+	// Owner: variable del path (ej. "id") que tiene que coincidir con el
+	// subject del token, salvo que tenga alguno de los roles de bypass
+	Owner string `json:"owner,omitempty" yaml:"owner"`
+}
+
+// Denied describe qué regla de la Policy falló
+type Denied struct {
+	Rule    string
+	Subject string
+	Reason  string
+}
+
+func (d *Denied) Error() string {
+	return fmt.Sprintf("rule %s failed for subject %q: %s", d.Rule, d.Subject, d.Reason)
+}
+
+// Empty indica si la Policy no exige nada
+func (p Policy) Empty() bool {
+	return len(p.Roles) == 0 && len(p.Scopes) == 0 && p.Owner == ""
+}
+
+// String resume la Policy para la tabla de rutas y los logs
+func (p Policy) String() string {
+	var parts []string
+	if len(p.Roles) > 0 {
+		parts = append(parts, "roles="+strings.Join(p.Roles, "|"))
+	}
+	if len(p.Scopes) > 0 {
+		parts = append(parts, "scopes="+strings.Join(p.Scopes, "+"))
+	}
+	if p.Owner != "" {
+		parts = append(parts, "owner="+p.Owner)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Evaluate aplica p al Principal autenticado. vars son las variables del
+// path de la petición. Devuelve nil si se permite o un *Denied si no.
+func Evaluate(p Policy, who *auth.Principal, vars map[string]string, cfg config.AuthzConfig) error {
+	if len(p.Roles) > 0 && !who.HasRole(p.Roles...) {
+		return &Denied{Rule: "roles", Subject: who.Subject,
+			Reason: "requires one of roles " + strings.Join(p.Roles, ", ")}
+	}
+
+	for _, s := range p.Scopes {
+		if !who.HasScope(s) {
+			return &Denied{Rule: "scopes", Subject: who.Subject, Reason: "missing scope " + s}
+		}
+	}
+
+	if p.Owner != "" && !who.HasRole(cfg.OwnerBypassRoles...) {
+		if who.Subject == "" || vars[p.Owner] != who.Subject {
+			return &Denied{Rule: "owner", Subject: who.Subject,
+				Reason: fmt.Sprintf("path {%s} must match claim %s", p.Owner, cfg.SubjectClaim)}
+		}
+	}
+
+	return nil
+}
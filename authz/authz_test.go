@@ -0,0 +1,75 @@
+package authz
+
+import (
+	"errors"
+	"testing"
+
+	"servicio-gateway/auth"
+	"servicio-gateway/config"
+)
+
+func who(claims map[string]interface{}) *auth.Principal {
+	return auth.NewPrincipal(claims, testCfg)
+}
+
+var testCfg = config.AuthzConfig{
+	SubjectClaim:     "sub",
+	RolesClaim:       "roles",
+	ScopeClaim:       "scope",
+	OwnerBypassRoles: []string{"admin"},
+}
+
+func denialRule(err error) string {
+	var d *Denied
+	if errors.As(err, &d) {
+		return d.Rule
+	}
+	return ""
+}
+
+func TestEvaluate_Owner(t *testing.T) {
+	p := Policy{Owner: "id"}
+	vars := map[string]string{"id": "42"}
+
+	if err := Evaluate(p, who(map[string]interface{}{"sub": "42"}), vars, testCfg); err != nil {
+		t.Errorf("Expected owner to be allowed, got %v", err)
+	}
+	if rule := denialRule(Evaluate(p, who(map[string]interface{}{"sub": "7"}), vars, testCfg)); rule != "owner" {
+		t.Errorf("Expected owner rule to fail, got '%s'", rule)
+	}
+	admin := map[string]interface{}{"sub": "7", "roles": []interface{}{"admin"}}
+	if err := Evaluate(p, who(admin), vars, testCfg); err != nil {
+		t.Errorf("Expected admin to bypass owner rule, got %v", err)
+	}
+}
+
+func TestEvaluate_RolesAndScopes(t *testing.T) {
+	p := Policy{Roles: []string{"support", "admin"}, Scopes: []string{"users:read", "users:write"}}
+
+	ok := map[string]interface{}{"roles": "support", "scope": "users:read users:write"}
+	if err := Evaluate(p, who(ok), nil, testCfg); err != nil {
+		t.Errorf("Expected allowed, got %v", err)
+	}
+
+	noRole := map[string]interface{}{"roles": []interface{}{"user"}, "scope": "users:read users:write"}
+	if rule := denialRule(Evaluate(p, who(noRole), nil, testCfg)); rule != "roles" {
+		t.Errorf("Expected roles rule to fail, got '%s'", rule)
+	}
+
+	missingScope := map[string]interface{}{"roles": "admin", "scope": "users:read"}
+	if rule := denialRule(Evaluate(p, who(missingScope), nil, testCfg)); rule != "scopes" {
+		t.Errorf("Expected scopes rule to fail, got '%s'", rule)
+	}
+}
+
+func TestEvaluate_CustomClaimNames(t *testing.T) {
+	cfg := testCfg
+	cfg.RolesClaim = "groups"
+	cfg.ScopeClaim = "scp"
+
+	p := Policy{Roles: []string{"ops"}, Scopes: []string{"audit"}}
+	claims := map[string]interface{}{"groups": []interface{}{"ops"}, "scp": []interface{}{"audit"}}
+	if err := Evaluate(p, auth.NewPrincipal(claims, cfg), nil, cfg); err != nil {
+		t.Errorf("Expected allowed with custom claim names, got %v", err)
+	}
+}
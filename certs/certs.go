@@ -0,0 +1,220 @@
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------
+// Certificados leídos de archivo que se releen cuando cambian
+// ---------------------------------------------------------
+
+// Reloadable es un material TLS respaldado por archivos
+type Reloadable interface {
+	// ReloadIfChanged relee los archivos si su mtime cambió. Si la nueva
+	// versión es inválida se conserva la anterior y se devuelve el error.
+	ReloadIfChanged() (bool, error)
+	String() string
+}
+
+// KeyPair es un certificado con su clave privada (servidor o cliente mTLS)
+type KeyPair struct {
+	certFile, keyFile string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// LoadKeyPair lee certFile y keyFile (PEM)
+func LoadKeyPair(certFile, keyFile string) (*KeyPair, error) {
+	k := &KeyPair{certFile: certFile, keyFile: keyFile}
+	if _, err := k.ReloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Certificate devuelve el par vigente
+func (k *KeyPair) Certificate() *tls.Certificate {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.cert
+}
+
+// GetCertificate sirve para tls.Config.GetCertificate (lado servidor)
+func (k *KeyPair) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return k.Certificate(), nil
+}
+
+// GetClientCertificate sirve para tls.Config.GetClientCertificate (lado cliente)
+func (k *KeyPair) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return k.Certificate(), nil
+}
+
+func (k *KeyPair) ReloadIfChanged() (bool, error) {
+	mod, err := latestModTime(k.certFile, k.keyFile)
+	if err != nil {
+		return false, err
+	}
+	k.mu.RLock()
+	same := k.cert != nil && mod.Equal(k.modTime)
+	k.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(k.certFile, k.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", k, err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+
+	k.mu.Lock()
+	k.cert = &cert
+	k.modTime = mod
+	k.mu.Unlock()
+	return true, nil
+}
+
+func (k *KeyPair) String() string {
+	return "keypair " + k.certFile
+}
+
+// CAPool es un bundle PEM de certificados de CA
+type CAPool struct {
+	file string
+
+	mu      sync.RWMutex
+	pool    *x509.CertPool
+	modTime time.Time
+}
+
+// LoadCAPool lee el bundle en file; tiene que traer al menos un certificado
+func LoadCAPool(file string) (*CAPool, error) {
+	p := &CAPool{file: file}
+	if _, err := p.ReloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Pool devuelve el conjunto de CAs vigente
+func (p *CAPool) Pool() *x509.CertPool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pool
+}
+
+func (p *CAPool) ReloadIfChanged() (bool, error) {
+	mod, err := latestModTime(p.file)
+	if err != nil {
+		return false, err
+	}
+	p.mu.RLock()
+	same := p.pool != nil && mod.Equal(p.modTime)
+	p.mu.RUnlock()
+	if same {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(p.file)
+	if err != nil {
+		return false, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return false, fmt.Errorf("%s: no PEM certificates found", p)
+	}
+
+	p.mu.Lock()
+	p.pool = pool
+	p.modTime = mod
+	p.mu.Unlock()
+	return true, nil
+}
+
+func (p *CAPool) String() string {
+	return "ca bundle " + p.file
+}
+
+// Watch revisa items cada interval y relee los que cambiaron, hasta que ctx se cancela
+func Watch(ctx context.Context, interval time.Duration, items ...Reloadable) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			for _, item := range items {
+				changed, err := item.ReloadIfChanged()
+				if err != nil {
+					log.Printf("[certs] reload of %s failed, keeping previous: %v\n", item, err)
+				} else if changed {
+					log.Printf("[certs] reloaded %s\n", item)
+				}
+			}
+		}
+	}
+}
+
+// ServerConfig arma el tls.Config del listener. Con clientCAs != nil los
+// certificados de cliente se verifican contra el bundle vigente en cada handshake.
+func ServerConfig(kp *KeyPair, clientCAs *CAPool, clientAuth tls.ClientAuthType) *tls.Config {
+	base := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: kp.GetCertificate,
+	}
+	if clientCAs == nil {
+		return base
+	}
+
+	base.ClientAuth = clientAuth
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = clientCAs.Pool()
+		return c, nil
+	}
+	return base
+}
+
+// ParseClientAuth traduce none | optional | require al modo de crypto/tls
+func ParseClientAuth(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	}
+	return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q (use none, optional or require)", mode)
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	if latest.IsZero() {
+		return latest, errors.New("no files given")
+	}
+	return latest, nil
+}
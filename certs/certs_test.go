@@ -0,0 +1,108 @@
+package certs
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"servicio-gateway/internal/testcerts"
+)
+
+func TestKeyPair_ReloadIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcerts.New(t, "ca", nil)
+	certFile, keyFile := testcerts.New(t, "one", ca).Write(t, dir, "server")
+
+	kp, err := LoadKeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if changed, _ := kp.ReloadIfChanged(); changed {
+		t.Error("Expected no reload when files did not change")
+	}
+
+	testcerts.New(t, "two", ca).Write(t, dir, "server")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	if changed, err := kp.ReloadIfChanged(); !changed || err != nil {
+		t.Fatalf("Expected reload after change, got %v (%v)", changed, err)
+	}
+	if cn := kp.Certificate().Leaf.Subject.CommonName; cn != "two" {
+		t.Errorf("Expected new certificate 'two', got '%s'", cn)
+	}
+
+	os.WriteFile(certFile, []byte("garbage"), 0o600)
+	later = later.Add(time.Second)
+	os.Chtimes(certFile, later, later)
+	if _, err := kp.ReloadIfChanged(); err == nil {
+		t.Error("Expected error for an invalid certificate")
+	}
+	if cn := kp.Certificate().Leaf.Subject.CommonName; cn != "two" {
+		t.Errorf("Expected previous certificate to be kept, got '%s'", cn)
+	}
+}
+
+func TestLoadCAPool_RejectsEmptyBundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(path, []byte("no certs here"), 0o600)
+
+	if _, err := LoadCAPool(path); err == nil {
+		t.Error("Expected error for a bundle without certificates")
+	}
+}
+
+func TestServerConfig_VerifiesClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcerts.New(t, "ca", nil)
+	other := testcerts.New(t, "other-ca", nil)
+	certFile, keyFile := testcerts.New(t, "gateway", ca).Write(t, dir, "server")
+	caFile, _ := ca.Write(t, dir, "ca")
+
+	kp, _ := LoadKeyPair(certFile, keyFile)
+	pool, err := LoadCAPool(caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = ServerConfig(kp, pool, tls.RequireAndVerifyClientCert)
+	srv.StartTLS()
+	defer srv.Close()
+
+	get := func(clientCert *testcerts.Cert) (*http.Response, error) {
+		cfg := &tls.Config{RootCAs: pool.Pool()}
+		if clientCert != nil {
+			cfg.Certificates = []tls.Certificate{clientCert.TLSCertificate()}
+		}
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		return c.Get(srv.URL)
+	}
+
+	resp, err := get(testcerts.New(t, "batch", ca))
+	if err != nil {
+		t.Fatalf("Expected client signed by the CA to be accepted, got %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := get(testcerts.New(t, "intruder", other)); err == nil {
+		t.Error("Expected client signed by another CA to be rejected")
+	}
+	if _, err := get(nil); err == nil {
+		t.Error("Expected client without certificate to be rejected")
+	}
+}
+
+func TestParseClientAuth(t *testing.T) {
+	if mode, _ := ParseClientAuth("optional"); mode != tls.VerifyClientCertIfGiven {
+		t.Errorf("Expected VerifyClientCertIfGiven, got %v", mode)
+	}
+	if _, err := ParseClientAuth("sometimes"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
@@ -0,0 +1,279 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+// Valores por defecto de BreakerConfig (campos en cero)
+const (
+	defaultFailureRate         = 0.5
+	defaultMinRequests         = 10
+	defaultConsecutiveFailures = 5
+	defaultBreakerWindow       = 30 * time.Second
+	defaultOpenTimeout         = 30 * time.Second
+	defaultHalfOpenProbes      = 3
+
+	// la ventana se divide en breakerBuckets tramos que se van descartando
+	breakerBuckets = 10
+)
+
+// Estados del circuito
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+// CircuitOpenError indica que la llamada no se hizo porque el circuito del
+// upstream está abierto; RetryAfter es cuánto falta para volver a probar
+type CircuitOpenError struct {
+	Upstream   string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s is open (retry after %v)", e.Upstream, e.RetryAfter)
+}
+
+// BreakerStats es el estado de un circuit breaker
+type BreakerStats struct {
+	State string `json:"state"`
+	// Requests y Failures dentro de la ventana actual
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	// Rejected: llamadas cortadas con el circuito abierto (acumulado)
+	Rejected int64 `json:"rejected"`
+}
+
+// Breaker es el circuit breaker de un upstream:
+//   - closed: las llamadas pasan; se abre por tasa de fallos en la ventana o
+//     por fallos consecutivos
+//   - open: se rechazan sin llamar hasta que pasa OpenTimeout
+//   - half-open: pasan hasta HalfOpenProbes pruebas a la vez; si todas salen
+//     bien se cierra, al primer fallo se vuelve a abrir
+type Breaker struct {
+	name string
+	cfg  config.BreakerConfig
+	now  func() time.Time
+
+	mu          sync.Mutex
+	state       string
+	buckets     [breakerBuckets]breakerBucket
+	consecutive int
+	openedAt    time.Time
+	probes      int // pruebas en curso (half-open)
+	probeOK     int // pruebas que salieron bien (half-open)
+	rejected    int64
+}
+
+type breakerBucket struct {
+	start     time.Time
+	successes int64
+	failures  int64
+}
+
+// NewBreaker arma el breaker del upstream name; nil si está deshabilitado
+func NewBreaker(name string, cfg config.BreakerConfig) *Breaker {
+	return newBreaker(name, cfg, time.Now)
+}
+
+func newBreaker(name string, cfg config.BreakerConfig, now func() time.Time) *Breaker {
+	if cfg.Enabled != nil && !*cfg.Enabled {
+		return nil
+	}
+	if cfg.FailureRate == 0 {
+		cfg.FailureRate = defaultFailureRate
+	}
+	if cfg.MinRequests == 0 {
+		cfg.MinRequests = defaultMinRequests
+	}
+	if cfg.ConsecutiveFailures == 0 {
+		cfg.ConsecutiveFailures = defaultConsecutiveFailures
+	}
+	if cfg.Window == 0 {
+		cfg.Window = config.Duration(defaultBreakerWindow)
+	} else if cfg.Window.Std() < config.MinBreakerWindow {
+		// Validate ya lo rechaza; evita tramos de ancho 0 si llega sin validar
+		cfg.Window = config.Duration(config.MinBreakerWindow)
+	}
+	if cfg.OpenTimeout == 0 {
+		cfg.OpenTimeout = config.Duration(defaultOpenTimeout)
+	}
+	if cfg.HalfOpenProbes == 0 {
+		cfg.HalfOpenProbes = defaultHalfOpenProbes
+	}
+	return &Breaker{name: name, cfg: cfg, now: now, state: StateClosed}
+}
+
+// outcome de una llamada para el breaker
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeIgnored: la llamada no dice nada del upstream (p.ej. la canceló el cliente)
+	outcomeIgnored
+)
+
+// classifyOutcome: los errores de transporte y los 5xx son fallos del upstream
+func classifyOutcome(ctx context.Context, resp *http.Response, err error) outcome {
+	if err != nil {
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) {
+			return outcomeIgnored
+		}
+		return outcomeFailure
+	}
+	if resp.StatusCode >= 500 {
+		return outcomeFailure
+	}
+	return outcomeSuccess
+}
+
+// allow decide si la llamada puede salir; probe indica que es una prueba en half-open
+func (b *Breaker) allow() (probe bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	if b.state == StateOpen {
+		if wait := b.openedAt.Add(b.cfg.OpenTimeout.Std()).Sub(now); wait > 0 {
+			b.rejected++
+			return false, &CircuitOpenError{Upstream: b.name, RetryAfter: wait}
+		}
+		b.transition(StateHalfOpen, "open timeout elapsed")
+	}
+	if b.state == StateHalfOpen {
+		if b.probes+b.probeOK >= b.cfg.HalfOpenProbes {
+			b.rejected++
+			return false, &CircuitOpenError{Upstream: b.name, RetryAfter: time.Second}
+		}
+		b.probes++
+		return true, nil
+	}
+	return false, nil
+}
+
+// record anota el resultado de una llamada que allow dejó salir
+func (b *Breaker) record(probe bool, o outcome) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probes--
+		if b.state != StateHalfOpen {
+			return
+		}
+		switch o {
+		case outcomeFailure:
+			b.open("probe failed")
+		case outcomeSuccess:
+			b.probeOK++
+			if b.probeOK >= b.cfg.HalfOpenProbes {
+				b.transition(StateClosed, fmt.Sprintf("%d probes succeeded", b.probeOK))
+			}
+		}
+		return
+	}
+	if b.state != StateClosed || o == outcomeIgnored {
+		return
+	}
+
+	bucket := b.bucket(b.now())
+	if o == outcomeSuccess {
+		bucket.successes++
+		b.consecutive = 0
+		return
+	}
+	bucket.failures++
+	b.consecutive++
+
+	if b.consecutive >= b.cfg.ConsecutiveFailures {
+		b.open(fmt.Sprintf("%d consecutive failures", b.consecutive))
+		return
+	}
+	requests, failures := b.totals(b.now())
+	if requests >= int64(b.cfg.MinRequests) && float64(failures)/float64(requests) >= b.cfg.FailureRate {
+		b.open(fmt.Sprintf("failure rate %.0f%% over %d requests", 100*float64(failures)/float64(requests), requests))
+	}
+}
+
+// bucket devuelve el tramo de la ventana que corresponde a now (vaciándolo si es viejo)
+func (b *Breaker) bucket(now time.Time) *breakerBucket {
+	width := b.cfg.Window.Std() / breakerBuckets
+	start := now.Truncate(width)
+	bk := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !bk.start.Equal(start) {
+		*bk = breakerBucket{start: start}
+	}
+	return bk
+}
+
+// totals suma los tramos que siguen dentro de la ventana
+func (b *Breaker) totals(now time.Time) (requests, failures int64) {
+	from := now.Add(-b.cfg.Window.Std())
+	for _, bk := range b.buckets {
+		if bk.start.After(from) {
+			requests += bk.successes + bk.failures
+			failures += bk.failures
+		}
+	}
+	return requests, failures
+}
+
+func (b *Breaker) open(reason string) {
+	b.openedAt = b.now()
+	b.transition(StateOpen, reason)
+}
+
+// transition cambia de estado y lo registra; cada estado arranca con
+// contadores limpios (las pruebas en curso se descuentan al terminar)
+func (b *Breaker) transition(to, reason string) {
+	log.Printf("[breaker] %s: %s -> %s (%s)\n", b.name, b.state, to, reason)
+	b.state = to
+	b.consecutive, b.probeOK = 0, 0
+	if to == StateClosed {
+		b.buckets = [breakerBuckets]breakerBucket{}
+	}
+}
+
+// Stats devuelve el estado actual
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	requests, failures := b.totals(b.now())
+	s := BreakerStats{
+		State:               b.state,
+		Requests:            requests,
+		Failures:            failures,
+		ConsecutiveFailures: b.consecutive,
+		Rejected:            b.rejected,
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		s.OpenedAt = &openedAt
+	}
+	return s
+}
+
+// RetryAfterSeconds redondea hacia arriba para el header Retry-After
+func RetryAfterSeconds(d time.Duration) int {
+	return int(math.Max(1, math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+// fakeClock avanza solo cuando el test lo pide
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(cfg config.BreakerConfig) (*Breaker, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	return newBreaker("security", cfg, clock.Now), clock
+}
+
+// call simula una llamada con el resultado o
+func call(b *Breaker, o outcome) error {
+	probe, err := b.allow()
+	if err != nil {
+		return err
+	}
+	b.record(probe, o)
+	return nil
+}
+
+func TestBreaker_OpensOnConsecutiveFailures(t *testing.T) {
+	b, clock := newTestBreaker(config.BreakerConfig{ConsecutiveFailures: 3, OpenTimeout: config.Duration(10 * time.Second)})
+
+	for i := 0; i < 3; i++ {
+		call(b, outcomeFailure)
+	}
+	if b.Stats().State != StateOpen {
+		t.Fatalf("Expected open after 3 consecutive failures, got %s", b.Stats().State)
+	}
+
+	clock.Advance(4 * time.Second)
+	err := call(b, outcomeSuccess)
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) || openErr.RetryAfter != 6*time.Second {
+		t.Errorf("Expected CircuitOpenError with 6s left, got %v", err)
+	}
+	if b.Stats().Rejected != 1 {
+		t.Errorf("Expected 1 rejected call, got %d", b.Stats().Rejected)
+	}
+}
+
+func TestBreaker_SuccessResetsConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(config.BreakerConfig{ConsecutiveFailures: 3, MinRequests: 100})
+
+	call(b, outcomeFailure)
+	call(b, outcomeFailure)
+	call(b, outcomeSuccess)
+	call(b, outcomeFailure)
+	call(b, outcomeFailure)
+	if b.Stats().State != StateClosed {
+		t.Errorf("Expected closed, got %s", b.Stats().State)
+	}
+}
+
+func TestBreaker_OpensOnFailureRate(t *testing.T) {
+	b, _ := newTestBreaker(config.BreakerConfig{FailureRate: 0.5, MinRequests: 4, ConsecutiveFailures: 100})
+
+	call(b, outcomeSuccess)
+	call(b, outcomeFailure)
+	call(b, outcomeSuccess)
+	if b.Stats().State != StateClosed {
+		t.Fatal("Expected closed below MinRequests")
+	}
+	call(b, outcomeFailure)
+	if s := b.Stats(); s.State != StateOpen {
+		t.Errorf("Expected open at 50%% failures over 4 requests, got %+v", s)
+	}
+}
+
+func TestBreaker_RollingWindowForgetsOldFailures(t *testing.T) {
+	b, clock := newTestBreaker(config.BreakerConfig{
+		FailureRate: 0.5, MinRequests: 4, ConsecutiveFailures: 100, Window: config.Duration(10 * time.Second),
+	})
+
+	call(b, outcomeFailure)
+	call(b, outcomeFailure)
+	call(b, outcomeFailure)
+	clock.Advance(11 * time.Second)
+
+	if s := b.Stats(); s.Requests != 0 {
+		t.Errorf("Expected an empty window, got %+v", s)
+	}
+	call(b, outcomeSuccess)
+	call(b, outcomeSuccess)
+	call(b, outcomeSuccess)
+	call(b, outcomeFailure)
+	if s := b.Stats(); s.State != StateClosed || s.Requests != 4 || s.Failures != 1 {
+		t.Errorf("Expected closed with 1/4 failures in the window, got %+v", s)
+	}
+}
+
+func TestBreaker_HalfOpenProbes(t *testing.T) {
+	b, clock := newTestBreaker(config.BreakerConfig{
+		ConsecutiveFailures: 1, OpenTimeout: config.Duration(5 * time.Second), HalfOpenProbes: 2,
+	})
+	call(b, outcomeFailure)
+	clock.Advance(5 * time.Second)
+
+	// dos pruebas a la vez; la tercera se rechaza
+	p1, err1 := b.allow()
+	p2, err2 := b.allow()
+	_, err3 := b.allow()
+	if !p1 || !p2 || err1 != nil || err2 != nil || err3 == nil {
+		t.Fatalf("Expected 2 probes and a rejection, got %v %v %v", err1, err2, err3)
+	}
+	if b.Stats().State != StateHalfOpen {
+		t.Errorf("Expected half-open, got %s", b.Stats().State)
+	}
+
+	b.record(p1, outcomeSuccess)
+	b.record(p2, outcomeSuccess)
+	if b.Stats().State != StateClosed {
+		t.Errorf("Expected closed after 2 successful probes, got %s", b.Stats().State)
+	}
+}
+
+func TestBreaker_FailedProbeReopens(t *testing.T) {
+	b, clock := newTestBreaker(config.BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: config.Duration(5 * time.Second)})
+	call(b, outcomeFailure)
+	clock.Advance(5 * time.Second)
+
+	call(b, outcomeFailure)
+	s := b.Stats()
+	if s.State != StateOpen || !s.OpenedAt.Equal(clock.Now()) {
+		t.Errorf("Expected reopened at the probe time, got %+v", s)
+	}
+}
+
+func TestBreaker_IgnoredOutcomes(t *testing.T) {
+	b, _ := newTestBreaker(config.BreakerConfig{ConsecutiveFailures: 1})
+	call(b, outcomeIgnored)
+	if s := b.Stats(); s.State != StateClosed || s.Requests != 0 {
+		t.Errorf("Expected canceled calls not to count, got %+v", s)
+	}
+}
+
+func TestNewBreaker_Disabled(t *testing.T) {
+	disabled := false
+	if b := NewBreaker("security", config.BreakerConfig{Enabled: &disabled}); b != nil {
+		t.Error("Expected no breaker when disabled")
+	}
+}
+
+func TestDo_FailsFastWhenCircuitOpen(t *testing.T) {
+	transport, err := NewTransport("security", config.UpstreamConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	breaker := NewBreaker("security", config.BreakerConfig{ConsecutiveFailures: 2})
+	Upstreams.Register("security", transport, nil, breaker)
+	t.Cleanup(func() { Upstreams = NewRegistry() })
+
+	for i := 0; i < 2; i++ {
+		ProxyRequestTo("security", "GET", "http://127.0.0.1:1/", nil, http.Header{})
+	}
+	_, _, _, err = ProxyRequestTo("security", "GET", "http://127.0.0.1:1/", nil, http.Header{})
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("Expected CircuitOpenError, got %v", err)
+	}
+	if s := transport.Stats(); s.Requests != 2 {
+		t.Errorf("Expected the open circuit to skip the upstream, got %d requests", s.Requests)
+	}
+	if s := Upstreams.Stats()[0].Breaker; s == nil || s.State != StateOpen {
+		t.Errorf("Expected breaker state in upstream stats, got %+v", s)
+	}
+}
+
+func TestBreaker_TinyWindowIsClamped(t *testing.T) {
+	b, _ := newTestBreaker(config.BreakerConfig{Window: config.Duration(5 * time.Nanosecond)})
+
+	call(b, outcomeSuccess)
+	call(b, outcomeFailure)
+	if got := b.Stats(); got.Requests != 2 || got.Failures != 1 {
+		t.Errorf("Expected a window clamped to %v to count both calls, got %+v", config.MinBreakerWindow, got)
+	}
+}
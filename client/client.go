@@ -2,7 +2,9 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"log"
@@ -15,9 +17,33 @@ var HttpClient = &http.Client{
 	Timeout: 15 * time.Second,
 }
 
+// Upstreams: cliente propio por upstream (security, profile, eventbus), con
+// su pool, timeouts y TLS; los que no están registrados usan HttpClient
+var Upstreams = NewRegistry()
+
+// For devuelve el cliente del upstream name
+func For(name string) *http.Client {
+	if c, ok := Upstreams.Client(name); ok {
+		return c
+	}
+	return HttpClient
+}
+
 // ProxyRequest envía la petición al servicio objetivo y devuelve status, body, headers
 func ProxyRequest(method, url string, body io.Reader, headers http.Header) (int, []byte, http.Header, error) {
-	req, err := http.NewRequest(method, url, body)
+	return ProxyRequestTo("", method, url, body, headers)
+}
+
+// ProxyRequestTo es ProxyRequest usando el cliente del upstream indicado.
+// Un fallo de handshake TLS se devuelve como *TLSError.
+func ProxyRequestTo(upstream, method, url string, body io.Reader, headers http.Header) (int, []byte, http.Header, error) {
+	return ProxyRequestContext(context.Background(), upstream, method, url, body, headers)
+}
+
+// ProxyRequestContext es ProxyRequestTo atado a ctx: se cancela con él y usa
+// su presupuesto de reintentos (ver WithRetryBudget)
+func ProxyRequestContext(ctx context.Context, upstream, method, url string, body io.Reader, headers http.Header) (int, []byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 	if err != nil {
 		return 0, nil, nil, err
 	}
@@ -32,9 +58,8 @@ func ProxyRequest(method, url string, body io.Reader, headers http.Header) (int,
 		}
 	}
 
-	resp, err := HttpClient.Do(req)
+	resp, err := Do(upstream, req)
 	if err != nil {
-		log.Printf("[client] error calling %s: %v\n", url, err)
 		return 0, nil, nil, err
 	}
 	defer resp.Body.Close()
@@ -47,6 +72,60 @@ func ProxyRequest(method, url string, body io.Reader, headers http.Header) (int,
 	return resp.StatusCode, respBody, resp.Header, nil
 }
 
+// Do envía req con el cliente del upstream sin leer la respuesta (el llamador
+// cierra resp.Body), reintentando según la política del upstream si req es
+// idempotente. Un fallo de handshake TLS se devuelve como *TLSError.
+func Do(upstream string, req *http.Request) (*http.Response, error) {
+	up, ok := Upstreams.lookup(upstream)
+	if !ok {
+		up = &entry{client: HttpClient}
+	}
+	return do(up, upstream, req)
+}
+
+func do(up *entry, upstream string, req *http.Request) (*http.Response, error) {
+	name := upstreamName(upstream, req)
+	var resp *http.Response
+	var err error
+	if up.retry.allows(req) {
+		resp, err = doWithRetry(up, name, req)
+	} else {
+		resp, err = send(up, name, req)
+	}
+	if err != nil {
+		var tlsErr *TLSError
+		var openErr *CircuitOpenError
+		if errors.As(err, &tlsErr) || errors.As(err, &openErr) {
+			log.Printf("[client] %v (calling %s)\n", err, req.URL)
+		} else {
+			log.Printf("[client] error calling %s: %v\n", req.URL, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// send hace un solo intento, si el circuit breaker del upstream lo deja
+func send(up *entry, name string, req *http.Request) (*http.Response, error) {
+	probe, err := up.breaker.allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := up.client.Do(req)
+	up.breaker.record(probe, classifyOutcome(req.Context(), resp, err))
+	if err != nil {
+		return nil, classifyError(name, err)
+	}
+	return resp, nil
+}
+
+func upstreamName(upstream string, req *http.Request) string {
+	if upstream != "" {
+		return upstream
+	}
+	return req.URL.Host
+}
+
 // PostEvent publica un evento en el EventBus usando directamente la URL.
 // eventBusURL: la URL base del event-bus, por ejemplo "http://notification-orchestrator:8085" o "http://notification-orchestrator:8085/api"
 // event: cualquier estructura serializable a JSON
@@ -75,7 +154,7 @@ func PostEvent(eventBusURL string, event interface{}) error {
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := HttpClient.Do(req)
+	resp, err := Do("eventbus", req)
 	if err != nil {
 		log.Printf("[client] error posting event to %s: %v\n", target, err)
 		return err
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+
+	"servicio-gateway/config"
+)
+
+// PoolStats es el estado del pool de conexiones de un upstream
+type PoolStats struct {
+	Upstream string `json:"upstream"`
+	// OpenConns: conexiones TCP abiertas ahora; IdleConns: estimación de
+	// cuántas están ociosas (abiertas menos peticiones en curso)
+	OpenConns int64 `json:"openConns"`
+	IdleConns int64 `json:"idleConns"`
+	InFlight  int64 `json:"inFlight"`
+	// Acumulados desde el arranque
+	Requests    int64 `json:"requests"`
+	ConnsOpened int64 `json:"connsOpened"`
+	ConnsReused int64 `json:"connsReused"`
+	DialErrors  int64 `json:"dialErrors"`
+
+	Limits config.TransportConfig `json:"limits"`
+}
+
+// UpstreamStats es lo que se expone de cada upstream en /admin/upstreams
+type UpstreamStats struct {
+	PoolStats
+	Retry   *RetryStats   `json:"retry,omitempty"`
+	Breaker *BreakerStats `json:"breaker,omitempty"`
+}
+
+// entry es lo registrado para cada upstream. stream es el cliente de las
+// respuestas en streaming (ver DoStream).
+type entry struct {
+	client    *http.Client
+	stream    *http.Client
+	transport *Transport
+	retry     *RetryPolicy
+	breaker   *Breaker
+}
+
+// Registry guarda un cliente por upstream con nombre (security, profile, eventbus)
+type Registry struct {
+	mu     sync.RWMutex
+	byName map[string]*entry
+	// configured: la configuración con la que Configure armó cada upstream
+	configured map[string]config.UpstreamConfig
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byName: map[string]*entry{}, configured: map[string]config.UpstreamConfig{}}
+}
+
+// Configure arma y registra el Transport, la política de reintentos y el
+// circuit breaker de cada upstream de cfg.ServiceNames. Se puede llamar de
+// nuevo al recargar la configuración: solo se rearman los upstreams cuya
+// configuración cambió (los demás conservan pool, estadísticas y breaker) y,
+// si alguno no se puede armar, no se reemplaza ninguno.
+func (g *Registry) Configure(cfg config.Config) error {
+	type built struct {
+		name      string
+		up        config.UpstreamConfig
+		transport *Transport
+	}
+	var changed []built
+	for _, name := range cfg.ServiceNames() {
+		up := cfg.Upstream(name)
+		if g.isConfigured(name, up) {
+			continue
+		}
+		t, err := NewTransport(name, up)
+		if err != nil {
+			return err
+		}
+		changed = append(changed, built{name, up, t})
+	}
+	for _, b := range changed {
+		g.Register(b.name, b.transport, NewRetryPolicy(b.up.Retry), NewBreaker(b.name, b.up.Breaker))
+		g.mu.Lock()
+		g.configured[b.name] = b.up
+		g.mu.Unlock()
+	}
+	return nil
+}
+
+func (g *Registry) isConfigured(name string, up config.UpstreamConfig) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	prev, ok := g.configured[name]
+	return ok && reflect.DeepEqual(prev, up)
+}
+
+// Register reemplaza el cliente del upstream name; retry y breaker pueden ser
+// nil (sin reintentos, sin circuit breaker)
+func (g *Registry) Register(name string, t *Transport, retry *RetryPolicy, breaker *Breaker) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.configured, name)
+	if old, ok := g.byName[name]; ok && old.transport != t {
+		old.transport.CloseIdleConnections()
+	}
+	g.byName[name] = &entry{
+		client:    &http.Client{Transport: t, Timeout: t.Timeout()},
+		stream:    &http.Client{Transport: headerTimeout{next: t, timeout: t.HeaderTimeout()}},
+		transport: t,
+		retry:     retry,
+		breaker:   breaker,
+	}
+}
+
+// Client devuelve el cliente del upstream name, si está registrado
+func (g *Registry) Client(name string) (*http.Client, bool) {
+	up, ok := g.lookup(name)
+	if !ok {
+		return nil, false
+	}
+	return up.client, true
+}
+
+func (g *Registry) lookup(name string) (*entry, bool) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	up, ok := g.byName[name]
+	return up, ok
+}
+
+// Stats devuelve el estado de cada upstream, ordenado por nombre
+func (g *Registry) Stats() []UpstreamStats {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	out := make([]UpstreamStats, 0, len(g.byName))
+	for _, up := range g.byName {
+		s := UpstreamStats{PoolStats: up.transport.Stats()}
+		if up.retry != nil {
+			retry := up.retry.Stats()
+			s.Retry = &retry
+		}
+		if up.breaker != nil {
+			breaker := up.breaker.Stats()
+			s.Breaker = &breaker
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Upstream < out[j].Upstream })
+	return out
+}
+
+// ReloadIfChanged relee CA y certificado de cliente de los upstreams que los
+// tienen; así certs.Watch sigue también a los rearmados por una recarga
+func (g *Registry) ReloadIfChanged() (bool, error) {
+	g.mu.RLock()
+	transports := make([]*Transport, 0, len(g.byName))
+	for _, up := range g.byName {
+		if up.transport.tls.hasFiles() {
+			transports = append(transports, up.transport)
+		}
+	}
+	g.mu.RUnlock()
+
+	var changed bool
+	var errs []error
+	for _, t := range transports {
+		c, err := t.ReloadIfChanged()
+		changed = changed || c
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return changed, errors.Join(errs...)
+}
+
+func (g *Registry) String() string {
+	return "upstream tls"
+}
@@ -0,0 +1,287 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+// Valores por defecto de RetryConfig (campos en cero)
+const (
+	defaultMaxAttempts = 3
+	defaultBackoff     = 100 * time.Millisecond
+	defaultMaxBackoff  = 2 * time.Second
+)
+
+var defaultRetryOn = []string{"502", "503", "504", "connect", "reset"}
+
+// RetryStats son los contadores de reintentos de un upstream
+type RetryStats struct {
+	// Attempts: intentos hechos con la política (el primero incluido)
+	Attempts int64 `json:"attempts"`
+	Retries  int64 `json:"retries"`
+	// Recovered: llamadas que fallaron y salieron bien en un reintento
+	Recovered int64 `json:"recovered"`
+	// Exhausted: se agotaron MaxAttempts; BudgetExhausted: se agotó el
+	// presupuesto de la petición entrante antes que los intentos
+	Exhausted       int64 `json:"exhausted"`
+	BudgetExhausted int64 `json:"budgetExhausted"`
+
+	MaxAttempts int `json:"maxAttempts"`
+}
+
+// RetryPolicy decide si una llamada a un upstream se reintenta y cuánto se espera
+type RetryPolicy struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	statuses    map[int]bool
+	errors      map[string]bool
+
+	attempts, retries, recovered, exhausted, budgetExhausted atomic.Int64
+}
+
+// NewRetryPolicy arma la política según cfg (ver config.RetryConfig)
+func NewRetryPolicy(cfg config.RetryConfig) *RetryPolicy {
+	p := &RetryPolicy{
+		maxAttempts: cfg.MaxAttempts,
+		backoff:     cfg.Backoff.Std(),
+		maxBackoff:  cfg.MaxBackoff.Std(),
+		statuses:    map[int]bool{},
+		errors:      map[string]bool{},
+	}
+	if p.maxAttempts == 0 {
+		p.maxAttempts = defaultMaxAttempts
+	}
+	if p.backoff == 0 {
+		p.backoff = defaultBackoff
+	}
+	if p.maxBackoff == 0 {
+		p.maxBackoff = defaultMaxBackoff
+	}
+	retryOn := cfg.RetryOn
+	if retryOn == nil {
+		retryOn = defaultRetryOn
+	}
+	for _, on := range retryOn {
+		if status, err := strconv.Atoi(on); err == nil {
+			p.statuses[status] = true
+		} else {
+			p.errors[on] = true
+		}
+	}
+	return p
+}
+
+// Stats devuelve los contadores actuales
+func (p *RetryPolicy) Stats() RetryStats {
+	return RetryStats{
+		Attempts:        p.attempts.Load(),
+		Retries:         p.retries.Load(),
+		Recovered:       p.recovered.Load(),
+		Exhausted:       p.exhausted.Load(),
+		BudgetExhausted: p.budgetExhausted.Load(),
+		MaxAttempts:     p.maxAttempts,
+	}
+}
+
+// allows indica si req se puede reintentar: métodos idempotentes (o con
+// Idempotency-Key) y un cuerpo que se pueda volver a enviar
+func (p *RetryPolicy) allows(req *http.Request) bool {
+	if p == nil || p.maxAttempts < 2 {
+		return false
+	}
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	return replayable && (idempotent(req.Method) || req.Header.Get("Idempotency-Key") != "")
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryReason devuelve por qué se reintentaría el resultado ("" si no)
+func (p *RetryPolicy) retryReason(resp *http.Response, err error) string {
+	if err == nil {
+		if p.statuses[resp.StatusCode] {
+			return "status " + strconv.Itoa(resp.StatusCode)
+		}
+		return ""
+	}
+	if class := errorClass(err); class != "" && p.errors[class] {
+		return class + ": " + err.Error()
+	}
+	return ""
+}
+
+// errorClass clasifica un error de transporte en connect, reset o timeout.
+// Los fallos TLS no se reintentan: repetir el handshake no los arregla.
+func errorClass(err error) string {
+	var tlsErr *TLSError
+	if errors.As(err, &tlsErr) {
+		return ""
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return "connect"
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return "reset"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return ""
+}
+
+// wait es la espera antes del intento attempt+1: backoff exponencial con
+// jitter (entre la mitad y el total), o el Retry-After del upstream si no
+// supera MaxBackoff
+func (p *RetryPolicy) wait(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+			if d := time.Duration(secs) * time.Second; d <= p.maxBackoff {
+				return d
+			}
+		}
+	}
+	d := p.backoff
+	for i := 1; i < attempt && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.maxBackoff {
+		d = p.maxBackoff
+	}
+	return d/2 + time.Duration(jitter(int64(d/2)+1))
+}
+
+// jitter y sleep son variables para poder reemplazarlas en los tests
+var jitter = rand.Int63n
+
+var sleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ---------------------------------------------------------
+// Presupuesto de reintentos por petición entrante
+// ---------------------------------------------------------
+
+type budgetKey struct{}
+
+// retryBudget lo comparten todas las llamadas a upstreams de una petición
+type retryBudget struct {
+	remaining atomic.Int64
+}
+
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	return b.remaining.Add(-1) >= 0
+}
+
+// WithRetryBudget devuelve un contexto con n reintentos para repartir entre
+// todas las llamadas que lo usen
+func WithRetryBudget(ctx context.Context, n int) context.Context {
+	b := &retryBudget{}
+	b.remaining.Store(int64(n))
+	return context.WithValue(ctx, budgetKey{}, b)
+}
+
+func budgetFrom(ctx context.Context) *retryBudget {
+	b, _ := ctx.Value(budgetKey{}).(*retryBudget)
+	return b
+}
+
+// RetryBudgetMiddleware da a cada petición entrante su presupuesto de reintentos.
+// budget se consulta en cada petición para seguir las recargas de configuración.
+func RetryBudgetMiddleware(budget func() int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithRetryBudget(r.Context(), budget())))
+		})
+	}
+}
+
+// doWithRetry envía req reintentando según la política de up. Cada intento
+// fallido se registra en el log; devuelve el resultado del último intento.
+func doWithRetry(up *entry, name string, req *http.Request) (*http.Response, error) {
+	p := up.retry
+	ctx := req.Context()
+	budget := budgetFrom(ctx)
+
+	for attempt := 1; ; attempt++ {
+		p.attempts.Add(1)
+		resp, err := send(up, name, req)
+
+		reason := p.retryReason(resp, err)
+		if reason == "" || ctx.Err() != nil {
+			if attempt > 1 && reason == "" && err == nil && resp.StatusCode < 500 {
+				p.recovered.Add(1)
+				log.Printf("[client] %s %s succeeded on attempt %d/%d\n", req.Method, req.URL, attempt, p.maxAttempts)
+			}
+			return resp, err
+		}
+		if attempt >= p.maxAttempts {
+			p.exhausted.Add(1)
+			log.Printf("[client] %s %s attempt %d/%d failed (%s), giving up\n", req.Method, req.URL, attempt, p.maxAttempts, reason)
+			return resp, err
+		}
+		if !budget.take() {
+			p.budgetExhausted.Add(1)
+			log.Printf("[client] %s %s attempt %d/%d failed (%s), retry budget exhausted\n", req.Method, req.URL, attempt, p.maxAttempts, reason)
+			return resp, err
+		}
+
+		wait := p.wait(attempt, resp)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			log.Printf("[client] %s %s attempt %d/%d failed (%s), no time left to retry\n", req.Method, req.URL, attempt, p.maxAttempts, reason)
+			return resp, err
+		}
+		log.Printf("[client] %s %s attempt %d/%d failed (%s), retrying in %v\n", req.Method, req.URL, attempt, p.maxAttempts, reason, wait)
+
+		if resp != nil {
+			// vaciar el cuerpo (acotado) deja la conexión reutilizable
+			io.CopyN(io.Discard, resp.Body, 4096)
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+
+		next := req.Clone(ctx)
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("retry %s %s: %w", req.Method, req.URL, err)
+			}
+			next.Body = body
+		}
+		req = next
+		p.retries.Add(1)
+	}
+}
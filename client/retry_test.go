@@ -0,0 +1,213 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+// useRetry registra "profile" con la política cfg y reemplaza sleep para no
+// esperar; devuelve las esperas pedidas
+func useRetry(t *testing.T, cfg config.RetryConfig) (*RetryPolicy, *[]time.Duration) {
+	transport, err := NewTransport("profile", config.UpstreamConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := NewRetryPolicy(cfg)
+	Upstreams.Register("profile", transport, policy, nil)
+
+	var waits []time.Duration
+	origSleep := sleep
+	sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	t.Cleanup(func() {
+		Upstreams = NewRegistry()
+		sleep = origSleep
+	})
+	return policy, &waits
+}
+
+// flakyServer responde failStatus las primeras fails veces y luego 200
+func flakyServer(t *testing.T, fails int32, failStatus int) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= fails {
+			w.WriteHeader(failStatus)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestDo_RetriesIdempotentOnStatus(t *testing.T) {
+	policy, waits := useRetry(t, config.RetryConfig{})
+	srv, calls := flakyServer(t, 2, http.StatusServiceUnavailable)
+
+	status, _, _, err := ProxyRequestTo("profile", "GET", srv.URL, nil, http.Header{})
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Expected 200 after retries, got %d (%v)", status, err)
+	}
+	if calls.Load() != 3 || len(*waits) != 2 {
+		t.Errorf("Expected 3 attempts and 2 waits, got %d and %d", calls.Load(), len(*waits))
+	}
+
+	s := policy.Stats()
+	if s.Attempts != 3 || s.Retries != 2 || s.Recovered != 1 || s.Exhausted != 0 {
+		t.Errorf("Unexpected retry stats %+v", s)
+	}
+}
+
+func TestDo_GivesUpAfterMaxAttempts(t *testing.T) {
+	policy, _ := useRetry(t, config.RetryConfig{MaxAttempts: 2})
+	srv, calls := flakyServer(t, 5, http.StatusBadGateway)
+
+	status, _, _, err := ProxyRequestTo("profile", "GET", srv.URL, nil, http.Header{})
+	if err != nil || status != http.StatusBadGateway {
+		t.Errorf("Expected the last 502, got %d (%v)", status, err)
+	}
+	if calls.Load() != 2 || policy.Stats().Exhausted != 1 {
+		t.Errorf("Expected 2 attempts and exhausted=1, got %d and %+v", calls.Load(), policy.Stats())
+	}
+}
+
+func TestDo_DoesNotRetryUnlistedStatus(t *testing.T) {
+	useRetry(t, config.RetryConfig{})
+	srv, calls := flakyServer(t, 1, http.StatusInternalServerError)
+
+	status, _, _, _ := ProxyRequestTo("profile", "GET", srv.URL, nil, http.Header{})
+	if status != http.StatusInternalServerError || calls.Load() != 1 {
+		t.Errorf("Expected a single attempt with 500, got %d after %d calls", status, calls.Load())
+	}
+}
+
+func TestDo_NonIdempotentNeedsIdempotencyKey(t *testing.T) {
+	useRetry(t, config.RetryConfig{})
+
+	srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable)
+	status, _, _, _ := ProxyRequestTo("profile", "POST", srv.URL, bytes.NewReader([]byte(`{"a":1}`)), http.Header{})
+	if status != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Errorf("Expected POST not to be retried, got %d after %d calls", status, calls.Load())
+	}
+
+	srv, calls = flakyServer(t, 1, http.StatusServiceUnavailable)
+	headers := http.Header{"Idempotency-Key": []string{"abc"}}
+	status, body, _, _ := ProxyRequestTo("profile", "POST", srv.URL, bytes.NewReader([]byte(`{"a":1}`)), headers)
+	if status != http.StatusOK || calls.Load() != 2 {
+		t.Errorf("Expected POST with Idempotency-Key to be retried, got %d after %d calls", status, calls.Load())
+	}
+	if string(body) != `{"a":1}` {
+		t.Errorf("Expected the body to be replayed on retry, got %q", body)
+	}
+}
+
+func TestDo_StreamingBodyIsNotRetried(t *testing.T) {
+	useRetry(t, config.RetryConfig{})
+	srv, calls := flakyServer(t, 1, http.StatusServiceUnavailable)
+
+	// un cuerpo que no se puede volver a leer (sin GetBody)
+	req, _ := http.NewRequest("PUT", srv.URL, io.NopCloser(bytes.NewReader([]byte("x"))))
+	resp, err := Do("profile", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Errorf("Expected a single attempt, got %d after %d calls", resp.StatusCode, calls.Load())
+	}
+}
+
+func TestDo_RetriesConnectionReset(t *testing.T) {
+	policy, _ := useRetry(t, config.RetryConfig{})
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// cortar la conexión sin responder
+			conn, _, _ := http.NewResponseController(w).Hijack()
+			conn.Close()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	status, _, _, err := ProxyRequestTo("profile", "GET", srv.URL, nil, http.Header{})
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("Expected 200 after a reset, got %d (%v)", status, err)
+	}
+	if policy.Stats().Retries != 1 {
+		t.Errorf("Expected 1 retry, got %+v", policy.Stats())
+	}
+}
+
+func TestDo_SharedRetryBudget(t *testing.T) {
+	policy, _ := useRetry(t, config.RetryConfig{MaxAttempts: 5})
+	srv, calls := flakyServer(t, 100, http.StatusServiceUnavailable)
+
+	ctx := WithRetryBudget(context.Background(), 2)
+	ProxyRequestContext(ctx, "profile", "GET", srv.URL, nil, http.Header{})
+	ProxyRequestContext(ctx, "profile", "GET", srv.URL, nil, http.Header{})
+
+	// 2 primeros intentos + 2 reintentos en total, no 5+5
+	if calls.Load() != 4 {
+		t.Errorf("Expected 4 attempts with a budget of 2 retries, got %d", calls.Load())
+	}
+	if s := policy.Stats(); s.Retries != 2 || s.BudgetExhausted != 2 {
+		t.Errorf("Unexpected retry stats %+v", s)
+	}
+}
+
+func TestRetryPolicy_Wait(t *testing.T) {
+	policy := NewRetryPolicy(config.RetryConfig{
+		Backoff:    config.Duration(100 * time.Millisecond),
+		MaxBackoff: config.Duration(time.Second),
+	})
+
+	origJitter := jitter
+	defer func() { jitter = origJitter }()
+
+	jitter = func(n int64) int64 { return n - 1 }
+	expected := []time.Duration{100, 200, 400, 800, 1000}
+	for i, ms := range expected {
+		if got := policy.wait(i+1, nil); got != ms*time.Millisecond {
+			t.Errorf("Expected max wait %v for attempt %d, got %v", ms*time.Millisecond, i+1, got)
+		}
+	}
+
+	jitter = func(n int64) int64 { return 0 }
+	if got := policy.wait(3, nil); got != 200*time.Millisecond {
+		t.Errorf("Expected min wait 200ms for attempt 3, got %v", got)
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": []string{"1"}}}
+	if got := policy.wait(1, resp); got != time.Second {
+		t.Errorf("Expected Retry-After to be honored, got %v", got)
+	}
+	resp.Header.Set("Retry-After", "30")
+	if got := policy.wait(1, resp); got > time.Second {
+		t.Errorf("Expected Retry-After above maxBackoff to be ignored, got %v", got)
+	}
+}
+
+func TestRetryBudgetMiddleware(t *testing.T) {
+	var remaining int64
+	h := RetryBudgetMiddleware(func() int { return 3 })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remaining = budgetFrom(r.Context()).remaining.Load()
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if remaining != 3 {
+		t.Errorf("Expected a budget of 3 retries, got %d", remaining)
+	}
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// errHeaderTimeout: el upstream no mandó los headers a tiempo
+var errHeaderTimeout = fmt.Errorf("timeout awaiting response headers: %w", context.DeadlineExceeded)
+
+// headerTimeout es el RoundTripper del cliente de streaming: en lugar de un
+// timeout total, que cortaría a la mitad una descarga grande o un SSE, solo
+// acota cada intento hasta que llegan los headers. Después el cuerpo dura lo
+// que dure el contexto de la petición.
+type headerTimeout struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (h headerTimeout) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(h.timeout, func() { cancel(errHeaderTimeout) })
+
+	resp, err := h.next.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		// el timer ya cortó (o corta a la vez que llega la respuesta)
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel(nil)
+		return nil, errHeaderTimeout
+	}
+	if err != nil {
+		cancel(nil)
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: func() { cancel(nil) }}
+	return resp, nil
+}
+
+// cancelBody libera el contexto del intento al cerrar el cuerpo
+type cancelBody struct {
+	io.ReadCloser
+	cancel func()
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// DoStream es Do para respuestas que se copian a medida que llegan (rutas de
+// paso directo): usa el cliente de streaming del upstream, sin timeout total.
+// Los upstreams no registrados usan HttpClient, como en Do.
+func DoStream(upstream string, req *http.Request) (*http.Response, error) {
+	up, ok := Upstreams.lookup(upstream)
+	if !ok {
+		return Do(upstream, req)
+	}
+	stream := *up
+	stream.client = up.stream
+	return do(&stream, upstream, req)
+}
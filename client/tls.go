@@ -0,0 +1,122 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"servicio-gateway/certs"
+	"servicio-gateway/config"
+)
+
+// TLSError indica que se llegó al upstream pero el handshake TLS falló
+// (CA desconocida, nombre que no coincide, certificado de cliente rechazado,
+// upstream que no habla TLS...), a diferencia de un error de conexión.
+type TLSError struct {
+	Upstream string
+	Err      error
+}
+
+func (e *TLSError) Error() string {
+	return fmt.Sprintf("tls handshake with %s failed: %v", e.Upstream, e.Err)
+}
+
+func (e *TLSError) Unwrap() error {
+	return e.Err
+}
+
+// upstreamTLS es la configuración TLS base de un upstream más los archivos
+// que la respaldan (CA y certificado de cliente), para recargarlos
+type upstreamTLS struct {
+	base    *tls.Config
+	ca      *certs.CAPool
+	keyPair *certs.KeyPair
+}
+
+func newUpstreamTLS(name string, cfg config.UpstreamTLSConfig) (*upstreamTLS, error) {
+	u := &upstreamTLS{
+		base: &tls.Config{
+			MinVersion:         tls.VersionTLS12,
+			ServerName:         cfg.ServerName,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		},
+	}
+	if cfg.MinVersion == "1.3" {
+		u.base.MinVersion = tls.VersionTLS13
+	}
+	if cfg.InsecureSkipVerify {
+		log.Printf("[WARN] upstream %s: tls insecureSkipVerify habilitado, usar solo en desarrollo\n", name)
+	}
+
+	var err error
+	if cfg.CAFile != "" {
+		if u.ca, err = certs.LoadCAPool(cfg.CAFile); err != nil {
+			return nil, fmt.Errorf("upstream %s: %w", name, err)
+		}
+	}
+	if cfg.CertFile != "" {
+		if u.keyPair, err = certs.LoadKeyPair(cfg.CertFile, cfg.KeyFile); err != nil {
+			return nil, fmt.Errorf("upstream %s: %w", name, err)
+		}
+		u.base.GetClientCertificate = u.keyPair.GetClientCertificate
+	}
+	return u, nil
+}
+
+// config devuelve una copia de la configuración con el bundle de CAs vigente
+func (u *upstreamTLS) config() *tls.Config {
+	c := u.base.Clone()
+	if u.ca != nil {
+		c.RootCAs = u.ca.Pool()
+	}
+	return c
+}
+
+// reload relee los archivos; caChanged indica que hay que rearmar el transport
+func (u *upstreamTLS) reload() (changed, caChanged bool, err error) {
+	var errs []error
+	if u.keyPair != nil {
+		c, err := u.keyPair.ReloadIfChanged()
+		changed = changed || c
+		errs = append(errs, err)
+	}
+	if u.ca != nil {
+		c, err := u.ca.ReloadIfChanged()
+		changed, caChanged = changed || c, c
+		errs = append(errs, err)
+	}
+	return changed, caChanged, errors.Join(errs...)
+}
+
+// hasFiles indica si hay algo que vigilar
+func (u *upstreamTLS) hasFiles() bool {
+	return u.ca != nil || u.keyPair != nil
+}
+
+// classifyError envuelve en TLSError los fallos de handshake
+func classifyError(upstream string, err error) error {
+	if err == nil {
+		return err
+	}
+
+	var (
+		verifyErr    *tls.CertificateVerificationError
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		opErr        *net.OpError
+	)
+	if errors.As(err, &verifyErr) || errors.As(err, &recordErr) || errors.As(err, &alertErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) ||
+		// las alertas del otro extremo (p.ej. certificado de cliente rechazado)
+		// llegan como un *net.OpError con Op "remote error"
+		(errors.As(err, &opErr) && opErr.Op == "remote error") {
+		return &TLSError{Upstream: upstream, Err: err}
+	}
+	return err
+}
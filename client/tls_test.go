@@ -0,0 +1,135 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"servicio-gateway/config"
+	"servicio-gateway/internal/testcerts"
+)
+
+// tlsUpstream levanta un upstream https con un certificado firmado por ca
+// para hosts (vacío = localhost y 127.0.0.1)
+func tlsUpstream(t *testing.T, ca *testcerts.Cert, clientCAs *x509.CertPool, hosts ...string) *httptest.Server {
+	leaf := testcerts.New(t, "upstream", ca, hosts...)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{leaf.TLSCertificate()}}
+	if clientCAs != nil {
+		srv.TLS.ClientCAs = clientCAs
+		srv.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func useTransport(t *testing.T, cfg config.UpstreamTLSConfig) *Transport {
+	transport, err := NewTransport("security", config.UpstreamConfig{TLS: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Upstreams.Register("security", transport, nil, nil)
+	t.Cleanup(func() { Upstreams = NewRegistry() })
+	return transport
+}
+
+func TestProxyRequestTo_CustomCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcerts.New(t, "ca", nil)
+	caFile, _ := ca.Write(t, dir, "ca")
+	srv := tlsUpstream(t, ca, nil)
+
+	// Sin la CA el certificado del upstream no se puede verificar
+	useTransport(t, config.UpstreamTLSConfig{})
+	_, _, _, err := ProxyRequestTo("security", "GET", srv.URL, nil, http.Header{})
+	var tlsErr *TLSError
+	if !errors.As(err, &tlsErr) {
+		t.Fatalf("Expected TLSError for unknown CA, got %v", err)
+	}
+
+	useTransport(t, config.UpstreamTLSConfig{CAFile: caFile})
+	status, _, _, err := ProxyRequestTo("security", "GET", srv.URL, nil, http.Header{})
+	if err != nil || status != http.StatusOK {
+		t.Errorf("Expected 200 with the custom CA, got %d (%v)", status, err)
+	}
+}
+
+func TestProxyRequestTo_ServerNameOverride(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcerts.New(t, "ca", nil)
+	caFile, _ := ca.Write(t, dir, "ca")
+	srv := tlsUpstream(t, ca, nil, "security.internal")
+
+	useTransport(t, config.UpstreamTLSConfig{CAFile: caFile})
+	if _, _, _, err := ProxyRequestTo("security", "GET", srv.URL, nil, http.Header{}); err == nil {
+		t.Error("Expected hostname mismatch without serverName")
+	}
+
+	useTransport(t, config.UpstreamTLSConfig{CAFile: caFile, ServerName: "security.internal"})
+	if _, _, _, err := ProxyRequestTo("security", "GET", srv.URL, nil, http.Header{}); err != nil {
+		t.Errorf("Expected serverName override to verify, got %v", err)
+	}
+}
+
+func TestProxyRequestTo_ClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := testcerts.New(t, "ca", nil)
+	caFile, _ := ca.Write(t, dir, "ca")
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	srv := tlsUpstream(t, ca, pool)
+
+	useTransport(t, config.UpstreamTLSConfig{CAFile: caFile})
+	_, _, _, err := ProxyRequestTo("security", "GET", srv.URL, nil, http.Header{})
+	var tlsErr *TLSError
+	if !errors.As(err, &tlsErr) {
+		t.Fatalf("Expected TLSError when the upstream requires a client cert, got %v", err)
+	}
+
+	certFile, keyFile := testcerts.New(t, "gateway", ca).Write(t, dir, "client")
+	useTransport(t, config.UpstreamTLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile})
+	if status, _, _, err := ProxyRequestTo("security", "GET", srv.URL, nil, http.Header{}); err != nil || status != http.StatusOK {
+		t.Errorf("Expected 200 with client certificate, got %d (%v)", status, err)
+	}
+}
+
+func TestTransport_ReloadsCA(t *testing.T) {
+	dir := t.TempDir()
+	oldCA := testcerts.New(t, "old-ca", nil)
+	newCA := testcerts.New(t, "new-ca", nil)
+	caFile, _ := oldCA.Write(t, dir, "ca")
+	srv := tlsUpstream(t, newCA, nil)
+
+	transport := useTransport(t, config.UpstreamTLSConfig{CAFile: caFile})
+	if _, _, _, err := ProxyRequestTo("security", "GET", srv.URL, nil, http.Header{}); err == nil {
+		t.Fatal("Expected failure before the CA bundle is rotated")
+	}
+
+	newCA.Write(t, dir, "ca")
+	later := time.Now().Add(time.Second)
+	os.Chtimes(caFile, later, later)
+	if changed, err := transport.ReloadIfChanged(); !changed || err != nil {
+		t.Fatalf("Expected CA reload, got %v (%v)", changed, err)
+	}
+	if _, _, _, err := ProxyRequestTo("security", "GET", srv.URL, nil, http.Header{}); err != nil {
+		t.Errorf("Expected success after reload, got %v", err)
+	}
+}
+
+func TestProxyRequestTo_ConnectionErrorIsNotTLS(t *testing.T) {
+	useTransport(t, config.UpstreamTLSConfig{InsecureSkipVerify: true})
+
+	_, _, _, err := ProxyRequestTo("security", "GET", "https://127.0.0.1:1/", nil, http.Header{})
+	var tlsErr *TLSError
+	if err == nil || errors.As(err, &tlsErr) {
+		t.Errorf("Expected a plain connection error, got %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+// Valores por defecto de TransportConfig (campos en cero)
+const (
+	defaultTimeout             = 10 * time.Second
+	defaultMaxIdleConns        = 100
+	defaultMaxIdleConnsPerHost = 10
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 5 * time.Second
+	defaultTLSHandshakeTimeout = 5 * time.Second
+	defaultKeepAlive           = 30 * time.Second
+)
+
+// withDefaults completa los campos en cero de cfg
+func withDefaults(cfg config.TransportConfig) config.TransportConfig {
+	setDuration := func(d *config.Duration, def time.Duration) {
+		if *d == 0 {
+			*d = config.Duration(def)
+		}
+	}
+	setDuration(&cfg.Timeout, defaultTimeout)
+	setDuration(&cfg.IdleConnTimeout, defaultIdleConnTimeout)
+	setDuration(&cfg.DialTimeout, defaultDialTimeout)
+	setDuration(&cfg.TLSHandshakeTimeout, defaultTLSHandshakeTimeout)
+	setDuration(&cfg.KeepAlive, defaultKeepAlive)
+	if cfg.MaxIdleConns == 0 {
+		cfg.MaxIdleConns = defaultMaxIdleConns
+	}
+	if cfg.MaxIdleConnsPerHost == 0 {
+		cfg.MaxIdleConnsPerHost = defaultMaxIdleConnsPerHost
+	}
+	if cfg.HTTP2 == nil {
+		enabled := true
+		cfg.HTTP2 = &enabled
+	}
+	return cfg
+}
+
+// Transport es el RoundTripper propio de un upstream: pool de conexiones y
+// timeouts según su TransportConfig, TLS propio y contadores del pool.
+// Cuando cambia el bundle de CAs se arma un http.Transport nuevo (las
+// conexiones del anterior se cierran al quedar ociosas); el certificado de
+// cliente se toma del vigente en cada handshake.
+type Transport struct {
+	name  string
+	cfg   config.TransportConfig
+	tls   *upstreamTLS
+	stats poolCounters
+
+	current atomic.Pointer[http.Transport]
+}
+
+// poolCounters se actualizan en cada dial/petición
+type poolCounters struct {
+	openConns   atomic.Int64
+	connsOpened atomic.Int64
+	dialErrors  atomic.Int64
+	connsReused atomic.Int64
+	requests    atomic.Int64
+	inFlight    atomic.Int64
+}
+
+// NewTransport arma el Transport del upstream name según cfg
+func NewTransport(name string, cfg config.UpstreamConfig) (*Transport, error) {
+	upTLS, err := newUpstreamTLS(name, cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	t := &Transport{name: name, cfg: withDefaults(cfg.Transport), tls: upTLS}
+	t.rebuild()
+	return t, nil
+}
+
+func (t *Transport) rebuild() {
+	dialer := &net.Dialer{Timeout: t.cfg.DialTimeout.Std(), KeepAlive: t.cfg.KeepAlive.Std()}
+	ht := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           t.dialContext(dialer),
+		ForceAttemptHTTP2:     *t.cfg.HTTP2,
+		MaxIdleConns:          t.cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   t.cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       t.cfg.MaxConnsPerHost,
+		IdleConnTimeout:       t.cfg.IdleConnTimeout.Std(),
+		TLSHandshakeTimeout:   t.cfg.TLSHandshakeTimeout.Std(),
+		ResponseHeaderTimeout: t.cfg.ResponseHeaderTimeout.Std(),
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       t.tls.config(),
+	}
+	if !*t.cfg.HTTP2 {
+		// Un TLSNextProto vacío (no nil) deshabilita HTTP/2
+		ht.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	if old := t.current.Swap(ht); old != nil {
+		old.CloseIdleConnections()
+	}
+}
+
+// dialContext cuenta las conexiones TCP abiertas del pool
+func (t *Transport) dialContext(d *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := d.DialContext(ctx, network, addr)
+		if err != nil {
+			t.stats.dialErrors.Add(1)
+			return nil, err
+		}
+		t.stats.connsOpened.Add(1)
+		t.stats.openConns.Add(1)
+		return &countedConn{Conn: conn, open: &t.stats.openConns}, nil
+	}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.stats.requests.Add(1)
+	t.stats.inFlight.Add(1)
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				t.stats.connsReused.Add(1)
+			}
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	resp, err := t.current.Load().RoundTrip(req)
+	if err != nil {
+		t.stats.inFlight.Add(-1)
+		return nil, err
+	}
+	// La petición sigue en curso hasta que se cierra el cuerpo de la respuesta
+	resp.Body = &countedBody{ReadCloser: resp.Body, inFlight: &t.stats.inFlight}
+	return resp, nil
+}
+
+// CloseIdleConnections lo usa http.Client.CloseIdleConnections
+func (t *Transport) CloseIdleConnections() {
+	t.current.Load().CloseIdleConnections()
+}
+
+// Timeout es el timeout total configurado para las llamadas a este upstream
+func (t *Transport) Timeout() time.Duration {
+	return t.cfg.Timeout.Std()
+}
+
+// HeaderTimeout es cuánto se espera a los headers de una respuesta en
+// streaming: ResponseHeaderTimeout o, si no hay, el timeout total
+func (t *Transport) HeaderTimeout() time.Duration {
+	if t.cfg.ResponseHeaderTimeout > 0 {
+		return t.cfg.ResponseHeaderTimeout.Std()
+	}
+	return t.cfg.Timeout.Std()
+}
+
+// Stats devuelve los contadores actuales del pool
+func (t *Transport) Stats() PoolStats {
+	open, inFlight := t.stats.openConns.Load(), t.stats.inFlight.Load()
+	// Aproximado: con HTTP/2 varias peticiones comparten una conexión
+	idle := open - inFlight
+	if idle < 0 {
+		idle = 0
+	}
+	return PoolStats{
+		Upstream:    t.name,
+		OpenConns:   open,
+		IdleConns:   idle,
+		InFlight:    inFlight,
+		Requests:    t.stats.requests.Load(),
+		ConnsOpened: t.stats.connsOpened.Load(),
+		ConnsReused: t.stats.connsReused.Load(),
+		DialErrors:  t.stats.dialErrors.Load(),
+		Limits:      t.cfg,
+	}
+}
+
+// ReloadIfChanged relee CA y certificado de cliente (ver certs.Reloadable)
+func (t *Transport) ReloadIfChanged() (bool, error) {
+	changed, caChanged, err := t.tls.reload()
+	if caChanged {
+		t.rebuild()
+	}
+	return changed, err
+}
+
+func (t *Transport) String() string {
+	return "upstream " + t.name + " tls"
+}
+
+// countedConn descuenta la conexión al cerrarse (una sola vez)
+type countedConn struct {
+	net.Conn
+	open *atomic.Int64
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+// countedBody marca el fin de la petición al cerrar el cuerpo
+type countedBody struct {
+	io.ReadCloser
+	inFlight *atomic.Int64
+	once     sync.Once
+}
+
+func (b *countedBody) Close() error {
+	b.once.Do(func() { b.inFlight.Add(-1) })
+	return b.ReadCloser.Close()
+}
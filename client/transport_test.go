@@ -0,0 +1,150 @@
+package client
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+func TestNewTransport_Defaults(t *testing.T) {
+	transport, err := NewTransport("profile", config.UpstreamConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ht := transport.current.Load()
+	if ht.MaxIdleConns != 100 || ht.MaxIdleConnsPerHost != 10 {
+		t.Errorf("Expected default idle limits 100/10, got %d/%d", ht.MaxIdleConns, ht.MaxIdleConnsPerHost)
+	}
+	if ht.IdleConnTimeout != 90*time.Second || ht.TLSHandshakeTimeout != 5*time.Second {
+		t.Errorf("Expected default timeouts, got idle=%v handshake=%v", ht.IdleConnTimeout, ht.TLSHandshakeTimeout)
+	}
+	if !ht.ForceAttemptHTTP2 || ht.TLSNextProto != nil {
+		t.Error("Expected HTTP/2 enabled by default")
+	}
+	if transport.Timeout() != 10*time.Second {
+		t.Errorf("Expected default timeout 10s, got %v", transport.Timeout())
+	}
+}
+
+func TestNewTransport_Limits(t *testing.T) {
+	disabled := false
+	transport, err := NewTransport("profile", config.UpstreamConfig{Transport: config.TransportConfig{
+		Timeout:               config.Duration(2 * time.Second),
+		MaxIdleConnsPerHost:   32,
+		MaxConnsPerHost:       64,
+		ResponseHeaderTimeout: config.Duration(time.Second),
+		HTTP2:                 &disabled,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ht := transport.current.Load()
+	if ht.MaxIdleConnsPerHost != 32 || ht.MaxConnsPerHost != 64 || ht.ResponseHeaderTimeout != time.Second {
+		t.Errorf("Expected configured limits, got idle=%d max=%d header=%v",
+			ht.MaxIdleConnsPerHost, ht.MaxConnsPerHost, ht.ResponseHeaderTimeout)
+	}
+	if ht.ForceAttemptHTTP2 || ht.TLSNextProto == nil {
+		t.Error("Expected HTTP/2 disabled")
+	}
+
+	Upstreams.Register("profile", transport, nil, nil)
+	t.Cleanup(func() { Upstreams = NewRegistry() })
+	if For("profile").Timeout != 2*time.Second {
+		t.Errorf("Expected client timeout 2s, got %v", For("profile").Timeout)
+	}
+}
+
+func TestTransport_StatsCountReusedConnections(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	defer srv.Close()
+
+	transport, err := NewTransport("profile", config.UpstreamConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Upstreams.Register("profile", transport, nil, nil)
+	t.Cleanup(func() { Upstreams = NewRegistry() })
+
+	for i := 0; i < 3; i++ {
+		if _, _, _, err := ProxyRequestTo("profile", "GET", srv.URL, nil, http.Header{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := Upstreams.Stats()
+	if len(stats) != 1 || stats[0].Upstream != "profile" {
+		t.Fatalf("Expected stats for profile, got %+v", stats)
+	}
+	s := stats[0]
+	if s.Requests != 3 || s.ConnsOpened != 1 || s.ConnsReused != 2 {
+		t.Errorf("Expected 3 requests over 1 reused connection, got %+v", s)
+	}
+	if s.InFlight != 0 || s.OpenConns != 1 || s.IdleConns != 1 {
+		t.Errorf("Expected 1 idle connection and nothing in flight, got %+v", s)
+	}
+
+	transport.CloseIdleConnections()
+	if s := transport.Stats(); s.OpenConns != 0 {
+		t.Errorf("Expected no open connections after closing idle ones, got %d", s.OpenConns)
+	}
+}
+
+func TestTransport_DialErrors(t *testing.T) {
+	transport, err := NewTransport("eventbus", config.UpstreamConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	Upstreams.Register("eventbus", transport, nil, nil)
+	t.Cleanup(func() { Upstreams = NewRegistry() })
+
+	if _, _, _, err := ProxyRequestTo("eventbus", "GET", "http://127.0.0.1:1/", nil, http.Header{}); err == nil {
+		t.Fatal("Expected connection error")
+	}
+	if s := transport.Stats(); s.DialErrors != 1 || s.InFlight != 0 {
+		t.Errorf("Expected 1 dial error and nothing in flight, got %+v", s)
+	}
+}
+
+func TestRegistry_ConfigureRebuildsOnlyChangedUpstreams(t *testing.T) {
+	g := NewRegistry()
+	cfg := config.Config{Upstreams: map[string]config.UpstreamConfig{
+		"security": {Transport: config.TransportConfig{Timeout: config.Duration(time.Second)}},
+	}}
+	if err := g.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	security, _ := g.lookup("security")
+	profile, _ := g.lookup("profile")
+
+	cfg.Upstreams = map[string]config.UpstreamConfig{
+		"security": {Transport: config.TransportConfig{Timeout: config.Duration(time.Second)}},
+		"profile":  {Transport: config.TransportConfig{Timeout: config.Duration(3 * time.Second)}},
+	}
+	if err := g.Configure(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if up, _ := g.lookup("security"); up != security {
+		t.Error("Expected the unchanged security upstream to keep its client")
+	}
+	if up, _ := g.lookup("profile"); up == profile || up.client.Timeout != 3*time.Second {
+		t.Errorf("Expected profile to be rebuilt with the new timeout, got %v", up.client.Timeout)
+	}
+
+	// un upstream que no se puede armar deja todo como estaba
+	cfg.Upstreams["security"] = config.UpstreamConfig{TLS: config.UpstreamTLSConfig{CAFile: "/nonexistent/ca.pem"}}
+	cfg.Upstreams["profile"] = config.UpstreamConfig{}
+	before, _ := g.lookup("profile")
+	if err := g.Configure(cfg); err == nil {
+		t.Fatal("Expected an error for a missing CA file")
+	}
+	if up, _ := g.lookup("profile"); up != before {
+		t.Error("Expected no upstream to be replaced when one fails to build")
+	}
+}
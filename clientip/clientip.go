@@ -0,0 +1,133 @@
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ---------------------------------------------------------
+// IP real del cliente detrás de proxies confiables
+// ---------------------------------------------------------
+
+// Resolver decide qué IP es la del cliente. Solo se cree a X-Forwarded-For
+// cuando la petición llega desde un proxy de la lista de confiables.
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// NewResolver acepta IPs sueltas o rangos CIDR
+func NewResolver(proxies []string) (*Resolver, error) {
+	rs := &Resolver{}
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", p)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			rs.trusted = append(rs.trusted, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		rs.trusted = append(rs.trusted, n)
+	}
+	return rs, nil
+}
+
+// Trusted indica si ip pertenece a un proxy confiable
+func (rs *Resolver) Trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if rs == nil || parsed == nil {
+		return false
+	}
+	for _, n := range rs.trusted {
+		if n.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// FromTrustedProxy indica si la conexión viene de un proxy confiable, es
+// decir si los X-Forwarded-* / Forwarded recibidos se pueden conservar
+func (rs *Resolver) FromTrustedProxy(r *http.Request) bool {
+	return rs.Trusted(PeerIP(r))
+}
+
+// ClientIP recorre X-Forwarded-For de derecha a izquierda saltando proxies
+// confiables; la primera IP no confiable es el cliente. Si la conexión no
+// viene de un proxy confiable el cliente es el propio peer.
+func (rs *Resolver) ClientIP(r *http.Request) string {
+	peer := PeerIP(r)
+	if !rs.Trusted(peer) {
+		return peer
+	}
+
+	hops := forwardedFor(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		if !rs.Trusted(hops[i]) {
+			return hops[i]
+		}
+	}
+	if len(hops) > 0 {
+		return hops[0]
+	}
+	return peer
+}
+
+// PeerIP es la IP del otro extremo de la conexión (sin puerto)
+func PeerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func forwardedFor(h http.Header) []string {
+	var out []string
+	for _, v := range h.Values("X-Forwarded-For") {
+		for _, ip := range strings.Split(v, ",") {
+			if ip = strings.TrimSpace(ip); net.ParseIP(ip) != nil {
+				out = append(out, ip)
+			}
+		}
+	}
+	return out
+}
+
+type contextKey struct{}
+
+// WithIP devuelve un contexto que lleva la IP resuelta del cliente
+func WithIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// FromRequest devuelve la IP guardada por Middleware o, si no pasó por él, el peer
+func FromRequest(r *http.Request) string {
+	if ip, ok := r.Context().Value(contextKey{}).(string); ok {
+		return ip
+	}
+	return PeerIP(r)
+}
+
+// Middleware resuelve la IP una vez por petición para logging, rate limiting, etc.
+// resolver se consulta en cada petición para seguir las recargas de configuración.
+func Middleware(resolver func() *Resolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := resolver().ClientIP(r)
+			next.ServeHTTP(w, r.WithContext(WithIP(r.Context(), ip)))
+		})
+	}
+}
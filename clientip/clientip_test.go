@@ -0,0 +1,58 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	rs, err := NewResolver([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name, remote, xff, want string
+	}{
+		{"direct client", "203.0.113.9:5000", "", "203.0.113.9"},
+		{"untrusted peer cannot spoof", "203.0.113.9:5000", "1.1.1.1", "203.0.113.9"},
+		{"trusted proxy", "10.0.0.2:80", "198.51.100.7", "198.51.100.7"},
+		{"chain of trusted proxies", "10.0.0.2:80", "198.51.100.7, 192.168.1.1, 10.1.1.1", "198.51.100.7"},
+		{"spoofed left entry ignored", "10.0.0.2:80", "6.6.6.6, 198.51.100.7", "198.51.100.7"},
+		{"trusted without header", "10.0.0.2:80", "", "10.0.0.2"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = c.remote
+		if c.xff != "" {
+			req.Header.Set("X-Forwarded-For", c.xff)
+		}
+		if got := rs.ClientIP(req); got != c.want {
+			t.Errorf("%s: expected %s, got %s", c.name, c.want, got)
+		}
+	}
+}
+
+func TestNewResolver_RejectsInvalid(t *testing.T) {
+	if _, err := NewResolver([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected error for invalid proxy")
+	}
+}
+
+func TestMiddleware_StoresIP(t *testing.T) {
+	rs, _ := NewResolver([]string{"10.0.0.0/8"})
+	var got string
+	h := Middleware(func() *Resolver { return rs })(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = FromRequest(r)
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.5:1234"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	if got != "198.51.100.7" {
+		t.Errorf("Expected '198.51.100.7', got '%s'", got)
+	}
+}
@@ -0,0 +1,148 @@
+package compensation
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------
+// Journal de compensaciones fallidas
+// ---------------------------------------------------------
+
+// Entry es una compensación que no se pudo aplicar: el upstream quedó con
+// un cambio que el resto de la operación no tiene y hay que repararlo.
+// Method/URL/Body son la llamada que lo habría deshecho.
+type Entry struct {
+	ID        string          `json:"id"`
+	Time      time.Time       `json:"time"`
+	Operation string          `json:"operation"`
+	Service   string          `json:"service"`
+	Method    string          `json:"method"`
+	URL       string          `json:"url"`
+	Body      json.RawMessage `json:"body"`
+	// Unrestorable: campos cambiados que no estaban en el snapshot (p.ej. password)
+	Unrestorable []string `json:"unrestorable,omitempty"`
+	Attempts     int      `json:"attempts"`
+	Error        string   `json:"error"`
+}
+
+// Journal guarda las compensaciones pendientes de reparar
+type Journal interface {
+	// Record guarda e (completando ID y Time si faltan) y la devuelve
+	Record(e Entry) (Entry, error)
+	// Entries devuelve todas las entradas, de la más vieja a la más nueva
+	Entries() ([]Entry, error)
+}
+
+func fill(e Entry) Entry {
+	if e.ID == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		e.ID = hex.EncodeToString(b)
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	return e
+}
+
+// MemoryJournal es un Journal en memoria (se pierde al reiniciar)
+type MemoryJournal struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{}
+}
+
+func (j *MemoryJournal) Record(e Entry) (Entry, error) {
+	e = fill(e)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, e)
+	return e, nil
+}
+
+func (j *MemoryJournal) Entries() ([]Entry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]Entry(nil), j.entries...), nil
+}
+
+// FileJournal agrega cada entrada como una línea JSON y hace fsync antes
+// de confirmarla, para que sobreviva a una caída del gateway
+type FileJournal struct {
+	path string
+	mu   sync.Mutex
+}
+
+// OpenFileJournal usa path (se crea al registrar la primera entrada)
+func OpenFileJournal(path string) (*FileJournal, error) {
+	j := &FileJournal{path: path}
+	// validar que lo que haya se puede leer
+	if _, err := j.Entries(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *FileJournal) Record(e Entry) (Entry, error) {
+	e = fill(e)
+	line, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	f, err := os.OpenFile(j.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return e, err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return e, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return e, err
+	}
+	return e, f.Close()
+}
+
+func (j *FileJournal) Entries() ([]Entry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.Open(j.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var out []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,50 @@
+package compensation
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileJournal_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "compensations.jsonl")
+
+	j, err := OpenFileJournal(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	first, err := j.Record(Entry{Service: "security", Method: "PUT", URL: "http://security/users/42",
+		Body: json.RawMessage(`{"email":"old@example.com"}`), Attempts: 3, Error: "connection refused"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if first.ID == "" || first.Time.IsZero() {
+		t.Errorf("Expected ID and Time to be filled, got %+v", first)
+	}
+	j.Record(Entry{Service: "profile", Unrestorable: []string{"password"}})
+
+	reopened, err := OpenFileJournal(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	entries, err := reopened.Entries()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d (%v)", len(entries), err)
+	}
+	if entries[0].ID != first.ID || string(entries[0].Body) != `{"email":"old@example.com"}` {
+		t.Errorf("Expected the first entry to be persisted, got %+v", entries[0])
+	}
+	if len(entries[1].Unrestorable) != 1 {
+		t.Errorf("Expected unrestorable fields to be persisted, got %+v", entries[1])
+	}
+}
+
+func TestOpenFileJournal_Missing(t *testing.T) {
+	j, err := OpenFileJournal(filepath.Join(t.TempDir(), "none.jsonl"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if entries, _ := j.Entries(); len(entries) != 0 {
+		t.Errorf("Expected no entries, got %d", len(entries))
+	}
+}
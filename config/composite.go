@@ -0,0 +1,298 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// CompositeUserConfig define cómo se arma el usuario compuesto de
+// GET/PUT /users/{id}: de qué upstreams sale y qué campo vive en cuál
+type CompositeUserConfig struct {
+	// Sources: upstreams que componen el usuario. El primero es el principal:
+	// si no responde no hay usuario; ante claves repetidas gana el primero.
+	Sources []CompositeSource `json:"sources" yaml:"sources"`
+	// Fields: campo del gateway (ruta con puntos, p.ej. "profile.address.city")
+	// → upstream dueño y nombre allí. Los campos que no están acá se rechazan en PUT.
+	Fields map[string]FieldRoute `json:"fields" yaml:"fields"`
+	// Merge: forma por defecto de la respuesta, flat (un solo objeto con los
+	// campos del esquema) o nested (una sección por fuente); se puede elegir
+	// por petición (?merge= o Accept: application/json;profile=...)
+	Merge string `json:"merge" yaml:"merge"`
+	// List: listado enriquecido de GET /users?include=...
+	List CompositeListConfig `json:"list" yaml:"list"`
+}
+
+// CompositeListConfig configura GET /users?include=profile: el listado
+// paginado de la fuente principal con cada item unido a las demás fuentes
+type CompositeListConfig struct {
+	// Path del listado en la fuente principal (/api/v1/users)
+	Path string `json:"path" yaml:"path"`
+	// ItemsField: campo del cuerpo con los items; vacío = el cuerpo es un
+	// array o el primero de data, items, content, users, results
+	ItemsField string `json:"itemsField" yaml:"itemsField"`
+	// IDField: campo de cada item con el id del usuario (id)
+	IDField string `json:"idField" yaml:"idField"`
+	// Concurrency: llamadas a cada fuente en curso a la vez (8)
+	Concurrency int `json:"concurrency" yaml:"concurrency"`
+	// BatchSize: ids por llamada a BulkPath (50)
+	BatchSize int `json:"batchSize" yaml:"batchSize"`
+	// ItemFailure: partial (por defecto) deja el item sin esa fuente y lo
+	// marca en su _meta; fail responde error si falla cualquier item
+	ItemFailure string `json:"itemFailure" yaml:"itemFailure"`
+}
+
+// Manejo de un item del listado cuya fuente falla
+const (
+	ItemFailurePartial = "partial"
+	ItemFailureFail    = "fail"
+)
+
+// Formas de la respuesta del usuario compuesto
+const (
+	MergeFlat   = "flat"
+	MergeNested = "nested"
+)
+
+// CompositeSource es uno de los upstreams del usuario compuesto
+type CompositeSource struct {
+	// Service: nombre del upstream (el de upstreams.<nombre>, headers y logs)
+	Service string `json:"service" yaml:"service"`
+	// URL base; vacía = la del servicio (securityURL / profileURL)
+	URL string `json:"url" yaml:"url"`
+	// Path del recurso con {id}, p.ej. /api/v1/profiles/{id}
+	Path string `json:"path" yaml:"path"`
+	// Optional: con compositeDegradation partial, si falla se responde sin él
+	Optional bool `json:"optional" yaml:"optional"`
+	// Section: clave de su documento con merge nested (vacía = Service)
+	Section string `json:"section" yaml:"section"`
+	// BulkPath: recurso con {ids} (separados por coma) para traer varios en
+	// una llamada en el listado; vacío = uno por uno con Path
+	BulkPath string `json:"bulkPath" yaml:"bulkPath"`
+	// BulkIDField: campo de cada documento de BulkPath con el id del usuario (id)
+	BulkIDField string `json:"bulkIdField" yaml:"bulkIdField"`
+}
+
+// SectionName devuelve la clave de la fuente en la respuesta nested
+func (s CompositeSource) SectionName() string {
+	if s.Section != "" {
+		return s.Section
+	}
+	return s.Service
+}
+
+// FieldRoute dice dónde vive un campo del usuario compuesto
+type FieldRoute struct {
+	Service string `json:"service" yaml:"service"`
+	// Field: ruta con puntos en el JSON del upstream; vacío = la misma del gateway
+	Field string `json:"field" yaml:"field"`
+	// ReadOnly: se devuelve en GET pero no se acepta en PUT (id, createdAt, ...).
+	// El id (list.idField) se acepta si coincide con el de la URL.
+	ReadOnly bool `json:"readOnly" yaml:"readOnly"`
+	// From: fuentes de las que se lee en GET flat, en orden de preferencia
+	// (el primero que lo tenga, con el mismo nombre en el upstream); vacío = Service
+	From []string `json:"from" yaml:"from"`
+}
+
+// ReadFrom devuelve las fuentes de las que se lee el campo
+func (f FieldRoute) ReadFrom() []string {
+	if len(f.From) > 0 {
+		return f.From
+	}
+	return []string{f.Service}
+}
+
+// UpstreamField devuelve el nombre del campo en el upstream
+func (f FieldRoute) UpstreamField(path string) string {
+	if f.Field != "" {
+		return f.Field
+	}
+	return path
+}
+
+// defaultCompositeUser es el reparto histórico entre security y profile
+func defaultCompositeUser() CompositeUserConfig {
+	return CompositeUserConfig{
+		Sources: []CompositeSource{
+			{Service: "security", Path: "/api/v1/users/{id}", Section: "account"},
+			{Service: "profile", Path: "/api/v1/profiles/{id}", Optional: true, Section: "profile"},
+		},
+		Fields: map[string]FieldRoute{
+			"id":        {Service: "security", ReadOnly: true},
+			"createdAt": {Service: "security", ReadOnly: true},
+			"updatedAt": {Service: "security", ReadOnly: true},
+			"email":     {Service: "security"},
+			"username":  {Service: "security"},
+			"password":  {Service: "security"},
+			"firstName": {Service: "profile"},
+			"lastName":  {Service: "profile"},
+			"bio":       {Service: "profile"},
+			"avatar":    {Service: "profile"},
+			"address":   {Service: "profile"},
+			"phone":     {Service: "profile"},
+		},
+		Merge: MergeFlat,
+		List: CompositeListConfig{
+			Path:        "/api/v1/users",
+			IDField:     "id",
+			Concurrency: 8,
+			BatchSize:   50,
+			ItemFailure: ItemFailurePartial,
+		},
+	}
+}
+
+// SourceURL devuelve la URL del recurso id en el upstream de s
+func (c Config) SourceURL(s CompositeSource, id string) string {
+	return c.sourceBase(s) + strings.Replace(s.Path, "{id}", url.PathEscape(id), 1)
+}
+
+// SourceBulkURL devuelve la URL de BulkPath para ids
+func (c Config) SourceBulkURL(s CompositeSource, ids []string) string {
+	escaped := make([]string, len(ids))
+	for i, id := range ids {
+		escaped[i] = url.QueryEscape(id)
+	}
+	return c.sourceBase(s) + strings.Replace(s.BulkPath, "{ids}", strings.Join(escaped, ","), 1)
+}
+
+// ListURL devuelve la URL del listado en la fuente principal
+func (c Config) ListURL() string {
+	return c.sourceBase(c.CompositeUser.Sources[0]) + c.CompositeUser.List.Path
+}
+
+func (c Config) sourceBase(s CompositeSource) string {
+	base := s.URL
+	if base == "" {
+		base, _ = c.ServiceURL(s.Service)
+	}
+	return strings.TrimRight(base, "/")
+}
+
+// validate revisa fuentes y campos; c ya tiene los defaults aplicados
+func (c CompositeUserConfig) validate(cfg Config) []error {
+	var errs []error
+
+	sources, sections := map[string]bool{}, map[string]bool{}
+	for i, s := range c.Sources {
+		prefix := fmt.Sprintf("compositeUser.sources[%d]", i)
+		switch {
+		case s.Service == "":
+			errs = append(errs, fmt.Errorf("%s.service is required", prefix))
+		case sources[s.Service]:
+			errs = append(errs, fmt.Errorf("%s: service %q is listed twice", prefix, s.Service))
+		}
+		sources[s.Service] = true
+		if sections[s.SectionName()] {
+			errs = append(errs, fmt.Errorf("%s: section %q is used twice", prefix, s.SectionName()))
+		}
+		sections[s.SectionName()] = true
+
+		if !strings.Contains(s.Path, "{id}") {
+			errs = append(errs, fmt.Errorf("%s.path: %q must contain {id}", prefix, s.Path))
+		}
+		if s.BulkPath != "" && !strings.Contains(s.BulkPath, "{ids}") {
+			errs = append(errs, fmt.Errorf("%s.bulkPath: %q must contain {ids}", prefix, s.BulkPath))
+		}
+		if s.URL == "" {
+			if _, ok := cfg.ServiceURL(s.Service); !ok {
+				errs = append(errs, fmt.Errorf("%s.url is required for service %q", prefix, s.Service))
+			}
+		} else if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s.url: %q is not an absolute http(s) URL", prefix, s.URL))
+		}
+	}
+	if len(c.Sources) == 0 {
+		errs = append(errs, errors.New("compositeUser.sources must not be empty"))
+	} else if c.Sources[0].Optional {
+		errs = append(errs, fmt.Errorf("compositeUser.sources[0]: the primary source %q cannot be optional", c.Sources[0].Service))
+	}
+
+	paths := make([]string, 0, len(c.Fields))
+	for path := range c.Fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	upstreamFields := map[string]string{}
+	for _, path := range paths {
+		f := c.Fields[path]
+		if !validFieldPath(path) {
+			errs = append(errs, fmt.Errorf("compositeUser.fields: %q is not a valid dotted path", path))
+			continue
+		}
+		if !sources[f.Service] {
+			errs = append(errs, fmt.Errorf("compositeUser.fields.%s: service %q is not a source", path, f.Service))
+		}
+		for _, from := range f.From {
+			if !sources[from] {
+				errs = append(errs, fmt.Errorf("compositeUser.fields.%s.from: service %q is not a source", path, from))
+			}
+		}
+		if f.Field != "" && !validFieldPath(f.Field) {
+			errs = append(errs, fmt.Errorf("compositeUser.fields.%s.field: %q is not a valid dotted path", path, f.Field))
+		}
+		segs := strings.Split(path, ".")
+		for n := 1; n < len(segs); n++ {
+			if parent := strings.Join(segs[:n], "."); hasField(c.Fields, parent) {
+				errs = append(errs, fmt.Errorf("compositeUser.fields: %q overlaps %q", path, parent))
+			}
+		}
+		key := f.Service + ":" + f.UpstreamField(path)
+		if other, ok := upstreamFields[key]; ok {
+			errs = append(errs, fmt.Errorf("compositeUser.fields: %q and %q map to the same %s field", other, path, f.Service))
+		}
+		upstreamFields[key] = path
+	}
+
+	switch c.Merge {
+	case MergeFlat, MergeNested:
+	default:
+		errs = append(errs, fmt.Errorf("compositeUser.merge: unknown strategy %q (use flat or nested)", c.Merge))
+	}
+
+	l := c.List
+	if !strings.HasPrefix(l.Path, "/") {
+		errs = append(errs, fmt.Errorf("compositeUser.list.path: %q must start with /", l.Path))
+	}
+	if l.Concurrency < 0 || l.BatchSize < 0 {
+		errs = append(errs, errors.New("compositeUser.list: concurrency and batchSize must not be negative"))
+	}
+	switch l.ItemFailure {
+	case ItemFailurePartial, ItemFailureFail:
+	default:
+		errs = append(errs, fmt.Errorf("compositeUser.list.itemFailure: unknown mode %q (use partial or fail)", l.ItemFailure))
+	}
+	return errs
+}
+
+func hasField(fields map[string]FieldRoute, path string) bool {
+	_, ok := fields[path]
+	return ok
+}
+
+func validFieldPath(path string) bool {
+	for _, seg := range strings.Split(path, ".") {
+		if seg == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ServiceNames son los upstreams conocidos: los fijos y las fuentes del usuario compuesto
+func (c Config) ServiceNames() []string {
+	names := append([]string{}, UpstreamNames...)
+	for _, s := range c.CompositeUser.Sources {
+		known := false
+		for _, n := range names {
+			known = known || n == s.Service
+		}
+		if !known && s.Service != "" {
+			names = append(names, s.Service)
+		}
+	}
+	return names
+}
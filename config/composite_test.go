@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate_CompositeUserDefaults(t *testing.T) {
+	cfg := LoadConfigFromEnv()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected the default composite user to be valid, got %v", err)
+	}
+	if len(cfg.CompositeUser.Sources) != 2 || cfg.CompositeUser.Fields["email"].Service != "security" {
+		t.Errorf("Unexpected default composite user %+v", cfg.CompositeUser)
+	}
+}
+
+func TestValidate_CompositeUserErrors(t *testing.T) {
+	cfg := LoadConfigFromEnv()
+	cfg.CompositeUser = CompositeUserConfig{
+		Sources: []CompositeSource{
+			{Service: "security", Path: "/api/v1/users/{id}"},
+			{Service: "billing", Path: "/accounts"},
+		},
+		Fields: map[string]FieldRoute{
+			"address":      {Service: "security"},
+			"address.city": {Service: "security", Field: "city"},
+			"city":         {Service: "security"},
+			"plan":         {Service: "payments"},
+			"bad..path":    {Service: "security"},
+		},
+	}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Expected validation errors")
+	}
+	for _, want := range []string{
+		`sources[1].path: "/accounts" must contain {id}`,
+		`sources[1].url is required for service "billing"`,
+		`"address.city" overlaps "address"`,
+		`"address.city" and "city" map to the same security field`,
+		`fields.plan: service "payments" is not a source`,
+		`"bad..path" is not a valid dotted path`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to contain %q, got %v", want, err)
+		}
+	}
+}
+
+func TestServiceNames_IncludesCompositeSources(t *testing.T) {
+	cfg := LoadConfigFromEnv()
+	cfg.CompositeUser.Sources = append(cfg.CompositeUser.Sources,
+		CompositeSource{Service: "preferences", URL: "http://prefs:8080", Path: "/prefs/{id}"})
+
+	names := cfg.ServiceNames()
+	if len(names) != len(UpstreamNames)+1 || names[len(names)-1] != "preferences" {
+		t.Errorf("Expected preferences to be added once, got %v", names)
+	}
+	if got := cfg.SourceURL(cfg.CompositeUser.Sources[2], "a b"); got != "http://prefs:8080/prefs/a%20b" {
+		t.Errorf("Unexpected source URL %q", got)
+	}
+}
@@ -1,32 +1,607 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// Config expuesto para que handlers lo usen (campos exportados)
+// Config expuesto para que handlers lo usen (campos exportados).
+// Una vez publicado en un Store se trata como inmutable: nunca modificar
+// un *Config obtenido de Store.Current; los cambios llegan con Store.Reload.
 type Config struct {
-	SecurityURL string
-	ProfileURL  string
-	EventBusURL string
-	Port        string
+	SecurityURL string `json:"securityURL" yaml:"securityURL"`
+	ProfileURL  string `json:"profileURL" yaml:"profileURL"`
+	EventBusURL string `json:"eventBusURL" yaml:"eventBusURL"`
+	Port        string `json:"port" yaml:"port"`
+	RoutesFile  string `json:"routesFile" yaml:"routesFile"`
+
+	JWT           JWTConfig           `json:"jwt" yaml:"jwt"`
+	Authz         AuthzConfig         `json:"authz" yaml:"authz"`
+	Identity      IdentityConfig      `json:"identity" yaml:"identity"`
+	Revocation    RevocationConfig    `json:"revocation" yaml:"revocation"`
+	Introspection IntrospectionConfig `json:"introspection" yaml:"introspection"`
+	APIKeys       APIKeysConfig       `json:"apiKeys" yaml:"apiKeys"`
+	TLS           TLSConfig           `json:"tls" yaml:"tls"`
+
+	// TrustedProxies: IPs o CIDRs de proxies/balanceadores delante del gateway;
+	// solo de ellos se aceptan X-Forwarded-* y Forwarded
+	TrustedProxies []string `json:"trustedProxies" yaml:"trustedProxies"`
+
+	// Upstreams: ajustes por servicio ("security", "profile", ...)
+	Upstreams map[string]UpstreamConfig `json:"upstreams" yaml:"upstreams"`
+
+	// RetryBudget: reintentos que puede gastar una petición entrante entre
+	// todas sus llamadas a upstreams (3), para no multiplicar una caída.
+	// 0 = sin reintentos; nil = el default.
+	RetryBudget *int `json:"retryBudget" yaml:"retryBudget"`
+
+	// CompositeTimeout: deadline compartido por las llamadas en paralelo de
+	// los endpoints compuestos (/users/{id}) (10s)
+	CompositeTimeout Duration `json:"compositeTimeout" yaml:"compositeTimeout"`
+
+	// CompositeDegradation: strict (por defecto) responde error si falla
+	// cualquier upstream de GET /users/{id}; partial devuelve lo disponible
+	// marcado con _meta.partial si el que falla es profile
+	CompositeDegradation string `json:"compositeDegradation" yaml:"compositeDegradation"`
+
+	// CompensationJournal: archivo donde se registran las compensaciones de
+	// PUT /users/{id} que fallaron (vacío = solo en memoria)
+	CompensationJournal string `json:"compensationJournal" yaml:"compensationJournal"`
+
+	// CompositeUser: reparto de campos de /users/{id} entre upstreams
+	// (por defecto security y profile, ver defaultCompositeUser)
+	CompositeUser CompositeUserConfig `json:"compositeUser" yaml:"compositeUser"`
+}
+
+// IdentityConfig define los headers de identidad que el gateway manda upstream
+type IdentityConfig struct {
+	// Headers: nombre del header → claim del que sale su valor
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// SigningSecret: si está definido se agrega X-User-Signature (HMAC-SHA256)
+	SigningSecret string `json:"signingSecret" yaml:"signingSecret"`
+}
+
+// RevocationConfig configura el almacén de tokens revocados
+type RevocationConfig struct {
+	// File: si está definido las revocaciones se persisten ahí (JSON)
+	File string `json:"file" yaml:"file"`
+	// SubjectTTL: cuánto se recuerda una revocación por subject; tiene que
+	// cubrir la vida máxima de un token
+	SubjectTTL Duration `json:"subjectTTL" yaml:"subjectTTL"`
+}
+
+// IntrospectionConfig configura el endpoint RFC 7662 para tokens opacos
+type IntrospectionConfig struct {
+	URL          string `json:"url" yaml:"url"`
+	ClientID     string `json:"clientID" yaml:"clientID"`
+	ClientSecret string `json:"clientSecret" yaml:"clientSecret"`
+	// NegativeTTL: cuánto se recuerda que un token está inactivo
+	NegativeTTL Duration `json:"negativeTTL" yaml:"negativeTTL"`
+	// MaxTTL: tope de caché para respuestas activas (también si no traen exp)
+	MaxTTL Duration `json:"maxTTL" yaml:"maxTTL"`
+}
+
+// APIKeysConfig configura la autenticación con API keys para clientes máquina
+type APIKeysConfig struct {
+	// File: archivo YAML/JSON con las claves (hasheadas); vacío = deshabilitado
+	File string `json:"file" yaml:"file"`
+	// Header donde viene la clave (por defecto X-API-Key)
+	Header string `json:"header" yaml:"header"`
+	// QueryParam: si no está vacío también se acepta ?<param>=<clave>
+	QueryParam string `json:"queryParam" yaml:"queryParam"`
+}
+
+// TLSConfig habilita HTTPS en el listener del gateway y, opcionalmente,
+// la verificación de certificados de cliente (mTLS)
+type TLSConfig struct {
+	// CertFile/KeyFile: certificado y clave PEM del servidor; vacíos = HTTP plano
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+	// ClientCAFile: bundle PEM de CAs con las que se verifican los certificados de cliente
+	ClientCAFile string `json:"clientCAFile" yaml:"clientCAFile"`
+	// ClientAuth: none | optional | require (por defecto optional si hay ClientCAFile)
+	ClientAuth string `json:"clientAuth" yaml:"clientAuth"`
+}
+
+// UpstreamNames son los upstreams que admiten ajustes en Upstreams
+var UpstreamNames = []string{"security", "profile", "eventbus"}
+
+// UpstreamConfig agrupa los ajustes propios de un servicio upstream
+type UpstreamConfig struct {
+	// ForwardToken: reenviar el Authorization original (por defecto true)
+	ForwardToken *bool `json:"forwardToken" yaml:"forwardToken"`
+	// TLS hacia el upstream (vacío = raíces del sistema, sin certificado de cliente)
+	TLS UpstreamTLSConfig `json:"tls" yaml:"tls"`
+	// Transport: pool de conexiones y timeouts propios del upstream
+	Transport TransportConfig `json:"transport" yaml:"transport"`
+	// Retry: reintentos de llamadas idempotentes
+	Retry RetryConfig `json:"retry" yaml:"retry"`
+	// Breaker: circuit breaker que corta las llamadas mientras el upstream falla
+	Breaker BreakerConfig `json:"breaker" yaml:"breaker"`
+}
+
+// BreakerConfig configura el circuit breaker de un upstream.
+// Los valores en cero usan el default indicado.
+type BreakerConfig struct {
+	// Enabled (por defecto true)
+	Enabled *bool `json:"enabled" yaml:"enabled"`
+	// El circuito se abre si en Window (30s, mínimo MinBreakerWindow) hubo al
+	// menos MinRequests (10) llamadas y fallaron FailureRate (0.5) de ellas, o
+	// tras ConsecutiveFailures (5) fallos seguidos
+	FailureRate         float64  `json:"failureRate" yaml:"failureRate"`
+	MinRequests         int      `json:"minRequests" yaml:"minRequests"`
+	ConsecutiveFailures int      `json:"consecutiveFailures" yaml:"consecutiveFailures"`
+	Window              Duration `json:"window" yaml:"window"`
+	// OpenTimeout: cuánto queda abierto antes de probar (30s)
+	OpenTimeout Duration `json:"openTimeout" yaml:"openTimeout"`
+	// HalfOpenProbes: llamadas de prueba que tienen que salir bien para cerrarlo (3)
+	HalfOpenProbes int `json:"halfOpenProbes" yaml:"halfOpenProbes"`
+}
+
+// MinBreakerWindow es la ventana más corta que acepta un circuit breaker;
+// se reparte en tramos y por debajo de esto no cuenta nada útil
+const MinBreakerWindow = time.Second
+
+// RetryConfig es la política de reintentos de un upstream.
+// Los valores en cero usan el default indicado.
+type RetryConfig struct {
+	// MaxAttempts: intentos en total, el primero incluido (3; 1 = sin reintentos)
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	// Backoff (100ms) se duplica en cada intento hasta MaxBackoff (2s), con jitter
+	Backoff    Duration `json:"backoff" yaml:"backoff"`
+	MaxBackoff Duration `json:"maxBackoff" yaml:"maxBackoff"`
+	// RetryOn: status (502, 503, 504...) y clases de error (connect, reset,
+	// timeout) que se reintentan; por defecto 502, 503, 504, connect y reset
+	RetryOn []string `json:"retryOn" yaml:"retryOn"`
+}
+
+// RetryErrorClasses son las clases de error admitidas en RetryConfig.RetryOn
+var RetryErrorClasses = []string{"connect", "reset", "timeout"}
+
+// TransportConfig ajusta el http.Transport de un upstream.
+// Los valores en cero usan el default indicado.
+type TransportConfig struct {
+	// Timeout total de cada llamada, cuerpo incluido (10s). En las rutas de paso
+	// directo (streaming) solo acota la espera de los headers, si no hay
+	// ResponseHeaderTimeout; el cuerpo dura lo que la petición del cliente.
+	Timeout Duration `json:"timeout" yaml:"timeout"`
+	// MaxIdleConns (100) y MaxIdleConnsPerHost (10): conexiones ociosas que se conservan
+	MaxIdleConns        int `json:"maxIdleConns" yaml:"maxIdleConns"`
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost" yaml:"maxIdleConnsPerHost"`
+	// MaxConnsPerHost: tope de conexiones abiertas por host (0 = sin tope)
+	MaxConnsPerHost int `json:"maxConnsPerHost" yaml:"maxConnsPerHost"`
+	// IdleConnTimeout: cuánto vive una conexión ociosa (90s)
+	IdleConnTimeout Duration `json:"idleConnTimeout" yaml:"idleConnTimeout"`
+	// DialTimeout (5s), TLSHandshakeTimeout (5s) y ResponseHeaderTimeout (sin tope propio)
+	DialTimeout           Duration `json:"dialTimeout" yaml:"dialTimeout"`
+	TLSHandshakeTimeout   Duration `json:"tlsHandshakeTimeout" yaml:"tlsHandshakeTimeout"`
+	ResponseHeaderTimeout Duration `json:"responseHeaderTimeout" yaml:"responseHeaderTimeout"`
+	// KeepAlive: intervalo de TCP keepalive (30s)
+	KeepAlive Duration `json:"keepAlive" yaml:"keepAlive"`
+	// HTTP2: negociar HTTP/2 por ALPN con upstreams https (por defecto true)
+	HTTP2 *bool `json:"http2" yaml:"http2"`
+}
+
+// UpstreamTLSConfig configura las conexiones https hacia un upstream
+type UpstreamTLSConfig struct {
+	// CAFile: bundle PEM con las CAs que firman el certificado del upstream
+	CAFile string `json:"caFile" yaml:"caFile"`
+	// CertFile/KeyFile: certificado de cliente para mTLS
+	CertFile string `json:"certFile" yaml:"certFile"`
+	KeyFile  string `json:"keyFile" yaml:"keyFile"`
+	// ServerName: SNI y nombre a verificar si difiere del host de la URL
+	ServerName string `json:"serverName" yaml:"serverName"`
+	// MinVersion: "1.2" (por defecto) o "1.3"
+	MinVersion string `json:"minVersion" yaml:"minVersion"`
+	// InsecureSkipVerify: no verificar el certificado del upstream; SOLO desarrollo
+	InsecureSkipVerify bool `json:"insecureSkipVerify" yaml:"insecureSkipVerify"`
+}
+
+// Empty indica si no hay ningún ajuste TLS
+func (t UpstreamTLSConfig) Empty() bool {
+	return t == UpstreamTLSConfig{}
+}
+
+// AuthzConfig indica de qué claims salen subject, roles y scopes
+type AuthzConfig struct {
+	SubjectClaim string `json:"subjectClaim" yaml:"subjectClaim"`
+	RolesClaim   string `json:"rolesClaim" yaml:"rolesClaim"`
+	ScopeClaim   string `json:"scopeClaim" yaml:"scopeClaim"`
+	// OwnerBypassRoles: roles que pueden actuar sobre recursos de otros
+	OwnerBypassRoles []string `json:"ownerBypassRoles" yaml:"ownerBypassRoles"`
+}
+
+// JWTConfig selecciona cómo se verifican las firmas de los JWT
+type JWTConfig struct {
+	// Mode: "hmac" (JWT_SECRET compartido, por defecto) o "jwks"
+	Mode string `json:"mode" yaml:"mode"`
+	// JWKSURL: URL http(s) o ruta de archivo del documento JWKS
+	JWKSURL string `json:"jwksURL" yaml:"jwksURL"`
+	// JWKSRefresh: cada cuánto se vuelve a leer el JWKS
+	JWKSRefresh Duration `json:"jwksRefresh" yaml:"jwksRefresh"`
+
+	// Issuers/Audiences: si no están vacíos, iss tiene que ser uno de ellos
+	// y aud contener al menos uno
+	Issuers   []string `json:"issuers" yaml:"issuers"`
+	Audiences []string `json:"audiences" yaml:"audiences"`
+	// Algorithms: valores de alg aceptados (por defecto todos los del modo)
+	Algorithms []string `json:"algorithms" yaml:"algorithms"`
+	// Leeway: tolerancia de reloj para exp, nbf e iat
+	Leeway Duration `json:"leeway" yaml:"leeway"`
 }
 
 // LoadConfigFromEnv carga variables de entorno y devuelve Config
 func LoadConfigFromEnv() Config {
-	cfg := Config{
-		SecurityURL: os.Getenv("SECURITY_URL"),
-		ProfileURL:  os.Getenv("PROFILE_URL"),
-		EventBusURL: os.Getenv("EVENT_BUS_URL"),
-		Port:        os.Getenv("PORT"),
+	var cfg Config
+	applyEnv(&cfg)
+	applyDefaults(&cfg)
+	logWarnings(cfg)
+	return cfg
+}
+
+// Load arma la configuración a partir del archivo path (YAML o JSON, opcional
+// si path está vacío) y encima las variables de entorno definidas.
+// Devuelve error si el resultado no pasa Validate.
+func Load(path string) (Config, error) {
+	var cfg Config
+	if path != "" {
+		if err := DecodeFile(path, &cfg); err != nil {
+			return Config{}, err
+		}
+	}
+	applyEnv(&cfg)
+	applyDefaults(&cfg)
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate revisa que las URLs de upstream sean absolutas http(s) y el puerto válido
+func (c Config) Validate() error {
+	var errs []error
+
+	for name, raw := range map[string]string{
+		"securityURL":       c.SecurityURL,
+		"profileURL":        c.ProfileURL,
+		"eventBusURL":       c.EventBusURL,
+		"introspection.url": c.Introspection.URL,
+	} {
+		if raw == "" {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s: %q is not an absolute http(s) URL", name, raw))
+		}
+	}
+
+	switch c.JWT.Mode {
+	case "hmac":
+	case "jwks":
+		if c.JWT.JWKSURL == "" {
+			errs = append(errs, errors.New("jwt.jwksURL is required when jwt.mode is jwks"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("jwt.mode: unknown mode %q (use hmac or jwks)", c.JWT.Mode))
+	}
+
+	for name, up := range c.Upstreams {
+		known := false
+		for _, n := range c.ServiceNames() {
+			known = known || n == name
+		}
+		if !known {
+			errs = append(errs, fmt.Errorf("upstreams: unknown service %q", name))
+		}
+		if (up.TLS.CertFile == "") != (up.TLS.KeyFile == "") {
+			errs = append(errs, fmt.Errorf("upstreams.%s.tls: certFile and keyFile must be set together", name))
+		}
+		t := up.Transport
+		if t.MaxIdleConns < 0 || t.MaxIdleConnsPerHost < 0 || t.MaxConnsPerHost < 0 {
+			errs = append(errs, fmt.Errorf("upstreams.%s.transport: connection limits must not be negative", name))
+		}
+		if t.Timeout < 0 || t.IdleConnTimeout < 0 || t.DialTimeout < 0 || t.TLSHandshakeTimeout < 0 ||
+			t.ResponseHeaderTimeout < 0 || t.KeepAlive < 0 {
+			errs = append(errs, fmt.Errorf("upstreams.%s.transport: timeouts must not be negative", name))
+		}
+		if up.Retry.MaxAttempts < 0 || up.Retry.Backoff < 0 || up.Retry.MaxBackoff < 0 {
+			errs = append(errs, fmt.Errorf("upstreams.%s.retry: values must not be negative", name))
+		}
+		for _, on := range up.Retry.RetryOn {
+			if !validRetryOn(on) {
+				errs = append(errs, fmt.Errorf("upstreams.%s.retry.retryOn: %q is not a 4xx/5xx status or one of %s",
+					name, on, strings.Join(RetryErrorClasses, ", ")))
+			}
+		}
+		b := up.Breaker
+		if b.FailureRate < 0 || b.FailureRate > 1 {
+			errs = append(errs, fmt.Errorf("upstreams.%s.breaker.failureRate: must be between 0 and 1", name))
+		}
+		if b.MinRequests < 0 || b.ConsecutiveFailures < 0 || b.HalfOpenProbes < 0 || b.Window < 0 || b.OpenTimeout < 0 {
+			errs = append(errs, fmt.Errorf("upstreams.%s.breaker: values must not be negative", name))
+		} else if b.Window != 0 && b.Window.Std() < MinBreakerWindow {
+			errs = append(errs, fmt.Errorf("upstreams.%s.breaker.window: must be at least %v", name, MinBreakerWindow))
+		}
+		switch up.TLS.MinVersion {
+		case "", "1.2", "1.3":
+		default:
+			errs = append(errs, fmt.Errorf("upstreams.%s.tls.minVersion: %q is not supported (use 1.2 or 1.3)", name, up.TLS.MinVersion))
+		}
+	}
+
+	for name := range c.Identity.Headers {
+		if !strings.HasPrefix(strings.ToLower(name), "x-") {
+			errs = append(errs, fmt.Errorf("identity.headers: %q must be an X- header", name))
+		}
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls.certFile and tls.keyFile must be set together"))
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		errs = append(errs, errors.New("tls.clientCAFile requires tls.certFile"))
+	}
+	switch c.TLS.ClientAuth {
+	case "none", "optional":
+	case "require":
+		if c.TLS.ClientCAFile == "" {
+			errs = append(errs, errors.New("tls.clientAuth require needs tls.clientCAFile"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tls.clientAuth: unknown mode %q (use none, optional or require)", c.TLS.ClientAuth))
+	}
+
+	for _, p := range c.TrustedProxies {
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			errs = append(errs, fmt.Errorf("trustedProxies: %q is not an IP or CIDR", p))
+		}
+	}
+
+	if c.RetryBudget != nil && *c.RetryBudget < 0 {
+		errs = append(errs, errors.New("retryBudget must not be negative"))
+	}
+	if c.CompositeTimeout < 0 {
+		errs = append(errs, errors.New("compositeTimeout must not be negative"))
+	}
+	switch c.CompositeDegradation {
+	case "strict", "partial":
+	default:
+		errs = append(errs, fmt.Errorf("compositeDegradation: unknown mode %q (use strict or partial)", c.CompositeDegradation))
+	}
+
+	errs = append(errs, c.CompositeUser.validate(c)...)
+
+	if c.JWT.Leeway < 0 {
+		errs = append(errs, errors.New("jwt.leeway must not be negative"))
+	}
+
+	if p, err := strconv.Atoi(c.Port); err != nil || p <= 0 || p > 65535 {
+		errs = append(errs, fmt.Errorf("port: %q is not a valid TCP port", c.Port))
+	}
+
+	return errors.Join(errs...)
+}
+
+func validRetryOn(on string) bool {
+	if status, err := strconv.Atoi(on); err == nil {
+		return status >= 400 && status <= 599
+	}
+	for _, class := range RetryErrorClasses {
+		if on == class {
+			return true
+		}
+	}
+	return false
+}
+
+// ServiceURL devuelve la URL base del servicio upstream con ese nombre.
+// El booleano es false si el nombre no corresponde a ningún servicio conocido.
+func (c Config) ServiceURL(name string) (string, bool) {
+	switch name {
+	case "security":
+		return c.SecurityURL, true
+	case "profile":
+		return c.ProfileURL, true
+	}
+	return "", false
+}
+
+// Upstream devuelve los ajustes del servicio name (vacíos si no hay)
+func (c Config) Upstream(name string) UpstreamConfig {
+	return c.Upstreams[name]
+}
+
+// ForwardToken indica si al servicio name se le reenvía el Authorization original
+func (c Config) ForwardToken(name string) bool {
+	if ft := c.Upstream(name).ForwardToken; ft != nil {
+		return *ft
 	}
+	return true
+}
 
+// applyEnv pisa los campos de cfg con las variables de entorno que estén definidas
+func applyEnv(cfg *Config) {
+	setFromEnv(&cfg.SecurityURL, "SECURITY_URL")
+	setFromEnv(&cfg.ProfileURL, "PROFILE_URL")
+	setFromEnv(&cfg.EventBusURL, "EVENT_BUS_URL")
+	setFromEnv(&cfg.Port, "PORT")
+	setFromEnv(&cfg.RoutesFile, "ROUTES_FILE")
+	setFromEnv(&cfg.JWT.Mode, "JWT_MODE")
+	setFromEnv(&cfg.JWT.JWKSURL, "JWKS_URL")
+	setDurationFromEnv(&cfg.JWT.JWKSRefresh, "JWKS_REFRESH")
+	setListFromEnv(&cfg.JWT.Issuers, "JWT_ISSUERS")
+	setListFromEnv(&cfg.JWT.Audiences, "JWT_AUDIENCES")
+	setListFromEnv(&cfg.JWT.Algorithms, "JWT_ALGORITHMS")
+	setDurationFromEnv(&cfg.JWT.Leeway, "JWT_LEEWAY")
+	setFromEnv(&cfg.Authz.SubjectClaim, "AUTHZ_SUBJECT_CLAIM")
+	setFromEnv(&cfg.Authz.RolesClaim, "AUTHZ_ROLES_CLAIM")
+	setFromEnv(&cfg.Authz.ScopeClaim, "AUTHZ_SCOPE_CLAIM")
+	setListFromEnv(&cfg.Authz.OwnerBypassRoles, "AUTHZ_OWNER_BYPASS_ROLES")
+	setMapFromEnv(&cfg.Identity.Headers, "IDENTITY_HEADERS")
+	setFromEnv(&cfg.Identity.SigningSecret, "IDENTITY_SIGNING_SECRET")
+	setFromEnv(&cfg.Revocation.File, "REVOCATION_FILE")
+	setDurationFromEnv(&cfg.Revocation.SubjectTTL, "REVOCATION_SUBJECT_TTL")
+	setFromEnv(&cfg.Introspection.URL, "INTROSPECTION_URL")
+	setFromEnv(&cfg.Introspection.ClientID, "INTROSPECTION_CLIENT_ID")
+	setFromEnv(&cfg.Introspection.ClientSecret, "INTROSPECTION_CLIENT_SECRET")
+	setDurationFromEnv(&cfg.Introspection.NegativeTTL, "INTROSPECTION_NEGATIVE_TTL")
+	setDurationFromEnv(&cfg.Introspection.MaxTTL, "INTROSPECTION_MAX_TTL")
+	setFromEnv(&cfg.APIKeys.File, "APIKEYS_FILE")
+	setFromEnv(&cfg.APIKeys.Header, "APIKEY_HEADER")
+	setFromEnv(&cfg.APIKeys.QueryParam, "APIKEY_QUERY_PARAM")
+	setFromEnv(&cfg.TLS.CertFile, "TLS_CERT_FILE")
+	setFromEnv(&cfg.TLS.KeyFile, "TLS_KEY_FILE")
+	setFromEnv(&cfg.TLS.ClientCAFile, "TLS_CLIENT_CA_FILE")
+	setFromEnv(&cfg.TLS.ClientAuth, "TLS_CLIENT_AUTH")
+	setListFromEnv(&cfg.TrustedProxies, "TRUSTED_PROXIES")
+	setIntPtrFromEnv(&cfg.RetryBudget, "RETRY_BUDGET")
+	setDurationFromEnv(&cfg.CompositeTimeout, "COMPOSITE_TIMEOUT")
+	setFromEnv(&cfg.CompositeDegradation, "COMPOSITE_DEGRADATION")
+	setFromEnv(&cfg.CompensationJournal, "COMPENSATION_JOURNAL_FILE")
+	setIntFromEnv(&cfg.CompositeUser.List.Concurrency, "COMPOSITE_LIST_CONCURRENCY")
+	setIntFromEnv(&cfg.CompositeUser.List.BatchSize, "COMPOSITE_LIST_BATCH_SIZE")
+	setFromEnv(&cfg.CompositeUser.List.ItemFailure, "COMPOSITE_LIST_ITEM_FAILURE")
+	for _, name := range UpstreamNames {
+		prefix := strings.ToUpper(name) + "_"
+		up := cfg.Upstream(name)
+		setBoolPtrFromEnv(&up.ForwardToken, prefix+"FORWARD_TOKEN")
+		setFromEnv(&up.TLS.CAFile, prefix+"TLS_CA_FILE")
+		setFromEnv(&up.TLS.CertFile, prefix+"TLS_CERT_FILE")
+		setFromEnv(&up.TLS.KeyFile, prefix+"TLS_KEY_FILE")
+		setFromEnv(&up.TLS.ServerName, prefix+"TLS_SERVER_NAME")
+		setFromEnv(&up.TLS.MinVersion, prefix+"TLS_MIN_VERSION")
+		var insecure *bool
+		if setBoolPtrFromEnv(&insecure, prefix+"TLS_INSECURE_SKIP_VERIFY") {
+			up.TLS.InsecureSkipVerify = *insecure
+		}
+		setDurationFromEnv(&up.Transport.Timeout, prefix+"TIMEOUT")
+		setIntFromEnv(&up.Transport.MaxIdleConns, prefix+"MAX_IDLE_CONNS")
+		setIntFromEnv(&up.Transport.MaxIdleConnsPerHost, prefix+"MAX_IDLE_CONNS_PER_HOST")
+		setIntFromEnv(&up.Transport.MaxConnsPerHost, prefix+"MAX_CONNS_PER_HOST")
+		setDurationFromEnv(&up.Transport.IdleConnTimeout, prefix+"IDLE_CONN_TIMEOUT")
+		setDurationFromEnv(&up.Transport.DialTimeout, prefix+"DIAL_TIMEOUT")
+		setDurationFromEnv(&up.Transport.TLSHandshakeTimeout, prefix+"TLS_HANDSHAKE_TIMEOUT")
+		setDurationFromEnv(&up.Transport.ResponseHeaderTimeout, prefix+"RESPONSE_HEADER_TIMEOUT")
+		setDurationFromEnv(&up.Transport.KeepAlive, prefix+"KEEPALIVE")
+		setBoolPtrFromEnv(&up.Transport.HTTP2, prefix+"HTTP2")
+		setIntFromEnv(&up.Retry.MaxAttempts, prefix+"RETRY_MAX_ATTEMPTS")
+		setDurationFromEnv(&up.Retry.Backoff, prefix+"RETRY_BACKOFF")
+		setDurationFromEnv(&up.Retry.MaxBackoff, prefix+"RETRY_MAX_BACKOFF")
+		setListFromEnv(&up.Retry.RetryOn, prefix+"RETRY_ON")
+		setBoolPtrFromEnv(&up.Breaker.Enabled, prefix+"BREAKER_ENABLED")
+		setFloatFromEnv(&up.Breaker.FailureRate, prefix+"BREAKER_FAILURE_RATE")
+		setIntFromEnv(&up.Breaker.MinRequests, prefix+"BREAKER_MIN_REQUESTS")
+		setIntFromEnv(&up.Breaker.ConsecutiveFailures, prefix+"BREAKER_CONSECUTIVE_FAILURES")
+		setDurationFromEnv(&up.Breaker.Window, prefix+"BREAKER_WINDOW")
+		setDurationFromEnv(&up.Breaker.OpenTimeout, prefix+"BREAKER_OPEN_TIMEOUT")
+		setIntFromEnv(&up.Breaker.HalfOpenProbes, prefix+"BREAKER_HALF_OPEN_PROBES")
+		if reflect.DeepEqual(up, UpstreamConfig{}) {
+			continue
+		}
+		if cfg.Upstreams == nil {
+			cfg.Upstreams = map[string]UpstreamConfig{}
+		}
+		cfg.Upstreams[name] = up
+	}
+}
+
+func applyDefaults(cfg *Config) {
 	if cfg.Port == "" {
 		cfg.Port = "8088"
 	}
+	if cfg.JWT.Mode == "" {
+		cfg.JWT.Mode = "hmac"
+	}
+	if cfg.JWT.JWKSRefresh == 0 {
+		cfg.JWT.JWKSRefresh = Duration(10 * time.Minute)
+	}
+	if cfg.Authz.SubjectClaim == "" {
+		cfg.Authz.SubjectClaim = "sub"
+	}
+	if cfg.Authz.RolesClaim == "" {
+		cfg.Authz.RolesClaim = "roles"
+	}
+	if cfg.Authz.ScopeClaim == "" {
+		cfg.Authz.ScopeClaim = "scope"
+	}
+	if cfg.Authz.OwnerBypassRoles == nil {
+		cfg.Authz.OwnerBypassRoles = []string{"admin"}
+	}
+	if cfg.Revocation.SubjectTTL == 0 {
+		cfg.Revocation.SubjectTTL = Duration(24 * time.Hour)
+	}
+	if cfg.Introspection.NegativeTTL == 0 {
+		cfg.Introspection.NegativeTTL = Duration(10 * time.Second)
+	}
+	if cfg.Introspection.MaxTTL == 0 {
+		cfg.Introspection.MaxTTL = Duration(5 * time.Minute)
+	}
+	if cfg.RetryBudget == nil {
+		budget := 3
+		cfg.RetryBudget = &budget
+	}
+	if cfg.CompositeTimeout == 0 {
+		cfg.CompositeTimeout = Duration(10 * time.Second)
+	}
+	if cfg.CompositeDegradation == "" {
+		cfg.CompositeDegradation = "strict"
+	}
+	def := defaultCompositeUser()
+	if cfg.CompositeUser.Sources == nil {
+		cfg.CompositeUser.Sources = def.Sources
+	}
+	if cfg.CompositeUser.Fields == nil {
+		cfg.CompositeUser.Fields = def.Fields
+	}
+	if cfg.CompositeUser.Merge == "" {
+		cfg.CompositeUser.Merge = def.Merge
+	}
+	list := &cfg.CompositeUser.List
+	if list.Path == "" {
+		list.Path = def.List.Path
+	}
+	if list.IDField == "" {
+		list.IDField = def.List.IDField
+	}
+	if list.Concurrency == 0 {
+		list.Concurrency = def.List.Concurrency
+	}
+	if list.BatchSize == 0 {
+		list.BatchSize = def.List.BatchSize
+	}
+	if list.ItemFailure == "" {
+		list.ItemFailure = def.List.ItemFailure
+	}
+	if cfg.APIKeys.Header == "" {
+		cfg.APIKeys.Header = "X-API-Key"
+	}
+	if cfg.TLS.ClientAuth == "" {
+		cfg.TLS.ClientAuth = "none"
+		if cfg.TLS.ClientCAFile != "" {
+			cfg.TLS.ClientAuth = "optional"
+		}
+	}
+	if cfg.Identity.Headers == nil {
+		cfg.Identity.Headers = map[string]string{
+			"X-User-Id":    "sub",
+			"X-User-Roles": "roles",
+			"X-User-Email": "email",
+		}
+	}
+}
 
-	// Logging útil para debugging
+// Logging útil para debugging
+func logWarnings(cfg Config) {
 	if cfg.SecurityURL == "" {
 		log.Println("[WARN] SECURITY_URL no configurada")
 	}
@@ -36,6 +611,113 @@ func LoadConfigFromEnv() Config {
 	if cfg.EventBusURL == "" {
 		log.Println("[WARN] EVENT_BUS_URL no configurada (eventos deshabilitados)")
 	}
+}
 
-	return cfg
+func setFromEnv(dst *string, name string) {
+	if v := os.Getenv(name); v != "" {
+		*dst = v
+	}
+}
+
+// setListFromEnv interpreta la variable como lista separada por comas
+func setListFromEnv(dst *[]string, name string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	*dst = out
+}
+
+// setMapFromEnv interpreta la variable como "clave=valor,clave=valor"
+func setMapFromEnv(dst *map[string]string, name string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	out := map[string]string{}
+	for _, item := range strings.Split(v, ",") {
+		k, val, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || k == "" || val == "" {
+			log.Printf("[WARN] %s: entrada %q inválida (use clave=valor), se ignora\n", name, item)
+			continue
+		}
+		out[k] = val
+	}
+	*dst = out
+}
+
+// setDurationFromEnv ignora (con aviso) valores que no son duraciones válidas
+func setDurationFromEnv(dst *Duration, name string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("[WARN] %s=%q no es una duración válida, se ignora\n", name, v)
+		return
+	}
+	*dst = Duration(d)
+}
+
+// setIntFromEnv ignora (con aviso) valores que no son enteros
+func setIntFromEnv(dst *int, name string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("[WARN] %s=%q no es un entero válido, se ignora\n", name, v)
+		return
+	}
+	*dst = n
+}
+
+// setIntPtrFromEnv es setIntFromEnv para campos donde 0 no es "sin configurar"
+func setIntPtrFromEnv(dst **int, name string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("[WARN] %s=%q no es un entero válido, se ignora\n", name, v)
+		return
+	}
+	*dst = &n
+}
+
+func setFloatFromEnv(dst *float64, name string) {
+	v := os.Getenv(name)
+	if v == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("[WARN] %s=%q no es un número válido, se ignora\n", name, v)
+		return
+	}
+	*dst = f
+}
+
+// setBoolPtrFromEnv deja en *dst el booleano de la variable; devuelve si lo hizo
+func setBoolPtrFromEnv(dst **bool, name string) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("[WARN] %s=%q no es un booleano válido, se ignora\n", name, v)
+		return false
+	}
+	*dst = &b
+	return true
 }
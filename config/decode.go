@@ -0,0 +1,42 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DecodeFile lee un archivo JSON o YAML (según la extensión) en v.
+// Los campos desconocidos se rechazan para detectar errores de tipeo.
+func DecodeFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := Decode(data, filepath.Ext(path), v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// Decode interpreta data como JSON si ext es ".json" y como YAML en otro caso.
+func Decode(data []byte, ext string, v interface{}) error {
+	if strings.EqualFold(ext, ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		return dec.Decode(v)
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	// Un documento YAML vacío no es un error: deja v sin modificar
+	if err := dec.Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
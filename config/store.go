@@ -0,0 +1,200 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// ReloadStatus resume el último intento de recarga de configuración
+type ReloadStatus struct {
+	Version  int       `json:"version"`
+	Source   string    `json:"source"`
+	At       time.Time `json:"at"`
+	OK       bool      `json:"ok"`
+	Error    string    `json:"error,omitempty"`
+	LoadedAt time.Time `json:"loadedAt"`
+}
+
+// Store mantiene la configuración vigente detrás de un puntero atómico.
+// Las lecturas (Current) no bloquean; una recarga inválida se descarta y
+// la configuración anterior sigue sirviendo.
+type Store struct {
+	path    string
+	current atomic.Pointer[Config]
+
+	mu      sync.Mutex
+	status  ReloadStatus
+	modTime time.Time
+	hooks   []func(old, next *Config) error
+}
+
+// NewStore carga la configuración inicial desde path (puede ser "") y el entorno
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	logWarnings(cfg)
+
+	now := time.Now()
+	s.current.Store(&cfg)
+	s.modTime = s.fileModTime()
+	s.status = ReloadStatus{Version: 1, Source: "startup", At: now, OK: true, LoadedAt: now}
+	return s, nil
+}
+
+// NewStaticStore envuelve una configuración ya armada (útil en tests)
+func NewStaticStore(cfg Config) *Store {
+	s := &Store{}
+	now := time.Now()
+	s.current.Store(&cfg)
+	s.status = ReloadStatus{Version: 1, Source: "static", At: now, OK: true, LoadedAt: now}
+	return s
+}
+
+// Current devuelve la configuración vigente. No debe modificarse.
+func (s *Store) Current() *Config {
+	return s.current.Load()
+}
+
+// Path devuelve el archivo de configuración observado ("" si solo entorno)
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Status devuelve el resultado del último intento de recarga
+func (s *Store) Status() ReloadStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// OnReload registra fn para aplicar una configuración recargada a lo que se
+// arma a partir de ella (p.ej. los clientes de cada upstream). Corre antes de
+// publicar next; si devuelve error la recarga se rechaza.
+func (s *Store) OnReload(fn func(old, next *Config) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hooks = append(s.hooks, fn)
+}
+
+// Reload vuelve a leer archivo + entorno, valida y reemplaza la configuración.
+// source describe qué disparó la recarga (sighup, file, admin, ...). Una
+// recarga que cambia algo que solo se aplica al arrancar (ver restartOnly)
+// se rechaza.
+func (s *Store) Reload(source string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.modTime = s.fileModTime()
+	now := time.Now()
+
+	old := s.current.Load()
+	cfg, err := Load(s.path)
+	if err == nil {
+		if changed := restartOnly(old, &cfg); len(changed) > 0 {
+			err = fmt.Errorf("%s cannot change without a restart", strings.Join(changed, ", "))
+		}
+	}
+	for _, hook := range s.hooks {
+		if err != nil {
+			break
+		}
+		err = hook(old, &cfg)
+	}
+	if err != nil {
+		s.status.Source = source
+		s.status.At = now
+		s.status.OK = false
+		s.status.Error = err.Error()
+		log.Printf("[config] reload (%s) rejected, keeping version %d: %v\n", source, s.status.Version, err)
+		return err
+	}
+
+	s.current.Store(&cfg)
+	s.status = ReloadStatus{Version: s.status.Version + 1, Source: source, At: now, OK: true, LoadedAt: now}
+	log.Printf("[config] reload (%s) ok, now at version %d\n", source, s.status.Version)
+	return nil
+}
+
+// restartOnly devuelve las secciones que cambian entre old y next pero que
+// main lee una sola vez al arrancar: puerto, manifiesto de rutas, claves JWT,
+// introspección, revocación, API keys, TLS del listener y journal
+func restartOnly(old, next *Config) []string {
+	sections := []struct {
+		name      string
+		old, next interface{}
+	}{
+		{"port", old.Port, next.Port},
+		{"routesFile", old.RoutesFile, next.RoutesFile},
+		{"jwt", old.JWT, next.JWT},
+		{"introspection", old.Introspection, next.Introspection},
+		{"revocation", old.Revocation, next.Revocation},
+		{"apiKeys", old.APIKeys, next.APIKeys},
+		{"tls", old.TLS, next.TLS},
+		{"compensationJournal", old.CompensationJournal, next.CompensationJournal},
+	}
+	var changed []string
+	for _, sec := range sections {
+		if !reflect.DeepEqual(sec.old, sec.next) {
+			changed = append(changed, sec.name)
+		}
+	}
+	return changed
+}
+
+// Watch recarga la configuración al recibir SIGHUP y, si hay archivo,
+// cuando cambia su fecha de modificación (revisada cada interval).
+// Bloquea hasta que ctx se cancela.
+func (s *Store) Watch(ctx context.Context, interval time.Duration) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if s.path != "" && interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			s.Reload("sighup")
+		case <-tick:
+			if s.fileChanged() {
+				s.Reload("file")
+			}
+		}
+	}
+}
+
+func (s *Store) fileChanged() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.fileModTime().Equal(s.modTime)
+}
+
+func (s *Store) fileModTime() time.Time {
+	if s.path == "" {
+		return time.Time{}
+	}
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreReload_SwapsValidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	os.WriteFile(path, []byte("securityURL: http://sec-a:8080\nport: \"9000\"\n"), 0o644)
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if store.Current().SecurityURL != "http://sec-a:8080" {
+		t.Errorf("Expected SecurityURL 'http://sec-a:8080', got '%s'", store.Current().SecurityURL)
+	}
+
+	os.WriteFile(path, []byte("securityURL: http://sec-b:8080\nport: \"9000\"\n"), 0o644)
+	if err := store.Reload("test"); err != nil {
+		t.Fatalf("Expected reload to succeed, got %v", err)
+	}
+	if store.Current().SecurityURL != "http://sec-b:8080" {
+		t.Errorf("Expected SecurityURL 'http://sec-b:8080', got '%s'", store.Current().SecurityURL)
+	}
+	if st := store.Status(); !st.OK || st.Version != 2 {
+		t.Errorf("Expected ok status at version 2, got %+v", st)
+	}
+}
+
+func TestStoreReload_RejectsInvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.json")
+	os.WriteFile(path, []byte(`{"profileURL": "http://profile:8087"}`), 0o644)
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	before := store.Current()
+
+	os.WriteFile(path, []byte(`{"profileURL": "not a url"}`), 0o644)
+	if err := store.Reload("test"); err == nil {
+		t.Fatal("Expected reload to be rejected")
+	}
+	if store.Current() != before {
+		t.Error("Expected previous config to keep serving after rejected reload")
+	}
+	if st := store.Status(); st.OK || st.Error == "" || st.Version != 1 {
+		t.Errorf("Expected failed status still at version 1, got %+v", st)
+	}
+}
+
+func TestStoreReload_RejectsRestartOnlyChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	os.WriteFile(path, []byte("port: \"9000\"\napiKeys:\n  header: X-API-Key\n"), 0o644)
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	os.WriteFile(path, []byte("port: \"9000\"\napiKeys:\n  header: X-Client-Key\n"), 0o644)
+	err = store.Reload("test")
+	if err == nil || !strings.Contains(err.Error(), "apiKeys") {
+		t.Fatalf("Expected the apiKeys change to be rejected, got %v", err)
+	}
+	if store.Current().APIKeys.Header != "X-API-Key" {
+		t.Errorf("Expected the previous apiKeys to keep serving, got %s", store.Current().APIKeys.Header)
+	}
+}
+
+func TestStoreReload_RunsHooksBeforePublishing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	os.WriteFile(path, []byte("retryBudget: 3\n"), 0o644)
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	var seen []int
+	store.OnReload(func(old, next *Config) error {
+		seen = append(seen, *old.RetryBudget, *next.RetryBudget)
+		if *next.RetryBudget > 5 {
+			return errors.New("too many")
+		}
+		return nil
+	})
+
+	os.WriteFile(path, []byte("retryBudget: 5\n"), 0o644)
+	if err := store.Reload("test"); err != nil || *store.Current().RetryBudget != 5 {
+		t.Fatalf("Expected the reload to be applied, got %v", err)
+	}
+	os.WriteFile(path, []byte("retryBudget: 9\n"), 0o644)
+	if err := store.Reload("test"); err == nil || *store.Current().RetryBudget != 5 {
+		t.Errorf("Expected a failing hook to reject the reload, got %v", err)
+	}
+	if len(seen) != 4 || seen[0] != 3 || seen[1] != 5 || seen[3] != 9 {
+		t.Errorf("Expected the hook to see old and next, got %v", seen)
+	}
+}
+
+func TestLoad_EnvOverridesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	os.WriteFile(path, []byte("port: \"9000\"\n"), 0o644)
+	os.Setenv("PORT", "9100")
+	defer os.Unsetenv("PORT")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if cfg.Port != "9100" {
+		t.Errorf("Expected Port '9100', got '%s'", cfg.Port)
+	}
+}
+
+func TestLoad_UpstreamRetry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	os.WriteFile(path, []byte("upstreams:\n  profile:\n    retry:\n      maxAttempts: 4\n      retryOn: [\"503\", \"reset\"]\n"), 0o644)
+	os.Setenv("PROFILE_RETRY_BACKOFF", "250ms")
+	defer os.Unsetenv("PROFILE_RETRY_BACKOFF")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	retry := cfg.Upstream("profile").Retry
+	if retry.MaxAttempts != 4 || len(retry.RetryOn) != 2 || retry.Backoff.String() != "250ms" {
+		t.Errorf("Expected retry settings from file and env, got %+v", retry)
+	}
+	if *cfg.RetryBudget != 3 {
+		t.Errorf("Expected default retry budget 3, got %d", *cfg.RetryBudget)
+	}
+
+	os.WriteFile(path, []byte("upstreams:\n  profile:\n    retry:\n      retryOn: [\"200\", \"flaky\"]\n"), 0o644)
+	if _, err := Load(path); err == nil {
+		t.Error("Expected invalid retryOn entries to be rejected")
+	}
+}
+
+func TestLoad_RetryBudgetZeroDisablesRetries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	os.WriteFile(path, []byte("retryBudget: 0\n"), 0o644)
+
+	cfg, err := Load(path)
+	if err != nil || *cfg.RetryBudget != 0 {
+		t.Errorf("Expected an explicit retryBudget 0 to be kept, got %v (%v)", cfg.RetryBudget, err)
+	}
+
+	t.Setenv("RETRY_BUDGET", "0")
+	cfg, err = Load("")
+	if err != nil || *cfg.RetryBudget != 0 {
+		t.Errorf("Expected RETRY_BUDGET=0 to be kept, got %v (%v)", cfg.RetryBudget, err)
+	}
+}
+
+func TestLoad_BreakerWindowMinimum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	os.WriteFile(path, []byte("upstreams:\n  profile:\n    breaker:\n      window: 5ns\n"), 0o644)
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "upstreams.profile.breaker.window: must be at least 1s") {
+		t.Errorf("Expected a window under %v to be rejected, got %v", MinBreakerWindow, err)
+	}
+}
@@ -6,3 +6,5 @@ require (
 	github.com/golang-jwt/jwt/v5 v5.3.0
 	github.com/gorilla/mux v1.8.1
 )
+
+require gopkg.in/yaml.v3 v3.0.1
@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"servicio-gateway/apikey"
+)
+
+// APIKeys exportado para que main inyecte el almacén de API keys
+var APIKeys *apikey.Store
+
+// HandleAPIKeyUsage lista las API keys (sin hashes) con su contador de uso
+func HandleAPIKeyUsage(w http.ResponseWriter, r *http.Request) {
+	if APIKeys == nil {
+		WriteError(w, http.StatusServiceUnavailable, "apikeys_disabled", "api keys not configured")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": APIKeys.Usage(),
+	})
+}
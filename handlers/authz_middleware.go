@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"servicio-gateway/auth"
+	"servicio-gateway/authz"
+	"servicio-gateway/clientip"
+)
+
+// RequirePolicy devuelve el middleware que aplica p a cada petición.
+// Sin claims responde 401; si una regla falla, 403 con la regla en el cuerpo.
+func RequirePolicy(p authz.Policy) Middleware {
+	return Middleware{
+		Name: "authz(" + p.String() + ")",
+		Wrap: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				who, ok := auth.FromRequest(r)
+				if !ok {
+					WriteError(w, http.StatusUnauthorized, "unauthenticated", "authentication required")
+					return
+				}
+
+				err := authz.Evaluate(p, who, mux.Vars(r), CurrentConfig().Authz)
+				var denied *authz.Denied
+				if errors.As(err, &denied) {
+					log.Printf("[authz] denied %s %s from %s: %v\n", r.Method, r.URL.Path, clientip.FromRequest(r), denied)
+					WriteErrorDetails(w, http.StatusForbidden, "forbidden", denied.Reason, map[string]string{
+						"rule":    denied.Rule,
+						"subject": denied.Subject,
+					})
+					return
+				}
+
+				next.ServeHTTP(w, r)
+			})
+		},
+	}
+}
+
+// policyMiddleware devuelve RequirePolicy(p) o nada si p está vacía
+func policyMiddleware(p authz.Policy) []Middleware {
+	if p.Empty() {
+		return nil
+	}
+	return []Middleware{RequirePolicy(p)}
+}
+
+// AuthenticateWhen aplica authn solo a las peticiones para las que when es
+// true; las demás siguen sin identidad (una ruta pública con opciones que
+// exponen datos protegidos, como GET /users?include=profile)
+func AuthenticateWhen(when func(*http.Request) bool, authn Middleware) Middleware {
+	return Middleware{
+		Name: authn.Name + "(conditional)",
+		Wrap: func(next http.Handler) http.Handler {
+			authenticated := authn.Wrap(next)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if when(r) {
+					authenticated.ServeHTTP(w, r)
+					return
+				}
+				next.ServeHTTP(w, r)
+			})
+		},
+	}
+}
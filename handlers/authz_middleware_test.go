@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"servicio-gateway/auth"
+	"servicio-gateway/authz"
+)
+
+func TestRequirePolicy_ForbiddenBody(t *testing.T) {
+	r := mux.NewRouter()
+	NewRouteTable().Router(r).Handle("DELETE", "/users/{id}", "test", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not run for a non-owner")
+	}, RequirePolicy(authz.Policy{Owner: "id"}))
+
+	req := httptest.NewRequest("DELETE", "/users/42", nil)
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Subject: "7"}))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected 403, got %d", w.Code)
+	}
+	var body struct {
+		Code    string            `json:"error"`
+		Details map[string]string `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected JSON body, got %q", w.Body.String())
+	}
+	if body.Code != "forbidden" || body.Details["rule"] != "owner" || body.Details["subject"] != "7" {
+		t.Errorf("Unexpected body: %s", w.Body.String())
+	}
+}
+
+func TestRequirePolicy_NoClaims(t *testing.T) {
+	h := RequirePolicy(authz.Policy{Roles: []string{"admin"}}).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/admin/routes", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401, got %d", w.Code)
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"servicio-gateway/compensation"
+)
+
+// Compensations exportado para que main inyecte el journal de compensaciones
+// fallidas de PUT /users/{id}. Si es nil solo quedan en el log.
+var Compensations compensation.Journal
+
+// HandleListCompensations lista las compensaciones que no se pudieron aplicar
+func HandleListCompensations(w http.ResponseWriter, r *http.Request) {
+	if Compensations == nil {
+		WriteError(w, http.StatusServiceUnavailable, "compensations_disabled", "compensation journal not configured")
+		return
+	}
+	entries, err := Compensations.Entries()
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "journal_unreadable", err.Error())
+		return
+	}
+	if entries == nil {
+		entries = []compensation.Entry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries": entries,
+	})
+}
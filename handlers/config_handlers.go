@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"servicio-gateway/config"
+)
+
+// ConfigStore exportado para que main inyecte la configuración recargable.
+// Si es nil (tests, herramientas) se usa el entorno, leído una sola vez.
+var ConfigStore *config.Store
+
+// envConfig es la configuración del entorno cuando no hay ConfigStore
+var envConfig atomic.Pointer[config.Config]
+
+// CurrentConfig devuelve la configuración vigente para la petición en curso
+func CurrentConfig() *config.Config {
+	if ConfigStore != nil {
+		return ConfigStore.Current()
+	}
+	if cfg := envConfig.Load(); cfg != nil {
+		return cfg
+	}
+	cfg := config.LoadConfigFromEnv()
+	envConfig.CompareAndSwap(nil, &cfg)
+	return envConfig.Load()
+}
+
+// HandleConfigStatus responde con el resultado de la última recarga
+func HandleConfigStatus(w http.ResponseWriter, r *http.Request) {
+	if ConfigStore == nil {
+		http.Error(w, "config store not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"file":   ConfigStore.Path(),
+		"reload": ConfigStore.Status(),
+	})
+}
+
+// HandleConfigReload fuerza una recarga; si es inválida responde 422 y se
+// mantiene la configuración anterior.
+func HandleConfigReload(w http.ResponseWriter, r *http.Request) {
+	if ConfigStore == nil {
+		http.Error(w, "config store not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	status := http.StatusOK
+	if err := ConfigStore.Reload("admin"); err != nil {
+		status = http.StatusUnprocessableEntity
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"file":   ConfigStore.Path(),
+		"reload": ConfigStore.Status(),
+	})
+}
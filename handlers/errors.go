@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"servicio-gateway/client"
+)
+
+// ErrorBody es el cuerpo JSON común de todas las respuestas de error
+// generadas por el propio gateway (no las que vienen de un upstream).
+type ErrorBody struct {
+	Status  int         `json:"status"`
+	Code    string      `json:"error"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// WriteError responde status con un ErrorBody. code es un identificador
+// estable pensado para clientes (token_expired, forbidden, ...).
+func WriteError(w http.ResponseWriter, status int, code, message string) {
+	WriteErrorDetails(w, status, code, message, nil)
+}
+
+// WriteErrorDetails igual que WriteError pero con información adicional
+func WriteErrorDetails(w http.ResponseWriter, status int, code, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorBody{Status: status, Code: code, Message: message, Details: details})
+}
+
+// writeUpstreamError responde 502 cuando no se pudo hablar con un upstream,
+// distinguiendo un handshake TLS fallido de un error de conexión o de una
+// respuesta que no es JSON válido; 504 si se venció el deadline de la
+// petición, o 503 con Retry-After si ni se intentó porque su circuit
+// breaker está abierto
+func writeUpstreamError(w http.ResponseWriter, err error) {
+	var openErr *client.CircuitOpenError
+	if errors.As(err, &openErr) {
+		w.Header().Set("Retry-After", strconv.Itoa(client.RetryAfterSeconds(openErr.RetryAfter)))
+	}
+	status, code := upstreamErrorCode(err)
+	WriteError(w, status, code, err.Error())
+}
+
+// upstreamErrorCode es el status y el código con que se informa err
+func upstreamErrorCode(err error) (int, string) {
+	var openErr *client.CircuitOpenError
+	var tlsErr *client.TLSError
+	var jsonErr *invalidJSONError
+	switch {
+	case errors.As(err, &openErr):
+		return http.StatusServiceUnavailable, "upstream_circuit_open"
+	case errors.As(err, &tlsErr):
+		return http.StatusBadGateway, "upstream_tls_error"
+	case errors.As(err, &jsonErr):
+		return http.StatusBadGateway, "upstream_invalid_json"
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "upstream_timeout"
+	}
+	return http.StatusBadGateway, "upstream_unavailable"
+}
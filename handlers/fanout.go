@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+
+	"servicio-gateway/client"
+)
+
+// upstreamCall es una de las llamadas de un handler compuesto
+type upstreamCall struct {
+	Service string
+	Method  string
+	URL     string
+	Body    []byte
+	Headers http.Header
+	// Optional: si falla no cancela a las demás (respuesta parcial)
+	Optional bool
+}
+
+// upstreamResult es lo que devolvió una upstreamCall
+type upstreamResult struct {
+	Status  int
+	Body    []byte
+	Headers http.Header
+	Err     error
+}
+
+// fanOut hace las llamadas en paralelo con un deadline compartido
+// (CompositeTimeout) y devuelve los resultados en el mismo orden. El primer
+// error de transporte de una llamada no Optional cancela las hermanas y se
+// devuelve como err; las canceladas quedan con su propio Err (context.Canceled).
+func fanOut(ctx context.Context, calls ...upstreamCall) ([]upstreamResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, CurrentConfig().CompositeTimeout.Std())
+	defer cancel()
+
+	results := make([]upstreamResult, len(calls))
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	for i, call := range calls {
+		wg.Add(1)
+		go func(i int, call upstreamCall) {
+			defer wg.Done()
+
+			var body io.Reader
+			if call.Body != nil {
+				body = bytes.NewReader(call.Body)
+			}
+			status, respBody, headers, err := client.ProxyRequestContext(ctx, call.Service, call.Method, call.URL, body, call.Headers)
+			results[i] = upstreamResult{Status: status, Body: respBody, Headers: headers, Err: err}
+			if err != nil && !call.Optional {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i, call)
+	}
+	wg.Wait()
+
+	return results, firstErr
+}
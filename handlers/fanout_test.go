@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// delayedServer responde body después de delay (o antes, si se cancela la petición)
+func delayedServer(delay time.Duration, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(delay):
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(body))
+		case <-r.Context().Done():
+		}
+	}))
+}
+
+func TestHandleGetUserFull_CallsUpstreamsInParallel(t *testing.T) {
+	security := delayedServer(200*time.Millisecond, `{"id":"42","email":"a@example.com"}`)
+	defer security.Close()
+	profile := delayedServer(300*time.Millisecond, `{"firstName":"Ana"}`)
+	defer profile.Close()
+
+	setEnv(t, "SECURITY_URL", security.URL)
+	setEnv(t, "PROFILE_URL", profile.URL)
+
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/users/42", nil), map[string]string{"id": "42"})
+	w := httptest.NewRecorder()
+	start := time.Now()
+	HandleGetUserFull(w, req)
+	elapsed := time.Since(start)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	// en serie serían 500ms; en paralelo, lo que tarda el más lento
+	if elapsed >= 450*time.Millisecond {
+		t.Errorf("Expected latency close to the slower upstream (300ms), got %v", elapsed)
+	}
+	var merged map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &merged)
+	if merged["email"] != "a@example.com" || merged["firstName"] != "Ana" {
+		t.Errorf("Expected merged user, got %v", merged)
+	}
+}
+
+func TestFanOut_FailureCancelsSiblings(t *testing.T) {
+	started := make(chan struct{})
+	canceled := make(chan struct{}, 1)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-time.After(5 * time.Second):
+		case <-r.Context().Done():
+			canceled <- struct{}{}
+		}
+	}))
+	defer slow.Close()
+	// corta la conexión sin responder una vez que la llamada lenta está en curso
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-started
+		conn, _, _ := http.NewResponseController(w).Hijack()
+		conn.Close()
+	}))
+	defer broken.Close()
+
+	start := time.Now()
+	results, err := fanOut(httptest.NewRequest("GET", "/", nil).Context(),
+		upstreamCall{Service: "security", Method: "GET", URL: broken.URL, Headers: http.Header{}},
+		upstreamCall{Service: "profile", Method: "GET", URL: slow.URL, Headers: http.Header{}},
+	)
+
+	if err == nil || results[0].Err == nil {
+		t.Fatal("Expected the connection error to be returned")
+	}
+	if results[1].Err == nil {
+		t.Error("Expected the sibling call to be canceled")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected a fast failure, got %v", elapsed)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("Expected the slow upstream to see the cancellation")
+	}
+}
+
+func TestHandleGetUserFull_SharedDeadline(t *testing.T) {
+	security := delayedServer(10*time.Millisecond, `{"id":"42"}`)
+	defer security.Close()
+	profile := delayedServer(2*time.Second, `{}`)
+	defer profile.Close()
+
+	setEnv(t, "SECURITY_URL", security.URL)
+	setEnv(t, "PROFILE_URL", profile.URL)
+	setEnv(t, "COMPOSITE_TIMEOUT", "100ms")
+
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/users/42", nil), map[string]string{"id": "42"})
+	w := httptest.NewRecorder()
+	start := time.Now()
+	HandleGetUserFull(w, req)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 when the shared deadline expires, got %d", w.Code)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected to give up at the deadline, got %v", elapsed)
+	}
+}
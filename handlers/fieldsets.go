@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"servicio-gateway/config"
+)
+
+// fieldSelection es lo que pidió el cliente con ?fields= e ?include=
+type fieldSelection struct {
+	// fields: campos a devolver (nil = sin recortar)
+	fields []selectedField
+	// services: fuentes a las que hay que llamar
+	services map[string]bool
+}
+
+// selectedField es un path pedido ya resuelto contra el esquema
+type selectedField struct {
+	// path en el gateway (puede estar dentro de un campo: address.city)
+	path string
+	// upstream: el mismo path con el nombre que usa el upstream
+	upstream string
+	// from: fuentes de las que se lee
+	from []string
+}
+
+// parseSelection interpreta ?fields=a,b.c e ?include=profile (nil si no
+// vino ninguno). La fuente principal se llama siempre, porque es la que dice
+// si el usuario existe (404); además, sin fields, include elige qué otras
+// fuentes se llaman y, con fields, se llama a las dueñas de los campos
+// pedidos y a las incluidas, y la respuesta se recorta a esos campos más
+// todos los del esquema de cada fuente incluida.
+func (s userSchema) parseSelection(r *http.Request) (*fieldSelection, *selectionError) {
+	q := r.URL.Query()
+	fields, include := splitList(q.Get("fields")), splitList(q.Get("include"))
+	if fields == nil && include == nil {
+		return nil, nil
+	}
+
+	sel := &fieldSelection{services: map[string]bool{s.Sources[0].Service: true}}
+	included := map[string]bool{}
+	var unknownFields, unknownIncludes fieldErrors
+	for _, name := range include {
+		src, ok := s.source(name)
+		if !ok {
+			unknownIncludes.Unknown = append(unknownIncludes.Unknown, name)
+			continue
+		}
+		sel.services[src.Service] = true
+		included[src.Service] = true
+	}
+
+	if fields != nil {
+		for _, path := range fields {
+			resolved := s.resolveField(path)
+			if resolved == nil {
+				unknownFields.Unknown = append(unknownFields.Unknown, path)
+			}
+			sel.fields = append(sel.fields, resolved...)
+		}
+		// las fuentes incluidas aportan todos sus campos
+		for path, route := range s.Fields {
+			if included[route.Service] {
+				sel.fields = append(sel.fields, selectedField{path: path, upstream: route.UpstreamField(path), from: route.ReadFrom()})
+			}
+		}
+		for _, f := range sel.fields {
+			for _, service := range f.from {
+				sel.services[service] = true
+			}
+		}
+	}
+
+	switch {
+	case unknownIncludes.Unknown != nil:
+		return nil, &selectionError{code: "unknown_include", message: "unknown include: ", fields: unknownIncludes}
+	case unknownFields.Unknown != nil:
+		sort.Strings(unknownFields.Unknown)
+		return nil, &selectionError{code: "unknown_fields", message: "unknown fields: ", fields: unknownFields}
+	}
+	return sel, nil
+}
+
+// selectionError: ?fields= o ?include= nombran algo que el esquema no tiene
+type selectionError struct {
+	code, message string
+	fields        fieldErrors
+}
+
+func (e *selectionError) Error() string {
+	return e.message + strings.Join(e.fields.Unknown, ", ")
+}
+
+func (e *selectionError) write(w http.ResponseWriter) {
+	WriteErrorDetails(w, http.StatusBadRequest, e.code, e.Error(), e.fields)
+}
+
+// source busca una fuente por sección o por servicio
+func (s userSchema) source(name string) (config.CompositeSource, bool) {
+	for _, src := range s.Sources {
+		if src.SectionName() == name || src.Service == name {
+			return src, true
+		}
+	}
+	return config.CompositeSource{}, false
+}
+
+// resolveField resuelve path contra el esquema: un campo, algo dentro de un
+// campo (address.city si el campo es address) o un objeto que agrupa campos
+// (profile si hay profile.displayName). nil si no es nada de eso.
+func (s userSchema) resolveField(path string) []selectedField {
+	if route, ok := s.Fields[path]; ok {
+		return []selectedField{{path: path, upstream: route.UpstreamField(path), from: route.ReadFrom()}}
+	}
+	segs := strings.Split(path, ".")
+	for n := len(segs) - 1; n > 0; n-- {
+		field := strings.Join(segs[:n], ".")
+		if route, ok := s.Fields[field]; ok {
+			rest := strings.Join(segs[n:], ".")
+			return []selectedField{{path: path, upstream: route.UpstreamField(field) + "." + rest, from: route.ReadFrom()}}
+		}
+	}
+	var under []selectedField
+	for field, route := range s.Fields {
+		if strings.HasPrefix(field, path+".") {
+			under = append(under, selectedField{path: field, upstream: route.UpstreamField(field), from: route.ReadFrom()})
+		}
+	}
+	return under
+}
+
+// sources devuelve las fuentes a llamar, en el orden del esquema
+func (sel *fieldSelection) sources(s userSchema) []config.CompositeSource {
+	if sel == nil {
+		return s.Sources
+	}
+	var sources []config.CompositeSource
+	for _, src := range s.Sources {
+		if sel.services[src.Service] {
+			sources = append(sources, src)
+		}
+	}
+	return sources
+}
+
+// shape une docs según strategy y lo recorta a los campos pedidos. En nested
+// cada sección conserva solo los campos pedidos que lee de esa fuente; una
+// fuente sin campos pedidos (la principal, que se llama igual) no aparece.
+func (sel *fieldSelection) shape(s userSchema, strategy string, docs map[string]map[string]interface{}) map[string]interface{} {
+	if sel == nil || sel.fields == nil {
+		return s.merge(strategy, docs)
+	}
+
+	if strategy == config.MergeNested {
+		trimmed := map[string]map[string]interface{}{}
+		for _, f := range sel.fields {
+			for _, service := range f.from {
+				if _, ok := docs[service]; !ok {
+					continue
+				}
+				if trimmed[service] == nil {
+					trimmed[service] = map[string]interface{}{}
+				}
+				if v, ok := lookupPath(docs[service], f.upstream); ok {
+					setPath(trimmed[service], f.upstream, v)
+				}
+			}
+		}
+		return s.nested(trimmed)
+	}
+
+	full := s.flat(docs)
+	user := map[string]interface{}{}
+	for _, f := range sel.fields {
+		if v, ok := lookupPath(full, f.path); ok {
+			setPath(user, f.path, v)
+		}
+	}
+	return user
+}
+
+// splitList separa una lista por comas ignorando los vacíos (nil si no hay nada)
+func splitList(v string) []string {
+	var out []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// lookupPath devuelve el valor en la ruta con puntos path
+func lookupPath(m map[string]interface{}, path string) (interface{}, bool) {
+	segs := strings.Split(path, ".")
+	for _, seg := range segs[:len(segs)-1] {
+		child, ok := m[seg].(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		m = child
+	}
+	v, ok := m[segs[len(segs)-1]]
+	return v, ok
+}
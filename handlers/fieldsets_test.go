@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// countingServer es un jsonServer que cuenta las llamadas
+func countingServer(t *testing.T, body string) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func withQuery(q string) func(*http.Request) {
+	return func(r *http.Request) { r.URL.RawQuery = q }
+}
+
+func TestHandleGetUserFull_FieldsCallOnlyOwners(t *testing.T) {
+	security, securityCalls := countingServer(t, `{"id":"42","email":"a@example.com","username":"ana"}`)
+	profile, profileCalls := countingServer(t, `{"firstName":"Ana","bio":"hola"}`)
+
+	w := getUserFull(t, security.URL, profile.URL, "strict", withQuery("fields=email"))
+
+	if w.Code != http.StatusOK || w.Body.String() != `{"email":"a@example.com"}` {
+		t.Errorf("Expected only the email, got %d %s", w.Code, w.Body.String())
+	}
+	if securityCalls.Load() != 1 || profileCalls.Load() != 0 {
+		t.Errorf("Expected only security to be called, got %d/%d", securityCalls.Load(), profileCalls.Load())
+	}
+
+	w = getUserFull(t, security.URL, profile.URL, "strict", withQuery("fields=email,firstName"))
+	if w.Body.String() != `{"email":"a@example.com","firstName":"Ana"}` || profileCalls.Load() != 1 {
+		t.Errorf("Expected email and firstName from both upstreams, got %s", w.Body.String())
+	}
+}
+
+func TestHandleGetUserFull_IncludeProfile(t *testing.T) {
+	security, _ := countingServer(t, `{"id":"42","email":"a@example.com"}`)
+	profile, _ := countingServer(t, `{"firstName":"Ana","bio":"hola","internal":"x"}`)
+
+	w := getUserFull(t, security.URL, profile.URL, "strict", withQuery("fields=email&include=profile"))
+
+	// los campos del esquema de profile, no lo que profile trae fuera de él
+	if w.Body.String() != `{"bio":"hola","email":"a@example.com","firstName":"Ana"}` {
+		t.Errorf("Unexpected body %s", w.Body.String())
+	}
+
+	w = getUserFull(t, security.URL, profile.URL, "strict", withQuery("fields=firstName&merge=nested"))
+	if w.Body.String() != `{"profile":{"firstName":"Ana"}}` {
+		t.Errorf("Unexpected nested body %s", w.Body.String())
+	}
+}
+
+func TestHandleGetUserFull_FieldsAlwaysCheckPrimary(t *testing.T) {
+	security, securityCalls := countingServer(t, `{"id":"42","email":"a@example.com"}`)
+	profile, _ := countingServer(t, `{"firstName":"Ana","bio":"hola"}`)
+
+	w := getUserFull(t, security.URL, profile.URL, "strict", withQuery("fields=bio"))
+	if w.Code != http.StatusOK || w.Body.String() != `{"bio":"hola"}` || securityCalls.Load() != 1 {
+		t.Errorf("Expected security to be called but left out of the body, got %d %s", w.Code, w.Body.String())
+	}
+
+	missing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":"user not found"}`))
+	}))
+	defer missing.Close()
+	for _, mode := range []string{"strict", "partial"} {
+		w = getUserFull(t, missing.URL, profile.URL, mode, withQuery("fields=bio"))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("Expected 404 for a missing user in %s mode, got %d %s", mode, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHandleGetUserFull_UnknownFields(t *testing.T) {
+	security, securityCalls := countingServer(t, `{}`)
+	profile, _ := countingServer(t, `{}`)
+
+	w := getUserFull(t, security.URL, profile.URL, "strict", withQuery("fields=email,shoeSize,avatar.url,zip"))
+
+	var fields fieldErrors
+	body := ErrorBody{Details: &fields}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadRequest || body.Code != "unknown_fields" {
+		t.Fatalf("Expected 400 unknown_fields, got %d %s", w.Code, w.Body.String())
+	}
+	// avatar.url está dentro de un campo conocido
+	if len(fields.Unknown) != 2 || fields.Unknown[0] != "shoeSize" || fields.Unknown[1] != "zip" {
+		t.Errorf("Expected shoeSize and zip to be reported, got %v", fields.Unknown)
+	}
+	if securityCalls.Load() != 0 {
+		t.Error("Expected no upstream calls for a rejected request")
+	}
+
+	w = getUserFull(t, security.URL, profile.URL, "strict", withQuery("include=billing"))
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadRequest || body.Code != "unknown_include" {
+		t.Errorf("Expected 400 unknown_include, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUserSchema_ResolveNestedFields(t *testing.T) {
+	schema := testSchema()
+
+	sel, err := schema.parseSelection(httptest.NewRequest("GET", "/users/42?fields=profile.address,profile", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sel.services["profile"] || !sel.services["security"] || len(sel.services) != 2 {
+		t.Errorf("Expected profile and the primary source to be called, got %v", sel.services)
+	}
+
+	user := sel.shape(schema, "flat", map[string]map[string]interface{}{
+		"profile": {"name": "Ana", "address": map[string]interface{}{"city": "Lima"}},
+	})
+	if got := string(jsonMarshal(user)); got != `{"profile":{"address":{"city":"Lima"},"displayName":"Ana"}}` {
+		t.Errorf("Unexpected shape %s", got)
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"servicio-gateway/clientip"
+	"servicio-gateway/config"
+)
+
+// hopByHopHeaders son propios de cada conexión (RFC 7230 §6.1) y nunca se
+// reenvían, ni hacia el upstream ni de vuelta al cliente
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// stripHopByHop borra de h los headers hop-by-hop y los nombrados en Connection
+func stripHopByHop(h http.Header) {
+	for _, v := range h.Values("Connection") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				h.Del(name)
+			}
+		}
+	}
+	// "TE: trailers" indica que el cliente acepta trailers (gRPC lo exige)
+	keepTE := false
+	for _, v := range h.Values("Te") {
+		keepTE = keepTE || strings.EqualFold(strings.TrimSpace(v), "trailers")
+	}
+	for _, name := range hopByHopHeaders {
+		h.Del(name)
+	}
+	if keepTE {
+		h.Set("Te", "trailers")
+	}
+}
+
+// setForwardedHeaders agrega X-Forwarded-For/Proto/Host y Forwarded (RFC 7239).
+// Los valores que trae el cliente solo se conservan si la conexión viene de
+// un proxy confiable; si no, se reemplazan para que no se puedan falsificar.
+func setForwardedHeaders(h http.Header, r *http.Request, rs *clientip.Resolver) {
+	peer := clientip.PeerIP(r)
+	trusted := rs.FromTrustedProxy(r)
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	if !trusted {
+		h.Del("X-Forwarded-For")
+		h.Del("X-Forwarded-Proto")
+		h.Del("X-Forwarded-Host")
+		h.Del("Forwarded")
+	}
+
+	if prior := strings.Join(h.Values("X-Forwarded-For"), ", "); prior != "" {
+		h.Set("X-Forwarded-For", prior+", "+peer)
+	} else {
+		h.Set("X-Forwarded-For", peer)
+	}
+	if h.Get("X-Forwarded-Proto") == "" {
+		h.Set("X-Forwarded-Proto", proto)
+	}
+	if h.Get("X-Forwarded-Host") == "" {
+		h.Set("X-Forwarded-Host", r.Host)
+	}
+
+	element := "for=" + forwardedNode(peer) + ";host=" + quoteForwarded(r.Host) + ";proto=" + proto
+	if prior := strings.Join(h.Values("Forwarded"), ", "); prior != "" {
+		element = prior + ", " + element
+	}
+	h.Set("Forwarded", element)
+}
+
+// forwardedNode da formato a una IP para Forwarded: las IPv6 van entre
+// corchetes y comillas (for="[2001:db8::1]")
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+func quoteForwarded(v string) string {
+	if strings.ContainsAny(v, ":;,\" ") {
+		return `"` + strings.ReplaceAll(v, `"`, `\"`) + `"`
+	}
+	return v
+}
+
+type resolverEntry struct {
+	cfg      *config.Config
+	resolver *clientip.Resolver
+}
+
+var resolverCache atomic.Pointer[resolverEntry]
+
+// ClientIPResolver devuelve el resolver de la configuración vigente; se
+// rearma solo cuando la configuración cambia (recarga)
+func ClientIPResolver() *clientip.Resolver {
+	cfg := CurrentConfig()
+	if e := resolverCache.Load(); e != nil && e.cfg == cfg {
+		return e.resolver
+	}
+
+	rs, err := clientip.NewResolver(cfg.TrustedProxies)
+	if err != nil {
+		// Validate ya lo rechaza al cargar; por las dudas no se confía en nadie
+		log.Printf("[WARN] %v, no se confía en ningún proxy\n", err)
+		rs, _ = clientip.NewResolver(nil)
+	}
+	resolverCache.Store(&resolverEntry{cfg: cfg, resolver: rs})
+	return rs
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"servicio-gateway/clientip"
+)
+
+func TestStripHopByHop(t *testing.T) {
+	h := http.Header{}
+	h.Set("Connection", "keep-alive, X-Secret-Hop")
+	h.Set("Keep-Alive", "timeout=5")
+	h.Set("X-Secret-Hop", "1")
+	h.Set("Transfer-Encoding", "chunked")
+	h.Set("Te", "trailers")
+	h.Set("Content-Type", "application/json")
+
+	stripHopByHop(h)
+
+	for _, name := range []string{"Connection", "Keep-Alive", "X-Secret-Hop", "Transfer-Encoding"} {
+		if h.Get(name) != "" {
+			t.Errorf("Expected %s to be stripped", name)
+		}
+	}
+	if h.Get("Te") != "trailers" || h.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected TE: trailers and end-to-end headers to be kept, got %v", h)
+	}
+}
+
+func TestSetForwardedHeaders_UntrustedPeer(t *testing.T) {
+	rs, _ := clientip.NewResolver([]string{"10.0.0.0/8"})
+	req := httptest.NewRequest("GET", "http://gateway.example/users", nil)
+	req.RemoteAddr = "203.0.113.9:5000"
+	req.Header.Set("X-Forwarded-For", "6.6.6.6")
+	req.Header.Set("Forwarded", "for=6.6.6.6")
+
+	h := req.Header.Clone()
+	setForwardedHeaders(h, req, rs)
+
+	if got := h.Get("X-Forwarded-For"); got != "203.0.113.9" {
+		t.Errorf("Expected spoofed X-Forwarded-For to be replaced, got '%s'", got)
+	}
+	if got := h.Get("Forwarded"); got != "for=203.0.113.9;host=gateway.example;proto=http" {
+		t.Errorf("Expected fresh Forwarded, got '%s'", got)
+	}
+	if h.Get("X-Forwarded-Host") != "gateway.example" || h.Get("X-Forwarded-Proto") != "http" {
+		t.Errorf("Expected host and proto, got %v", h)
+	}
+}
+
+func TestSetForwardedHeaders_TrustedProxyAppends(t *testing.T) {
+	rs, _ := clientip.NewResolver([]string{"10.0.0.0/8"})
+	req := httptest.NewRequest("GET", "http://gateway.example:8088/users", nil)
+	req.RemoteAddr = "10.0.0.2:80"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("Forwarded", "for=198.51.100.7;proto=https")
+
+	h := req.Header.Clone()
+	setForwardedHeaders(h, req, rs)
+
+	if got := h.Get("X-Forwarded-For"); got != "198.51.100.7, 10.0.0.2" {
+		t.Errorf("Expected proxy IP appended, got '%s'", got)
+	}
+	if got := h.Get("X-Forwarded-Proto"); got != "https" {
+		t.Errorf("Expected proto from trusted proxy, got '%s'", got)
+	}
+	want := `for=198.51.100.7;proto=https, for=10.0.0.2;host="gateway.example:8088";proto=http`
+	if got := h.Get("Forwarded"); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestCopyHeaders_StripsHopByHop(t *testing.T) {
+	src := http.Header{}
+	src.Set("Connection", "close")
+	src.Set("Keep-Alive", "timeout=5")
+	src.Set("X-Request-Id", "abc")
+	dst := http.Header{}
+
+	CopyHeaders(dst, src)
+
+	if dst.Get("Connection") != "" || dst.Get("Keep-Alive") != "" || dst.Get("X-Request-Id") != "abc" {
+		t.Errorf("Expected only end-to-end headers, got %v", dst)
+	}
+	if src.Get("Connection") != "close" {
+		t.Error("Expected source headers to be left untouched")
+	}
+}
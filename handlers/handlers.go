@@ -1,123 +1,173 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
 	"io/ioutil"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
 
+	"servicio-gateway/auth"
 	"servicio-gateway/client"
-	"servicio-gateway/config"
 )
 
 // MAKE PROXY FOR SECURITY SERVICE
 func MakeProxyToSecurity(method, path string) http.HandlerFunc {
+	return MakeProxy("security", method, path)
+}
+
+// MAKE PROXY FOR ANY NAMED UPSTREAM SERVICE (see config.ServiceURL)
+func MakeProxy(service, method, path string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		cfg := config.LoadConfigFromEnv()
+		cfg := CurrentConfig()
+
+		baseURL, ok := cfg.ServiceURL(service)
+		if !ok {
+			http.Error(w, "unknown upstream service: "+service, http.StatusBadGateway)
+			return
+		}
 
 		// Build dynamic URL
-		target := strings.TrimRight(cfg.SecurityURL, "/") + path
+		target := strings.TrimRight(baseURL, "/") + path
 
 		// Replace path vars: {id}
 		for k, v := range mux.Vars(r) {
 			target = strings.Replace(target, "{"+k+"}", v, 1)
 		}
 
-		status, body, headers, err := client.ProxyRequest(method, target, r.Body, r.Header)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadGateway)
-			return
-		}
-
-		CopyHeaders(w.Header(), headers)
-		w.WriteHeader(status)
-		w.Write(body)
+		proxyStream(w, r, service, method, target)
 	}
 }
 
 // DELETE USER → SEND EVENT user.deleted
 func HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
-	cfg := config.LoadConfigFromEnv()
+	cfg := CurrentConfig()
 	id := mux.Vars(r)["id"]
 
 	target := strings.TrimRight(cfg.SecurityURL, "/") + "/api/v1/users/" + id
 
-	status, body, headers, err := client.ProxyRequest("DELETE", target, nil, r.Header)
+	status, body, headers, err := client.ProxyRequestContext(r.Context(), "security", "DELETE", target, nil, upstreamHeaders(r, "security"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadGateway)
+		writeUpstreamError(w, err)
 		return
 	}
 
-	// If deleted successfully → publish event (pass URL)
+	// If deleted successfully → revoke its tokens and publish event (pass URL)
 	if status >= 200 && status < 300 {
+		revokeSubject(id, "user.deleted")
+
+		payload := map[string]interface{}{
+			"userId": id,
+		}
+		// Who performed the deletion (the owner or an admin)
+		if who, ok := auth.FromRequest(r); ok {
+			payload["deletedBy"] = map[string]interface{}{
+				"userId": who.Subject,
+				"email":  who.Email,
+				"roles":  who.Roles,
+			}
+		}
 		event := map[string]interface{}{
-			"type": "user.deleted",
-			"payload": map[string]interface{}{
-				"userId": id,
-			},
+			"type":    "user.deleted",
+			"payload": payload,
 		}
 		_ = client.PostEvent(cfg.EventBusURL, event)
 	}
 
 	CopyHeaders(w.Header(), headers)
+	// el cuerpo ya está leído: su largo real manda sobre el que dijo el upstream
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
 	w.WriteHeader(status)
 	w.Write(body)
 }
 
-// GET USER FULL → MERGE SECURITY + PROFILE
+// GET USER FULL → MERGE THE COMPOSITE USER SOURCES (all calls in parallel,
+// fields placed according to config.CompositeUser, shape per mergeStrategy,
+// only the sources owning ?fields= / ?include= are called, see parseSelection).
+// In partial mode a failing optional source (profile) degrades to the rest
+// plus a _meta section instead of failing the whole request.
 func HandleGetUserFull(w http.ResponseWriter, r *http.Request) {
-	cfg := config.LoadConfigFromEnv()
+	cfg := CurrentConfig()
+	schema := userSchema{cfg.CompositeUser}
 	id := mux.Vars(r)["id"]
 
-	// SECURITY USER
-	secURL := strings.TrimRight(cfg.SecurityURL, "/") + "/api/v1/users/" + id
-	statusS, bodyS, _, errS := client.ProxyRequest("GET", secURL, nil, r.Header)
-	if errS != nil {
-		http.Error(w, errS.Error(), http.StatusBadGateway)
+	strategy, err := mergeStrategy(w, r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_merge", err.Error())
 		return
 	}
-
-	// PROFILE USER
-	profURL := strings.TrimRight(cfg.ProfileURL, "/") + "/api/v1/profiles/" + id
-	statusP, bodyP, _, errP := client.ProxyRequest("GET", profURL, nil, r.Header)
-	if errP != nil {
-		http.Error(w, errP.Error(), http.StatusBadGateway)
+	sel, selErr := schema.parseSelection(r)
+	if selErr != nil {
+		selErr.write(w)
 		return
 	}
+	partial := allowPartial(w, r)
 
-	if statusS == http.StatusNotFound || statusP == http.StatusNotFound {
-		w.WriteHeader(http.StatusNotFound)
-		if statusS == http.StatusNotFound {
-			w.Write(bodyS)
-		} else {
-			w.Write(bodyP)
+	sources := sel.sources(schema)
+	calls := make([]upstreamCall, len(sources))
+	for i, src := range sources {
+		calls[i] = upstreamCall{
+			Service: src.Service, Method: "GET",
+			URL:      cfg.SourceURL(src, id),
+			Headers:  upstreamHeaders(r, src.Service),
+			Optional: partial && src.Optional,
 		}
+	}
+	results, err := fanOut(r.Context(), calls...)
+	if err != nil {
+		writeUpstreamError(w, err)
 		return
 	}
 
-	var mS, mP map[string]interface{}
-	json.Unmarshal(bodyS, &mS)
-	json.Unmarshal(bodyP, &mP)
-
-	for k, v := range mP {
-		if _, ok := mS[k]; !ok {
-			mS[k] = v
+	var failed []sourceFailure
+	docs := map[string]map[string]interface{}{}
+	for i, src := range sources {
+		res := results[i]
+		f := failureOf(src.Service, res)
+		if f == nil && res.Status == http.StatusNotFound {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(res.Body)
+			return
+		}
+		doc, err := decodeSource(src.Service, res.Body)
+		if f == nil && err != nil {
+			_, code := upstreamErrorCode(err)
+			f = &sourceFailure{Source: src.Service, Error: code, Message: err.Error()}
 		}
+		if f == nil {
+			docs[src.Service] = doc
+			continue
+		}
+		if !calls[i].Optional {
+			if err != nil {
+				writeUpstreamError(w, err)
+				return
+			}
+			// 5xx de una fuente obligatoria: se une lo que vino, como siempre
+			docs[src.Service] = doc
+			continue
+		}
+		log.Printf("[proxy] GET /users/%s: partial response, %s failed: %s\n", id, f.Source, f.Message)
+		failed = append(failed, *f)
 	}
 
-	out, _ := json.Marshal(mS)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(200)
-	w.Write(out)
+	user := sel.shape(schema, strategy, docs)
+	if len(failed) > 0 {
+		user["_meta"] = partialMeta{Partial: true, Failed: failed}
+		w.Header().Set(partialHeader, "true")
+	}
+	writeComposite(w, strategy, user)
 }
 
-// UPDATE USER FULL → SPLIT DATA INTO SECURITY + PROFILE
+// UPDATE USER FULL → SPLIT DATA BETWEEN THE COMPOSITE USER SOURCES (see
+// userSchema.split) AND APPLY IT AS A SAGA (see runUpdateSaga)
 func HandleUpdateUserFull(w http.ResponseWriter, r *http.Request) {
-	cfg := config.LoadConfigFromEnv()
+	cfg := CurrentConfig()
+	schema := userSchema{cfg.CompositeUser}
 	id := mux.Vars(r)["id"]
 
 	bodyBytes, err := ioutil.ReadAll(r.Body)
@@ -131,74 +181,53 @@ func HandleUpdateUserFull(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid json", http.StatusBadRequest)
 		return
 	}
-
-	securityKeys := map[string]bool{
-		"email": true, "username": true, "password": true,
-	}
-	profileKeys := map[string]bool{
-		"firstName": true, "lastName": true, "bio": true,
-		"avatar": true, "address": true, "phone": true,
-	}
-
-	secPart := map[string]interface{}{}
-	profPart := map[string]interface{}{}
-
-	for k, v := range payload {
-		if securityKeys[k] {
-			secPart[k] = v
-		} else if profileKeys[k] {
-			profPart[k] = v
-		} else {
-			secPart[k] = v
-			profPart[k] = v
-		}
+	// el cuerpo de un GET reenviado tal cual trae el id: se acepta (y no se
+	// manda a los upstreams) si es el de la URL; otro id sigue siendo read-only
+	if idField := cfg.CompositeUser.List.IDField; sameID(payload[idField], id) {
+		delete(payload, idField)
 	}
 
-	// SECURITY UPDATE
-	secURL := strings.TrimRight(cfg.SecurityURL, "/") + "/api/v1/users/" + id
-	secBody := jsonMarshal(secPart)
-	statusS, bodyS, _, errS := client.ProxyRequest("PUT", secURL, bytes.NewReader(secBody), r.Header)
-	if errS != nil {
-		http.Error(w, errS.Error(), http.StatusBadGateway)
+	strategy, err := mergeStrategy(w, r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_merge", err.Error())
 		return
 	}
 
-	// PROFILE UPDATE
-	profURL := strings.TrimRight(cfg.ProfileURL, "/") + "/api/v1/profiles/" + id
-	profBody := jsonMarshal(profPart)
-	statusP, bodyP, _, errP := client.ProxyRequest("PUT", profURL, bytes.NewReader(profBody), r.Header)
-	if errP != nil {
-		http.Error(w, errP.Error(), http.StatusBadGateway)
+	parts, fieldErrs := schema.split(payload)
+	if len(fieldErrs.Unknown) > 0 {
+		WriteErrorDetails(w, http.StatusBadRequest, "unknown_fields",
+			"unknown fields: "+strings.Join(fieldErrs.Unknown, ", "), fieldErrs)
 		return
 	}
-
-	if statusS >= 200 && statusS < 300 && statusP >= 200 && statusP < 300 {
-		var mS, mP map[string]interface{}
-		json.Unmarshal(bodyS, &mS)
-		json.Unmarshal(bodyP, &mP)
-		for k, v := range mP {
-			if _, ok := mS[k]; !ok {
-				mS[k] = v
-			}
-		}
-		out := jsonMarshal(mS)
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(200)
-		w.Write(out)
+	if len(fieldErrs.ReadOnly) > 0 {
+		WriteErrorDetails(w, http.StatusBadRequest, "read_only_fields",
+			"read-only fields: "+strings.Join(fieldErrs.ReadOnly, ", "), fieldErrs)
 		return
 	}
 
-	if statusS >= 400 {
-		w.WriteHeader(statusS)
-		w.Write(bodyS)
-		return
+	steps := make([]*updateStep, len(schema.Sources))
+	for i, src := range schema.Sources {
+		steps[i] = &updateStep{Service: src.Service, URL: cfg.SourceURL(src, id), Part: parts[src.Service]}
 	}
-	w.WriteHeader(statusP)
-	w.Write(bodyP)
+	runUpdateSaga(w, r, steps, func(w http.ResponseWriter, bodies map[string][]byte) {
+		user, err := schema.compose(strategy, bodies)
+		if err != nil {
+			// el update ya se aplicó (X-Update-Status: applied), solo falla la respuesta
+			writeUpstreamError(w, err)
+			return
+		}
+		writeComposite(w, strategy, user)
+	})
 }
 
 // UTILS
+
+// CopyHeaders copia los headers de una respuesta upstream hacia el cliente,
+// salvo los hop-by-hop (y los nombrados en su Connection)
 func CopyHeaders(dst, src http.Header) {
+	src = src.Clone()
+	stripHopByHop(src)
+	src.Del("Te")
 	for k, v := range src {
 		for _, h := range v {
 			dst.Add(k, h)
@@ -4,42 +4,25 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
-	"servicio-gateway/client"
-	"servicio-gateway/config"
+	"servicio-gateway/authz"
 )
 
-func RegisterProfileRoutes(r *mux.Router) {
-	r.HandleFunc("/profiles/{id}", func(w http.ResponseWriter, r *http.Request) {
+func RegisterProfileRoutes(g *Registrar) {
+	g.Handle("GET", "/profiles/{id}", "profile:/api/v1/profiles/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id := mux.Vars(r)["id"]
 
-		cfg := config.LoadConfigFromEnv()
+		cfg := CurrentConfig()
 		target := cfg.ProfileURL + "/api/v1/profiles/" + id
 
-		status, body, headers, err := client.ProxyRequest("GET", target, nil, r.Header)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadGateway)
-			return
-		}
+		proxyStream(w, r, "profile", "GET", target)
+	})
 
-		CopyHeaders(w.Header(), headers)
-		w.WriteHeader(status)
-		w.Write(body)
-	}).Methods("GET")
-
-	r.HandleFunc("/profiles/{id}", func(w http.ResponseWriter, r *http.Request) {
+	g.Handle("PUT", "/profiles/{id}", "profile:/api/v1/profiles/{id}", func(w http.ResponseWriter, r *http.Request) {
 		id := mux.Vars(r)["id"]
 
-		cfg := config.LoadConfigFromEnv()
+		cfg := CurrentConfig()
 		target := cfg.ProfileURL + "/api/v1/profiles/" + id
 
-		status, body, headers, err := client.ProxyRequest("PUT", target, r.Body, r.Header)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadGateway)
-			return
-		}
-
-		CopyHeaders(w.Header(), headers)
-		w.WriteHeader(status)
-		w.Write(body)
-	}).Methods("PUT")
+		proxyStream(w, r, "profile", "PUT", target)
+	}, RequirePolicy(authz.Policy{Owner: "id"}))
 }
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"servicio-gateway/auth"
+	"servicio-gateway/client"
+)
+
+func TestHandleDeleteUser_EventIncludesActor(t *testing.T) {
+	var deleted string
+	security := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deleted = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer security.Close()
+
+	events := make(chan map[string]interface{}, 1)
+	bus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ev map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&ev)
+		events <- ev
+	}))
+	defer bus.Close()
+
+	setEnv(t, "SECURITY_URL", security.URL+"/")
+	setEnv(t, "EVENT_BUS_URL", bus.URL)
+
+	req := httptest.NewRequest("DELETE", "/users/42", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "42"})
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{
+		Subject: "1", Email: "admin@example.com", Roles: []string{"admin"},
+	}))
+	w := httptest.NewRecorder()
+	HandleDeleteUser(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	if deleted != "/api/v1/users/42" {
+		t.Errorf("Expected DELETE /api/v1/users/42, got %s", deleted)
+	}
+	ev := <-events
+	payload := ev["payload"].(map[string]interface{})
+	actor, ok := payload["deletedBy"].(map[string]interface{})
+	if !ok || actor["userId"] != "1" || actor["email"] != "admin@example.com" {
+		t.Errorf("Expected deletedBy actor in event, got %v", payload)
+	}
+}
+
+func TestWriteUpstreamError_CircuitOpen(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeUpstreamError(w, &client.CircuitOpenError{Upstream: "security", RetryAfter: 1500 * time.Millisecond})
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", w.Header().Get("Retry-After"))
+	}
+	var body ErrorBody
+	json.NewDecoder(w.Body).Decode(&body)
+	if body.Code != "upstream_circuit_open" {
+		t.Errorf("Expected upstream_circuit_open, got %q", body.Code)
+	}
+}
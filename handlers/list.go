@@ -0,0 +1,436 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+
+	"servicio-gateway/auth"
+	"servicio-gateway/client"
+	"servicio-gateway/config"
+)
+
+// listItemsFields son los campos donde se buscan los items de un listado
+// cuando compositeUser.list.itemsField está vacío
+var listItemsFields = []string{"data", "items", "content", "users", "results"}
+
+// itemFailure describe una fuente que falló para un item del listado
+type itemFailure struct {
+	ID string `json:"id"`
+	sourceFailure
+}
+
+// itemDoc es lo que una fuente devolvió para un usuario del listado
+type itemDoc struct {
+	// doc es nil si la fuente no lo tiene (404 o ausente del bulk)
+	doc     map[string]interface{}
+	failure *sourceFailure
+}
+
+// ListIncludesOtherSources indica si ?include= nombra alguna fuente además
+// de la principal: esas son las que exigen autenticación en GET /users
+func ListIncludesOtherSources(r *http.Request) bool {
+	schema := currentUserSchema()
+	for _, name := range splitList(r.URL.Query().Get("include")) {
+		if src, ok := schema.source(name); ok && src.Service != schema.Sources[0].Service {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleListUsers: GET /users. Sin ?include= es un paso directo al listado
+// de la fuente principal; con ?include=profile cada usuario de la página se
+// une a su documento en las fuentes incluidas (ver enrichList), lo que exige
+// una identidad verificada. La paginación del cuerpo y los headers (Link,
+// X-Total-Count, ...) se conservan.
+func HandleListUsers(w http.ResponseWriter, r *http.Request) {
+	cfg := CurrentConfig()
+	schema := userSchema{cfg.CompositeUser}
+	primary := schema.Sources[0]
+
+	query := r.URL.Query()
+	include := splitList(query.Get("include"))
+	rawQuery := r.URL.RawQuery
+	// la API key por query (apiKeys.queryParam) tampoco llega al upstream
+	if key := cfg.APIKeys.QueryParam; key != "" && query.Has(key) {
+		query.Del(key)
+		rawQuery = query.Encode()
+	}
+	if include == nil {
+		target := cfg.ListURL()
+		if rawQuery != "" {
+			target += "?" + rawQuery
+		}
+		proxyStream(w, r, primary.Service, "GET", target)
+		return
+	}
+
+	strategy, err := mergeStrategy(w, r)
+	if err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_merge", err.Error())
+		return
+	}
+	var sources []config.CompositeSource
+	var unknown fieldErrors
+	for _, name := range include {
+		src, ok := schema.source(name)
+		switch {
+		case !ok:
+			unknown.Unknown = append(unknown.Unknown, name)
+		case src.Service != primary.Service:
+			sources = append(sources, src)
+		}
+	}
+	if unknown.Unknown != nil {
+		(&selectionError{code: "unknown_include", message: "unknown include: ", fields: unknown}).write(w)
+		return
+	}
+	// el listado es público pero los documentos de las demás fuentes (perfiles)
+	// no: sin identidad verificada no se incluyen
+	if _, ok := auth.FromRequest(r); !ok && len(sources) > 0 {
+		WriteError(w, http.StatusUnauthorized, "unauthenticated", "authentication required to include "+sources[0].SectionName())
+		return
+	}
+
+	// los parámetros del gateway no viajan al upstream; sí en los Link
+	own := url.Values{}
+	for _, k := range []string{"include", "merge"} {
+		if v, ok := query[k]; ok {
+			own[k] = v
+			query.Del(k)
+		}
+	}
+	target := cfg.ListURL()
+	if enc := query.Encode(); enc != "" {
+		target += "?" + enc
+	}
+
+	status, body, headers, err := client.ProxyRequestContext(r.Context(), primary.Service, "GET", target, nil, upstreamHeaders(r, primary.Service))
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	if status < 200 || status >= 300 {
+		CopyHeaders(w.Header(), headers)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(status)
+		w.Write(body)
+		return
+	}
+
+	page, items, err := decodeList(primary.Service, body, cfg.CompositeUser.List.ItemsField)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+
+	enriched, failed := enrichList(r, cfg, schema, strategy, items, sources)
+	if len(failed) > 0 {
+		log.Printf("[proxy] GET /users: %d item lookups failed\n", len(failed))
+		if cfg.CompositeUser.List.ItemFailure == config.ItemFailureFail {
+			WriteErrorDetails(w, http.StatusBadGateway, "list_enrichment_failed",
+				fmt.Sprintf("%d item lookups failed", len(failed)), failed)
+			return
+		}
+		w.Header().Set(partialHeader, "true")
+	}
+
+	var out interface{} = enriched
+	if page != nil {
+		page.set(enriched)
+		out = page.doc
+	}
+
+	CopyHeaders(w.Header(), headers)
+	w.Header().Del("Content-Length")
+	w.Header().Del("Content-Encoding")
+	if links := w.Header().Values("Link"); len(links) > 0 {
+		w.Header().Del("Link")
+		for _, l := range links {
+			w.Header().Add("Link", keepParams(l, own))
+		}
+	}
+	contentType := "application/json"
+	if strategy == config.MergeNested {
+		contentType = `application/json; profile="nested"`
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonMarshal(out))
+}
+
+// enrichList busca el documento de cada item en sources y une cada item
+// según strategy. Un item con alguna fuente fallida lleva su _meta.
+func enrichList(r *http.Request, cfg *config.Config, schema userSchema, strategy string,
+	items []map[string]interface{}, sources []config.CompositeSource) ([]map[string]interface{}, []itemFailure) {
+
+	primary := schema.Sources[0].Service
+	idField := cfg.CompositeUser.List.IDField
+
+	ids := make([]string, len(items))
+	var unique []string
+	seen := map[string]bool{}
+	for i, item := range items {
+		if v, ok := item[idField]; ok && v != nil {
+			ids[i] = fmt.Sprint(v)
+		}
+		if ids[i] != "" && !seen[ids[i]] {
+			seen[ids[i]] = true
+			unique = append(unique, ids[i])
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), cfg.CompositeTimeout.Std())
+	defer cancel()
+
+	found := make([]map[string]itemDoc, len(sources))
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		go func(i int, src config.CompositeSource) {
+			defer wg.Done()
+			if src.BulkPath != "" {
+				found[i] = fetchBulk(ctx, r, cfg, src, unique)
+			} else {
+				found[i] = fetchEach(ctx, r, cfg, src, unique)
+			}
+		}(i, src)
+	}
+	wg.Wait()
+
+	out := make([]map[string]interface{}, len(items))
+	var failed []itemFailure
+	for i, item := range items {
+		docs := map[string]map[string]interface{}{primary: item}
+		var itemFailed []sourceFailure
+		for j, src := range sources {
+			res := found[j][ids[i]]
+			switch {
+			case res.failure != nil:
+				itemFailed = append(itemFailed, *res.failure)
+				failed = append(failed, itemFailure{ID: ids[i], sourceFailure: *res.failure})
+			case res.doc != nil:
+				// merge consume el documento y un id repetido en la página lo comparte
+				docs[src.Service] = cloneDoc(res.doc)
+			}
+		}
+		out[i] = schema.merge(strategy, docs)
+		if itemFailed != nil {
+			out[i]["_meta"] = partialMeta{Partial: true, Failed: itemFailed}
+		}
+	}
+	return out, failed
+}
+
+// cloneDoc copia doc en profundidad (objetos y arrays JSON)
+func cloneDoc(doc map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		out[k] = cloneValue(v)
+	}
+	return out
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return cloneDoc(v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = cloneValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+// fetchEach pide el documento de cada id a src, hasta list.concurrency a la vez
+func fetchEach(ctx context.Context, r *http.Request, cfg *config.Config, src config.CompositeSource, ids []string) map[string]itemDoc {
+	headers := upstreamHeaders(r, src.Service)
+	sem := make(chan struct{}, cfg.CompositeUser.List.Concurrency)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	found := map[string]itemDoc{}
+	for _, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id string) {
+			defer func() { <-sem; wg.Done() }()
+
+			status, body, respHeaders, err := client.ProxyRequestContext(ctx, src.Service, "GET", cfg.SourceURL(src, id), nil, headers)
+			res := listItemDoc(src.Service, upstreamResult{Status: status, Body: body, Headers: respHeaders, Err: err})
+			mu.Lock()
+			found[id] = res
+			mu.Unlock()
+		}(id)
+	}
+	wg.Wait()
+	return found
+}
+
+// fetchBulk pide los ids a src.BulkPath de a list.batchSize, hasta
+// list.concurrency lotes a la vez. Un lote fallido marca todos sus ids.
+func fetchBulk(ctx context.Context, r *http.Request, cfg *config.Config, src config.CompositeSource, ids []string) map[string]itemDoc {
+	headers := upstreamHeaders(r, src.Service)
+	list := cfg.CompositeUser.List
+	idField := src.BulkIDField
+	if idField == "" {
+		idField = "id"
+	}
+	sem := make(chan struct{}, list.Concurrency)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	found := map[string]itemDoc{}
+	for start := 0; start < len(ids); start += list.BatchSize {
+		end := start + list.BatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(batch []string) {
+			defer func() { <-sem; wg.Done() }()
+
+			status, body, respHeaders, err := client.ProxyRequestContext(ctx, src.Service, "GET", cfg.SourceBulkURL(src, batch), nil, headers)
+			res := upstreamResult{Status: status, Body: body, Headers: respHeaders, Err: err}
+			var docs []map[string]interface{}
+			f := listFailure(src.Service, res)
+			if f == nil {
+				if _, docs, err = decodeList(src.Service, body, ""); err != nil {
+					_, code := upstreamErrorCode(err)
+					f = &sourceFailure{Source: src.Service, Error: code, Message: err.Error()}
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			for _, id := range batch {
+				found[id] = itemDoc{failure: f}
+			}
+			for _, doc := range docs {
+				if v, ok := doc[idField]; ok && v != nil {
+					found[fmt.Sprint(v)] = itemDoc{doc: doc}
+				}
+			}
+		}(batch)
+	}
+	wg.Wait()
+	return found
+}
+
+// listItemDoc interpreta la respuesta de src para un item: 404 es que no lo tiene
+func listItemDoc(service string, res upstreamResult) itemDoc {
+	if res.Err == nil && res.Status == http.StatusNotFound {
+		return itemDoc{}
+	}
+	if f := listFailure(service, res); f != nil {
+		return itemDoc{failure: f}
+	}
+	doc, err := decodeSource(service, res.Body)
+	if err != nil {
+		_, code := upstreamErrorCode(err)
+		return itemDoc{failure: &sourceFailure{Source: service, Error: code, Message: err.Error()}}
+	}
+	return itemDoc{doc: doc}
+}
+
+// listFailure es failureOf más los 4xx: en un listado no hay a quién devolverlos
+func listFailure(service string, res upstreamResult) *sourceFailure {
+	if f := failureOf(service, res); f != nil {
+		return f
+	}
+	if res.Status >= 400 {
+		return &sourceFailure{Source: service, Error: "upstream_error", Message: fmt.Sprintf("%s responded %d", service, res.Status)}
+	}
+	return nil
+}
+
+// listPage es el cuerpo de un listado paginado: un objeto con los items en key
+type listPage struct {
+	doc map[string]interface{}
+	key string
+}
+
+func (p *listPage) set(items []map[string]interface{}) {
+	p.doc[p.key] = items
+}
+
+// decodeList separa el listado que devolvió service en la página (nil si el
+// cuerpo es directamente un array) y sus items. Los números se conservan tal
+// cual (ids grandes).
+func decodeList(service string, body []byte, itemsField string) (*listPage, []map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var raw interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, nil, &invalidJSONError{Service: service, Err: err}
+	}
+
+	var page *listPage
+	list, isArray := raw.([]interface{})
+	if !isArray {
+		doc, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil, nil, &invalidJSONError{Service: service, Err: errors.New("expected a list or an object")}
+		}
+		keys := listItemsFields
+		if itemsField != "" {
+			keys = []string{itemsField}
+		}
+		for _, k := range keys {
+			if list, isArray = doc[k].([]interface{}); isArray {
+				page = &listPage{doc: doc, key: k}
+				break
+			}
+		}
+		if page == nil {
+			return nil, nil, &invalidJSONError{Service: service, Err: fmt.Errorf("no list of items found in %v", keys)}
+		}
+	}
+
+	items := make([]map[string]interface{}, len(list))
+	for i, v := range list {
+		item, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, nil, &invalidJSONError{Service: service, Err: fmt.Errorf("item %d is not an object", i)}
+		}
+		items[i] = item
+	}
+	return page, items, nil
+}
+
+var linkURLRe = regexp.MustCompile(`<([^>]*)>`)
+
+// keepParams agrega params a cada URL de un header Link para que las
+// páginas siguientes se pidan igual (p.ej. con include=profile)
+func keepParams(link string, params url.Values) string {
+	if len(params) == 0 {
+		return link
+	}
+	return linkURLRe.ReplaceAllStringFunc(link, func(m string) string {
+		u, err := url.Parse(m[1 : len(m)-1])
+		if err != nil {
+			return m
+		}
+		q := u.Query()
+		for k, v := range params {
+			q[k] = v
+		}
+		u.RawQuery = q.Encode()
+		return "<" + u.String() + ">"
+	})
+}
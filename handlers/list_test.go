@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"servicio-gateway/auth"
+)
+
+// listSecurity responde un listado paginado de los ids dados y guarda la query recibida
+func listSecurity(t *testing.T, ids ...string) (*httptest.Server, *string) {
+	var query string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		items := make([]string, len(ids))
+		for i, id := range ids {
+			items[i] = `{"id":` + id + `,"email":"u` + id + `@example.com"}`
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", "30")
+		w.Header().Set("Link", `<http://security/api/v1/users?page=2>; rel="next"`)
+		w.Write([]byte(`{"page":1,"total":30,"data":[` + strings.Join(items, ",") + `]}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &query
+}
+
+// listProfiles responde el perfil de cada id según status (200 por defecto)
+// y registra cuántas llamadas hubo en curso a la vez
+func listProfiles(t *testing.T, status map[string]int) (*httptest.Server, *atomic.Int32) {
+	var inFlight, maxInFlight atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		if s, ok := status[id]; ok {
+			w.WriteHeader(s)
+			return
+		}
+		w.Write([]byte(`{"firstName":"Name` + id + `"}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &maxInFlight
+}
+
+// listUsers arma los upstreams por env y llama a HandleListUsers
+func listUsers(t *testing.T, securityURL, profileURL, query string, env map[string]string) *httptest.ResponseRecorder {
+	env["SECURITY_URL"], env["PROFILE_URL"] = securityURL, profileURL
+	for k, v := range env {
+		setEnv(t, k, v)
+	}
+	w := httptest.NewRecorder()
+	HandleListUsers(w, authenticated(httptest.NewRequest("GET", "/users?"+query, nil)))
+	return w
+}
+
+// authenticated devuelve req con un usuario ya verificado en el contexto
+func authenticated(req *http.Request) *http.Request {
+	return req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Subject: "7"}))
+}
+
+type listBody struct {
+	Page  int                      `json:"page"`
+	Total int                      `json:"total"`
+	Data  []map[string]interface{} `json:"data"`
+}
+
+func TestHandleListUsers_PassThrough(t *testing.T) {
+	security, query := listSecurity(t, "1")
+	w := listUsers(t, security.URL, "http://127.0.0.1:1", "page=1&size=10", map[string]string{})
+
+	if w.Code != http.StatusOK || *query != "page=1&size=10" {
+		t.Errorf("Expected the query to be forwarded, got %d %q", w.Code, *query)
+	}
+
+	w = listUsers(t, security.URL, "http://127.0.0.1:1", "page=1&api_key=sk_live_secret", map[string]string{
+		"APIKEY_QUERY_PARAM": "api_key",
+	})
+	if w.Code != http.StatusOK || *query != "page=1" {
+		t.Errorf("Expected the API key not to be forwarded, got %d %q", w.Code, *query)
+	}
+	if !strings.Contains(w.Body.String(), `"u1@example.com"`) || strings.Contains(w.Body.String(), "firstName") {
+		t.Errorf("Expected the security body untouched, got %s", w.Body.String())
+	}
+}
+
+func TestHandleListUsers_IncludeRequiresAuthentication(t *testing.T) {
+	security, _ := listSecurity(t, "1", "2")
+	var profileCalls atomic.Int32
+	profile := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		profileCalls.Add(1)
+		w.Write([]byte(`{"firstName":"Name"}`))
+	}))
+	defer profile.Close()
+	listUsers(t, security.URL, profile.URL, "", map[string]string{})
+
+	w := httptest.NewRecorder()
+	HandleListUsers(w, httptest.NewRequest("GET", "/users?include=profile", nil))
+
+	var errBody ErrorBody
+	json.Unmarshal(w.Body.Bytes(), &errBody)
+	if w.Code != http.StatusUnauthorized || errBody.Code != "unauthenticated" {
+		t.Errorf("Expected 401 unauthenticated, got %d %s", w.Code, w.Body.String())
+	}
+	if profileCalls.Load() != 0 {
+		t.Errorf("Expected no profile lookups for an anonymous caller, got %d", profileCalls.Load())
+	}
+
+	w = httptest.NewRecorder()
+	HandleListUsers(w, httptest.NewRequest("GET", "/users?include=account", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected including only the primary source to stay public, got %d", w.Code)
+	}
+}
+
+func TestAuthenticateWhen(t *testing.T) {
+	deny := Middleware{Name: "jwt", Wrap: func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}}
+	mw := AuthenticateWhen(func(r *http.Request) bool { return r.URL.Query().Get("include") != "" }, deny)
+	h := mw.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for query, want := range map[string]int{"": http.StatusOK, "include=profile": http.StatusUnauthorized} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/users?"+query, nil))
+		if w.Code != want {
+			t.Errorf("Expected %d for %q, got %d", want, query, w.Code)
+		}
+	}
+}
+
+func TestHandleListUsers_OnlyOtherSourcesNeedAuthentication(t *testing.T) {
+	security, _ := listSecurity(t, "1")
+	profile, _ := listProfiles(t, nil)
+	listUsers(t, security.URL, profile.URL, "", map[string]string{})
+
+	deny := Middleware{Name: "jwt", Wrap: func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+	}}
+	h := AuthenticateWhen(ListIncludesOtherSources, deny).Wrap(http.HandlerFunc(HandleListUsers))
+
+	for query, want := range map[string]int{
+		"":                        http.StatusOK,
+		"include=account":         http.StatusOK,
+		"include=security":        http.StatusOK,
+		"include=profile":         http.StatusUnauthorized,
+		"include=account,profile": http.StatusUnauthorized,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/users?"+query, nil))
+		if w.Code != want {
+			t.Errorf("Expected %d without a token for %q, got %d", want, query, w.Code)
+		}
+	}
+}
+
+func TestHandleListUsers_EnrichesWithBoundedConcurrency(t *testing.T) {
+	security, query := listSecurity(t, "1", "2", "3", "4", "5")
+	profile, maxInFlight := listProfiles(t, map[string]int{"3": http.StatusNotFound})
+
+	w := listUsers(t, security.URL, profile.URL, "page=1&include=profile", map[string]string{
+		"COMPOSITE_LIST_CONCURRENCY": "2",
+	})
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	if *query != "page=1" {
+		t.Errorf("Expected include not to reach security, got %q", *query)
+	}
+	if maxInFlight.Load() > 2 {
+		t.Errorf("Expected at most 2 profile calls at a time, got %d", maxInFlight.Load())
+	}
+
+	var body listBody
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Page != 1 || body.Total != 30 || len(body.Data) != 5 {
+		t.Fatalf("Expected the pagination to be preserved, got %s", w.Body.String())
+	}
+	if body.Data[0]["firstName"] != "Name1" || body.Data[0]["email"] != "u1@example.com" {
+		t.Errorf("Expected item 1 to be merged, got %v", body.Data[0])
+	}
+	if _, ok := body.Data[2]["firstName"]; ok || body.Data[2]["_meta"] != nil {
+		t.Errorf("Expected a user without profile to be returned as is, got %v", body.Data[2])
+	}
+	if w.Header().Get("X-Total-Count") != "30" {
+		t.Errorf("Expected X-Total-Count to be preserved, got %q", w.Header().Get("X-Total-Count"))
+	}
+	if link := w.Header().Get("Link"); link != `<http://security/api/v1/users?include=profile&page=2>; rel="next"` {
+		t.Errorf("Expected the Link to keep include, got %q", link)
+	}
+}
+
+func TestHandleListUsers_ItemFailure(t *testing.T) {
+	security, _ := listSecurity(t, "1", "2")
+	profile, _ := listProfiles(t, map[string]int{"2": http.StatusInternalServerError})
+
+	w := listUsers(t, security.URL, profile.URL, "include=profile", map[string]string{})
+
+	if w.Code != http.StatusOK || w.Header().Get("X-Partial-Content") != "true" {
+		t.Fatalf("Expected a partial 200, got %d", w.Code)
+	}
+	var body struct {
+		Data []struct {
+			FirstName string       `json:"firstName"`
+			Meta      *partialMeta `json:"_meta"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Data[0].FirstName != "Name1" || body.Data[0].Meta != nil {
+		t.Errorf("Expected item 1 to be complete, got %+v", body.Data[0])
+	}
+	if body.Data[1].Meta == nil || body.Data[1].Meta.Failed[0].Source != "profile" {
+		t.Errorf("Expected item 2 to report the profile failure, got %+v", body.Data[1])
+	}
+
+	w = listUsers(t, security.URL, profile.URL, "include=profile", map[string]string{
+		"COMPOSITE_LIST_ITEM_FAILURE": "fail",
+	})
+	var errBody ErrorBody
+	json.Unmarshal(w.Body.Bytes(), &errBody)
+	if w.Code != http.StatusBadGateway || errBody.Code != "list_enrichment_failed" {
+		t.Errorf("Expected 502 list_enrichment_failed, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleListUsers_BulkEndpoint(t *testing.T) {
+	security, _ := listSecurity(t, "1", "2", "3")
+
+	var mu sync.Mutex
+	var batches []string
+	profile := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids := r.URL.Query().Get("ids")
+		mu.Lock()
+		batches = append(batches, ids)
+		mu.Unlock()
+		var docs []string
+		for _, id := range strings.Split(ids, ",") {
+			if id != "2" {
+				docs = append(docs, `{"userId":`+id+`,"firstName":"Name`+id+`"}`)
+			}
+		}
+		w.Write([]byte(`{"items":[` + strings.Join(docs, ",") + `]}`))
+	}))
+	defer profile.Close()
+
+	useConfigFile(t, `
+securityURL: `+security.URL+`
+profileURL: `+profile.URL+`
+compositeUser:
+  sources:
+    - service: security
+      path: /api/v1/users/{id}
+    - service: profile
+      path: /api/v1/profiles/{id}
+      bulkPath: /api/v1/profiles?ids={ids}
+      bulkIdField: userId
+  list:
+    batchSize: 2
+`)
+	w := httptest.NewRecorder()
+	HandleListUsers(w, authenticated(httptest.NewRequest("GET", "/users?include=profile", nil)))
+
+	if len(batches) != 2 {
+		t.Errorf("Expected 2 bulk calls for 3 ids in batches of 2, got %v", batches)
+	}
+	var body listBody
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if len(body.Data) != 3 || body.Data[0]["firstName"] != "Name1" || body.Data[2]["firstName"] != "Name3" {
+		t.Fatalf("Expected items 1 and 3 to be enriched, got %s", w.Body.String())
+	}
+	if _, ok := body.Data[1]["firstName"]; ok {
+		t.Errorf("Expected item 2 to have no profile, got %v", body.Data[1])
+	}
+}
+
+func TestHandleListUsers_RepeatedIDs(t *testing.T) {
+	security, _ := listSecurity(t, "1", "1")
+	profile := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"items":[{"userId":1,"firstName":"Ana","address":{"city":"Lima"}}]}`))
+	}))
+	defer profile.Close()
+
+	useConfigFile(t, `
+securityURL: `+security.URL+`
+profileURL: `+profile.URL+`
+compositeUser:
+  sources:
+    - service: security
+      path: /api/v1/users/{id}
+    - service: profile
+      path: /api/v1/profiles/{id}
+      bulkPath: /api/v1/profiles?ids={ids}
+      bulkIdField: userId
+  fields:
+    email: {service: security}
+    firstName: {service: profile}
+    address.city: {service: profile}
+`)
+	w := httptest.NewRecorder()
+	HandleListUsers(w, authenticated(httptest.NewRequest("GET", "/users?include=profile", nil)))
+
+	var body listBody
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if len(body.Data) != 2 {
+		t.Fatalf("Expected 2 items, got %s", w.Body.String())
+	}
+	for i, item := range body.Data {
+		address, _ := item["address"].(map[string]interface{})
+		if item["firstName"] != "Ana" || address["city"] != "Lima" {
+			t.Errorf("Expected item %d to get the whole profile, got %v", i, item)
+		}
+	}
+}
+
+func TestDecodeList(t *testing.T) {
+	page, items, err := decodeList("security", []byte(`[{"id":12345678901234567890}]`), "")
+	if err != nil || page != nil || len(items) != 1 {
+		t.Fatalf("Expected a bare array, got %v %v (%v)", page, items, err)
+	}
+	if got := string(jsonMarshal(items[0])); got != `{"id":12345678901234567890}` {
+		t.Errorf("Expected large ids to be preserved, got %s", got)
+	}
+
+	if _, _, err := decodeList("security", []byte(`{"rows":[]}`), ""); err == nil {
+		t.Error("Expected an error when no list is found")
+	}
+	if page, _, err := decodeList("security", []byte(`{"rows":[]}`), "rows"); err != nil || page.key != "rows" {
+		t.Errorf("Expected itemsField to be honored, got %v", err)
+	}
+}
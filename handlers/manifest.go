@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"servicio-gateway/authz"
+	"servicio-gateway/config"
+)
+
+//go:embed routes.yaml
+var defaultRoutes []byte
+
+// Validadores de token que puede elegir cada ruta protegida
+const (
+	ValidatorJWT                = "jwt"
+	ValidatorIntrospection      = "introspection"
+	ValidatorJWTOrIntrospection = "jwt-or-introspection"
+)
+
+// Combinaciones de API key con el token
+const (
+	APIKeyEither = "either" // API key o token
+	APIKeyBoth   = "both"   // API key y token
+)
+
+// Certificado de cliente (mTLS) exigido por la ruta
+const (
+	MTLSOnly = "only" // solo el certificado, sin token
+	MTLSBoth = "both" // certificado y token
+)
+
+// AuthSpec describe cómo se autentica una ruta protegida
+type AuthSpec struct {
+	// Validator: cómo se valida el token (jwt, introspection,
+	// jwt-or-introspection); vacío = jwt
+	Validator string `json:"validator,omitempty" yaml:"validator"`
+	// APIKey: "" (no se aceptan), either o both
+	APIKey string `json:"apiKey,omitempty" yaml:"apiKey"`
+	// MTLS: "" (no se exige certificado), only o both
+	MTLS string `json:"mtls,omitempty" yaml:"mtls"`
+}
+
+// Empty indica si spec es la autenticación por defecto (solo JWT)
+func (a AuthSpec) Empty() bool {
+	return (a.Validator == "" || a.Validator == ValidatorJWT) && a.APIKey == "" && a.MTLS == ""
+}
+
+// String da el nombre de la cadena de autenticación para la tabla de rutas
+func (a AuthSpec) String() string {
+	if a.MTLS == MTLSOnly {
+		return "mtls"
+	}
+	name := a.Validator
+	if name == "" {
+		name = ValidatorJWT
+	}
+	switch a.APIKey {
+	case APIKeyEither:
+		name += "|apikey"
+	case APIKeyBoth:
+		name += "+apikey"
+	}
+	if a.MTLS == MTLSBoth {
+		name += "+mtls"
+	}
+	return name
+}
+
+// RouteSpec describe una ruta pública que se reenvía a un servicio upstream
+type RouteSpec struct {
+	Method   string `json:"method" yaml:"method"`
+	Path     string `json:"path" yaml:"path"`
+	Service  string `json:"service" yaml:"service"`
+	Upstream string `json:"upstream" yaml:"upstream"`
+	Auth     bool   `json:"auth" yaml:"auth"`
+
+	// Validator, apiKey y mtls (solo con auth: true)
+	AuthSpec `json:",inline" yaml:",inline"`
+
+	// RevokeSubject: variable del path cuyo valor (un subject) pierde sus
+	// tokens vigentes cuando el upstream responde 2xx
+	RevokeSubject string `json:"revokeSubject,omitempty" yaml:"revokeSubject"`
+
+	// Roles/scopes/owner exigidos (solo tiene sentido con auth: true)
+	authz.Policy `json:",inline" yaml:",inline"`
+}
+
+// RouteManifest es el contenido de un archivo de rutas (YAML o JSON)
+type RouteManifest struct {
+	Routes []RouteSpec `json:"routes" yaml:"routes"`
+}
+
+// LoadRouteManifest lee y valida el manifiesto en path.
+// Si path está vacío se usa el manifiesto por defecto embebido en el binario.
+func LoadRouteManifest(path string, cfg config.Config) (*RouteManifest, error) {
+	var m RouteManifest
+	if path == "" {
+		if err := config.Decode(defaultRoutes, ".yaml", &m); err != nil {
+			return nil, fmt.Errorf("default routes: %w", err)
+		}
+	} else if err := config.DecodeFile(path, &m); err != nil {
+		return nil, err
+	}
+
+	for i := range m.Routes {
+		m.Routes[i].Method = strings.ToUpper(strings.TrimSpace(m.Routes[i].Method))
+	}
+
+	if err := m.Validate(cfg); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate revisa servicios desconocidos, pares method+path duplicados
+// y variables del path upstream que no existen en el path público.
+func (m *RouteManifest) Validate(cfg config.Config) error {
+	var errs []error
+	seen := map[string]int{}
+
+	for i, rt := range m.Routes {
+		where := fmt.Sprintf("routes[%d] (%s %s)", i, rt.Method, rt.Path)
+
+		if !allowedMethod(rt.Method) {
+			errs = append(errs, fmt.Errorf("%s: unsupported method %q", where, rt.Method))
+		}
+		if !strings.HasPrefix(rt.Path, "/") {
+			errs = append(errs, fmt.Errorf("%s: path must start with /", where))
+		}
+		if !strings.HasPrefix(rt.Upstream, "/") {
+			errs = append(errs, fmt.Errorf("%s: upstream must start with /", where))
+		}
+		if _, ok := cfg.ServiceURL(rt.Service); !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown service %q", where, rt.Service))
+		}
+
+		key := rt.Method + " " + normalizePath(rt.Path)
+		if prev, dup := seen[key]; dup {
+			errs = append(errs, fmt.Errorf("%s: duplicates routes[%d]", where, prev))
+		} else {
+			seen[key] = i
+		}
+
+		vars := map[string]bool{}
+		for _, v := range pathVars(rt.Path) {
+			vars[v] = true
+		}
+		if !rt.Policy.Empty() && !rt.Auth {
+			errs = append(errs, fmt.Errorf("%s: roles/scopes/owner require auth: true", where))
+		}
+		switch rt.Validator {
+		case "", ValidatorJWT:
+		case ValidatorIntrospection, ValidatorJWTOrIntrospection:
+			if cfg.Introspection.URL == "" {
+				errs = append(errs, fmt.Errorf("%s: validator %s requires introspection.url", where, rt.Validator))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown validator %q", where, rt.Validator))
+		}
+		switch rt.APIKey {
+		case "":
+		case APIKeyEither, APIKeyBoth:
+			if cfg.APIKeys.File == "" {
+				errs = append(errs, fmt.Errorf("%s: apiKey %s requires apiKeys.file", where, rt.APIKey))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown apiKey mode %q (use either or both)", where, rt.APIKey))
+		}
+		switch rt.MTLS {
+		case "":
+		case MTLSOnly, MTLSBoth:
+			if cfg.TLS.ClientCAFile == "" {
+				errs = append(errs, fmt.Errorf("%s: mtls %s requires tls.clientCAFile", where, rt.MTLS))
+			}
+			if cfg.TLS.ClientAuth == "none" {
+				// el listener nunca pide el certificado: la ruta respondería siempre 401
+				errs = append(errs, fmt.Errorf("%s: mtls %s requires tls.clientAuth optional or require, not none", where, rt.MTLS))
+			}
+			if rt.MTLS == MTLSOnly && (rt.Validator != "" || rt.APIKey != "") {
+				errs = append(errs, fmt.Errorf("%s: mtls only cannot be combined with validator/apiKey", where))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown mtls mode %q (use only or both)", where, rt.MTLS))
+		}
+		if !rt.AuthSpec.Empty() && !rt.Auth {
+			errs = append(errs, fmt.Errorf("%s: validator/apiKey/mtls require auth: true", where))
+		}
+		if rt.RevokeSubject != "" && !vars[rt.RevokeSubject] {
+			errs = append(errs, fmt.Errorf("%s: revokeSubject variable {%s} is not defined in path", where, rt.RevokeSubject))
+		}
+		if rt.Owner != "" && !vars[rt.Owner] {
+			errs = append(errs, fmt.Errorf("%s: owner variable {%s} is not defined in path", where, rt.Owner))
+		}
+		for _, v := range pathVars(rt.Upstream) {
+			if !vars[v] {
+				errs = append(errs, fmt.Errorf("%s: upstream variable {%s} is not defined in path", where, v))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// RegisterManifestRoutes registra en g las rutas del manifiesto cuyo flag auth coincide
+func RegisterManifestRoutes(g *Registrar, m *RouteManifest, auth bool) {
+	for _, rt := range m.Routes {
+		if rt.Auth != auth {
+			continue
+		}
+		mw := policyMiddleware(rt.Policy)
+		if rt.RevokeSubject != "" {
+			mw = append(mw, revokeOnSuccess(rt.RevokeSubject))
+		}
+		g.WithAuth(rt.AuthSpec).Handle(rt.Method, rt.Path, rt.Service+":"+rt.Upstream,
+			MakeProxy(rt.Service, rt.Method, rt.Upstream), mw...)
+	}
+}
+
+var pathVarRe = regexp.MustCompile(`\{([^{}:]+)(:[^{}]*)?\}`)
+
+// pathVars devuelve los nombres de las variables {var} (o {var:regex}) de un path
+func pathVars(path string) []string {
+	var out []string
+	for _, m := range pathVarRe.FindAllStringSubmatch(path, -1) {
+		out = append(out, strings.TrimSpace(m[1]))
+	}
+	return out
+}
+
+// normalizePath borra los nombres de variables para comparar templates:
+// /users/{id} y /users/{userId} matchean las mismas peticiones. La regex se
+// conserva: /users/{id:[0-9]+} no matchea lo mismo que /users/{id}.
+func normalizePath(path string) string {
+	return pathVarRe.ReplaceAllString(path, "{$2}")
+}
+
+// allowedMethod indica si method es un método HTTP que el gateway sabe reenviar
+func allowedMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
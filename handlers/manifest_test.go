@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"servicio-gateway/config"
+)
+
+func TestLoadRouteManifest_Default(t *testing.T) {
+	m, err := LoadRouteManifest("", config.Config{})
+	if err != nil {
+		t.Fatalf("Expected default manifest to be valid, got %v", err)
+	}
+	if len(m.Routes) == 0 {
+		t.Error("Expected default manifest to declare routes")
+	}
+}
+
+func TestLoadRouteManifest_ValidationErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "routes.json")
+	manifest := `{"routes": [
+		{"method": "get", "path": "/a/{id}", "service": "security", "upstream": "/x/{id}"},
+		{"method": "GET", "path": "/a/{other}", "service": "security", "upstream": "/y"},
+		{"method": "GET", "path": "/b", "service": "billing", "upstream": "/b"},
+		{"method": "POST", "path": "/c/{id}", "service": "profile", "upstream": "/c/{userId}"}
+	]}`
+	os.WriteFile(path, []byte(manifest), 0o644)
+
+	_, err := LoadRouteManifest(path, config.Config{})
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+
+	msg := err.Error()
+	for _, want := range []string{"duplicates routes[0]", `unknown service "billing"`, "{userId} is not defined"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected error to contain %q, got %q", want, msg)
+		}
+	}
+}
+
+func TestRouteManifestValidate_MTLS(t *testing.T) {
+	m := &RouteManifest{Routes: []RouteSpec{
+		{Method: "GET", Path: "/a", Service: "security", Upstream: "/a", Auth: true, AuthSpec: AuthSpec{MTLS: MTLSOnly}},
+		{Method: "GET", Path: "/b", Service: "security", Upstream: "/b", Auth: true, AuthSpec: AuthSpec{MTLS: MTLSOnly, APIKey: APIKeyEither}},
+		{Method: "GET", Path: "/c", Service: "security", Upstream: "/c", AuthSpec: AuthSpec{MTLS: MTLSBoth}},
+	}}
+
+	err := m.Validate(config.Config{APIKeys: config.APIKeysConfig{File: "keys.yaml"}})
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	msg := err.Error()
+	for _, want := range []string{"requires tls.clientCAFile", "cannot be combined", "require auth: true"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected error to contain %q, got %q", want, msg)
+		}
+	}
+
+	m.Routes = m.Routes[:1]
+	if err := m.Validate(config.Config{TLS: config.TLSConfig{ClientCAFile: "ca.pem"}}); err != nil {
+		t.Errorf("Expected mtls route to be valid with a client CA, got %v", err)
+	}
+	if name := m.Routes[0].AuthSpec.String(); name != "mtls" {
+		t.Errorf("Expected 'mtls', got '%s'", name)
+	}
+
+	err = m.Validate(config.Config{TLS: config.TLSConfig{ClientCAFile: "ca.pem", ClientAuth: "none"}})
+	if err == nil || !strings.Contains(err.Error(), "requires tls.clientAuth optional or require") {
+		t.Errorf("Expected mtls routes to be rejected with clientAuth none, got %v", err)
+	}
+}
+
+func TestRegisterManifestRoutes_ProxiesWithPathVars(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Method + " " + r.URL.Path))
+	}))
+	defer upstream.Close()
+
+	setEnv(t, "PROFILE_URL", upstream.URL)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "routes.yaml")
+	manifest := `
+routes:
+  - method: PATCH
+    path: /p/{id}/avatar
+    service: profile
+    upstream: /api/v1/profiles/{id}/avatar
+    auth: true
+`
+	os.WriteFile(path, []byte(manifest), 0o644)
+
+	m, err := LoadRouteManifest(path, config.Config{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	r := mux.NewRouter()
+	RegisterManifestRoutes(NewRouteTable().Router(r), m, false)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PATCH", "/p/42/avatar", nil))
+	if w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected auth route to be skipped on public router, got %d", w.Code)
+	}
+
+	r = mux.NewRouter()
+	RegisterManifestRoutes(NewRouteTable().Router(r), m, true)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PATCH", "/p/42/avatar", nil))
+	if got := w.Body.String(); got != "PATCH /api/v1/profiles/42/avatar" {
+		t.Errorf("Expected upstream 'PATCH /api/v1/profiles/42/avatar', got '%s'", got)
+	}
+}
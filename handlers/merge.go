@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"servicio-gateway/config"
+)
+
+// invalidJSONError: un upstream respondió algo que no es un objeto JSON
+type invalidJSONError struct {
+	Service string
+	Err     error
+}
+
+func (e *invalidJSONError) Error() string {
+	return fmt.Sprintf("%s returned invalid JSON: %v", e.Service, e.Err)
+}
+
+func (e *invalidJSONError) Unwrap() error {
+	return e.Err
+}
+
+// errUnknownMerge: ?merge= con una estrategia que no existe
+type errUnknownMerge string
+
+func (e errUnknownMerge) Error() string {
+	return fmt.Sprintf("unknown merge strategy %q (use %s or %s)", string(e), config.MergeFlat, config.MergeNested)
+}
+
+// mergeStrategy elige cómo se une el usuario compuesto: ?merge=flat|nested,
+// si no el profile de Accept (application/json;profile=nested) y si no
+// compositeUser.merge. Marca la respuesta con Vary: Accept.
+func mergeStrategy(w http.ResponseWriter, r *http.Request) (string, error) {
+	w.Header().Add("Vary", "Accept")
+
+	if q := r.URL.Query().Get("merge"); q != "" {
+		if q != config.MergeFlat && q != config.MergeNested {
+			return "", errUnknownMerge(q)
+		}
+		return q, nil
+	}
+	for _, v := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(v, ",") {
+			mediaType, params, err := mime.ParseMediaType(mediaRange)
+			if err != nil || (mediaType != "application/json" && mediaType != "*/*") {
+				continue
+			}
+			// profiles desconocidos se ignoran, como cualquier Accept que no se puede cumplir
+			switch p := params["profile"]; p {
+			case config.MergeFlat, config.MergeNested:
+				return p, nil
+			}
+		}
+	}
+	return CurrentConfig().CompositeUser.Merge, nil
+}
+
+// writeComposite responde user con el Content-Type de strategy
+func writeComposite(w http.ResponseWriter, strategy string, user map[string]interface{}) {
+	contentType := "application/json"
+	if strategy == config.MergeNested {
+		contentType = `application/json; profile="nested"`
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(jsonMarshal(user))
+}
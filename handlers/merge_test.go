@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"servicio-gateway/config"
+)
+
+func TestMergeStrategy(t *testing.T) {
+	tests := []struct {
+		query, accept, expected string
+	}{
+		{"", "", config.MergeFlat},
+		{"merge=nested", "", config.MergeNested},
+		{"", `application/json; profile="nested"`, config.MergeNested},
+		{"", `text/html, application/json;profile=nested;q=0.9`, config.MergeNested},
+		{"", `application/json; profile="v2"`, config.MergeFlat},
+		{"merge=flat", `application/json; profile="nested"`, config.MergeFlat},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/users/42?"+tt.query, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		got, err := mergeStrategy(w, r)
+		if err != nil || got != tt.expected {
+			t.Errorf("query %q accept %q: expected %s, got %s (%v)", tt.query, tt.accept, tt.expected, got, err)
+		}
+		if w.Header().Get("Vary") != "Accept" {
+			t.Errorf("Expected Vary: Accept, got %q", w.Header().Get("Vary"))
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/users/42?merge=deep", nil)
+	if _, err := mergeStrategy(httptest.NewRecorder(), r); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+}
+
+func TestHandleGetUserFull_Nested(t *testing.T) {
+	security := jsonServer(http.StatusOK, `{"id":"42","email":"a@example.com","updatedAt":"2024"}`)
+	defer security.Close()
+	profile := jsonServer(http.StatusOK, `{"id":"p-1","firstName":"Ana","updatedAt":"2025"}`)
+	defer profile.Close()
+
+	w := getUserFull(t, security.URL, profile.URL, "strict", func(r *http.Request) {
+		r.URL.RawQuery = "merge=nested"
+	})
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != `application/json; profile="nested"` {
+		t.Fatalf("Expected 200 nested, got %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	var body struct {
+		Account map[string]interface{} `json:"account"`
+		Profile map[string]interface{} `json:"profile"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Account["updatedAt"] != "2024" || body.Profile["updatedAt"] != "2025" || body.Profile["id"] != "p-1" {
+		t.Errorf("Expected both versions of the shared fields, got %s", w.Body.String())
+	}
+}
+
+func TestHandleGetUserFull_InvalidMerge(t *testing.T) {
+	w := getUserFull(t, "http://127.0.0.1:1", "http://127.0.0.1:1", "strict", func(r *http.Request) {
+		r.URL.RawQuery = "merge=deep"
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400, got %d", w.Code)
+	}
+}
+
+func TestHandleGetUserFull_InvalidJSON(t *testing.T) {
+	security := jsonServer(http.StatusOK, `{"id":"42",`)
+	defer security.Close()
+	profile := jsonServer(http.StatusOK, `{"firstName":"Ana"}`)
+	defer profile.Close()
+
+	w := getUserFull(t, security.URL, profile.URL, "strict", nil)
+
+	var body ErrorBody
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadGateway || body.Code != "upstream_invalid_json" {
+		t.Errorf("Expected 502 upstream_invalid_json, got %d %q", w.Code, body.Code)
+	}
+	if body.Message == "" || body.Message[:8] != "security" {
+		t.Errorf("Expected the message to name the upstream, got %q", body.Message)
+	}
+}
+
+func TestHandleGetUserFull_InvalidProfileJSONIsPartial(t *testing.T) {
+	security := jsonServer(http.StatusOK, `{"id":"42"}`)
+	defer security.Close()
+	profile := jsonServer(http.StatusOK, `<html>oops</html>`)
+	defer profile.Close()
+
+	w := getUserFull(t, security.URL, profile.URL, "partial", nil)
+
+	if w.Code != http.StatusOK || w.Header().Get("X-Partial-Content") != "true" {
+		t.Fatalf("Expected a partial 200, got %d", w.Code)
+	}
+	var body struct {
+		Meta partialMeta `json:"_meta"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if len(body.Meta.Failed) != 1 || body.Meta.Failed[0].Error != "upstream_invalid_json" {
+		t.Errorf("Expected profile to fail with upstream_invalid_json, got %+v", body.Meta.Failed)
+	}
+}
+
+func TestUserSchema_FlatPrecedence(t *testing.T) {
+	schema := testSchema()
+	schema.Fields["updatedAt"] = config.FieldRoute{Service: "security", ReadOnly: true, From: []string{"profile", "security"}}
+
+	user, _ := schema.compose(config.MergeFlat, map[string][]byte{
+		"security": []byte(`{"id":"42","updatedAt":"2024"}`),
+		"profile":  []byte(`{"updatedAt":"2025"}`),
+	})
+	if user["updatedAt"] != "2025" {
+		t.Errorf("Expected profile's updatedAt to win, got %v", user["updatedAt"])
+	}
+
+	user, _ = schema.compose(config.MergeFlat, map[string][]byte{
+		"security": []byte(`{"id":"42","updatedAt":"2024"}`),
+		"profile":  nil,
+	})
+	if user["updatedAt"] != "2024" {
+		t.Errorf("Expected to fall back to security's updatedAt, got %v", user["updatedAt"])
+	}
+}
+
+func TestDecodeSource(t *testing.T) {
+	if doc, err := decodeSource("profile", []byte("  ")); err != nil || len(doc) != 0 {
+		t.Errorf("Expected an empty body to be an empty object, got %v (%v)", doc, err)
+	}
+	for _, body := range []string{`[1,2]`, `null`, `"x"`, `{`} {
+		if _, err := decodeSource("profile", []byte(body)); err == nil {
+			t.Errorf("Expected %s to be rejected", body)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// partialHeader marca las respuestas compuestas a las que les falta alguna parte
+const partialHeader = "X-Partial-Content"
+
+// sourceFailure describe una parte que no se pudo obtener (_meta.failed)
+type sourceFailure struct {
+	Source  string `json:"source"`
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// partialMeta es la sección _meta de una respuesta compuesta parcial
+type partialMeta struct {
+	Partial bool            `json:"partial"`
+	Failed  []sourceFailure `json:"failed"`
+}
+
+// allowPartial indica si la respuesta puede salir incompleta: modo partial
+// y el cliente no exige una completa (?partial=false o Prefer: handling=strict)
+func allowPartial(w http.ResponseWriter, r *http.Request) bool {
+	if CurrentConfig().CompositeDegradation != "partial" {
+		return false
+	}
+	if r.URL.Query().Get("partial") == "false" {
+		return false
+	}
+	for _, v := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(pref), "handling=strict") {
+				w.Header().Set("Preference-Applied", "handling=strict")
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// failureOf devuelve por qué falló la llamada a source (nil si respondió bien):
+// error de transporte o status 5xx
+func failureOf(source string, res upstreamResult) *sourceFailure {
+	if res.Err != nil {
+		_, code := upstreamErrorCode(res.Err)
+		return &sourceFailure{Source: source, Error: code, Message: res.Err.Error()}
+	}
+	if res.Status >= 500 {
+		return &sourceFailure{
+			Source:  source,
+			Error:   "upstream_error",
+			Message: fmt.Sprintf("%s responded %d", source, res.Status),
+		}
+	}
+	return nil
+}
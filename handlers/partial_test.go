@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// getUserFull arma los upstreams por env y llama a HandleGetUserFull
+func getUserFull(t *testing.T, securityURL, profileURL, mode string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+	setEnv(t, "SECURITY_URL", securityURL)
+	setEnv(t, "PROFILE_URL", profileURL)
+	setEnv(t, "COMPOSITE_DEGRADATION", mode)
+
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/users/42", nil), map[string]string{"id": "42"})
+	if prepare != nil {
+		prepare(req)
+	}
+	w := httptest.NewRecorder()
+	HandleGetUserFull(w, req)
+	return w
+}
+
+func jsonServer(status int, body string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+}
+
+func TestHandleGetUserFull_PartialWhenProfileFails(t *testing.T) {
+	security := jsonServer(http.StatusOK, `{"id":"42","email":"a@example.com"}`)
+	defer security.Close()
+	profile := jsonServer(http.StatusInternalServerError, `{"error":"boom"}`)
+	defer profile.Close()
+
+	w := getUserFull(t, security.URL, profile.URL, "partial", nil)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	if w.Header().Get("X-Partial-Content") != "true" {
+		t.Error("Expected X-Partial-Content header")
+	}
+	var body struct {
+		Email string      `json:"email"`
+		Error string      `json:"error"`
+		Meta  partialMeta `json:"_meta"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Email != "a@example.com" || body.Error != "" {
+		t.Errorf("Expected only the security data, got %s", w.Body.String())
+	}
+	if !body.Meta.Partial || len(body.Meta.Failed) != 1 || body.Meta.Failed[0].Source != "profile" {
+		t.Errorf("Expected _meta listing profile as failed, got %+v", body.Meta)
+	}
+}
+
+func TestHandleGetUserFull_PartialWhenProfileUnreachable(t *testing.T) {
+	security := jsonServer(http.StatusOK, `{"id":"42"}`)
+	defer security.Close()
+
+	w := getUserFull(t, security.URL, "http://127.0.0.1:1", "partial", nil)
+
+	var body struct {
+		Meta partialMeta `json:"_meta"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusOK || len(body.Meta.Failed) != 1 || body.Meta.Failed[0].Error != "upstream_unavailable" {
+		t.Errorf("Expected partial 200 with upstream_unavailable, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandleGetUserFull_CompleteResponseRequired(t *testing.T) {
+	security := jsonServer(http.StatusOK, `{"id":"42"}`)
+	defer security.Close()
+
+	w := getUserFull(t, security.URL, "http://127.0.0.1:1", "partial", func(r *http.Request) {
+		r.URL.RawQuery = "partial=false"
+	})
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 with ?partial=false, got %d", w.Code)
+	}
+
+	w = getUserFull(t, security.URL, "http://127.0.0.1:1", "partial", func(r *http.Request) {
+		r.Header.Set("Prefer", "handling=strict")
+	})
+	if w.Code != http.StatusBadGateway || w.Header().Get("Preference-Applied") != "handling=strict" {
+		t.Errorf("Expected 502 honoring Prefer: handling=strict, got %d (%q)", w.Code, w.Header().Get("Preference-Applied"))
+	}
+
+	w = getUserFull(t, security.URL, "http://127.0.0.1:1", "strict", nil)
+	if w.Code != http.StatusBadGateway || w.Header().Get("X-Partial-Content") != "" {
+		t.Errorf("Expected 502 in strict mode, got %d", w.Code)
+	}
+}
+
+func TestHandleGetUserFull_SecurityFailureIsNotDegraded(t *testing.T) {
+	profile := jsonServer(http.StatusOK, `{"firstName":"Ana"}`)
+	defer profile.Close()
+
+	w := getUserFull(t, "http://127.0.0.1:1", profile.URL, "partial", nil)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("Expected 502 when security fails, got %d", w.Code)
+	}
+}
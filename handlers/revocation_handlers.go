@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"servicio-gateway/revocation"
+)
+
+// Revocations exportado para que main inyecte el almacén de revocaciones
+// que también consulta JWTMiddleware. Si es nil no se revoca nada.
+var Revocations revocation.Store
+
+// revokeSubject invalida los tokens ya emitidos para subject (best effort)
+func revokeSubject(subject, reason string) {
+	if Revocations == nil || subject == "" {
+		return
+	}
+	if err := Revocations.RevokeSubject(subject, time.Now()); err != nil {
+		log.Printf("[revocation] could not revoke subject %q after %s: %v\n", subject, reason, err)
+		return
+	}
+	log.Printf("[revocation] revoked tokens of subject %q after %s\n", subject, reason)
+}
+
+type revokeRequest struct {
+	JTI       string    `json:"jti"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Subject   string    `json:"subject"`
+	Before    time.Time `json:"before"`
+}
+
+// HandleRevoke revoca manualmente un token (jti) o todos los de un subject.
+// Body: {"jti": "...", "expiresAt": "..."} o {"subject": "...", "before": "..."}
+// (before por defecto ahora).
+func HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	if Revocations == nil {
+		WriteError(w, http.StatusServiceUnavailable, "revocation_disabled", "revocation store not configured")
+		return
+	}
+
+	var req revokeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		WriteError(w, http.StatusBadRequest, "invalid_json", "invalid json")
+		return
+	}
+	if (req.JTI == "") == (req.Subject == "") {
+		WriteError(w, http.StatusBadRequest, "invalid_request", "exactly one of jti or subject is required")
+		return
+	}
+
+	var err error
+	if req.JTI != "" {
+		err = Revocations.RevokeToken(req.JTI, req.ExpiresAt)
+	} else {
+		if req.Before.IsZero() {
+			req.Before = time.Now()
+		}
+		err = Revocations.RevokeSubject(req.Subject, req.Before)
+	}
+	if err != nil {
+		WriteError(w, http.StatusInternalServerError, "revocation_failed", err.Error())
+		return
+	}
+
+	log.Printf("[revocation] manual revocation jti=%q subject=%q\n", req.JTI, req.Subject)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeOnSuccess revoca el subject de la variable pathVar si la respuesta es 2xx
+func revokeOnSuccess(pathVar string) Middleware {
+	return Middleware{
+		Name: "revoke(" + pathVar + ")",
+		Wrap: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sw := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+				next.ServeHTTP(sw, r)
+				if sw.status >= 200 && sw.status < 300 {
+					revokeSubject(mux.Vars(r)[pathVar], r.Method+" "+r.URL.Path)
+				}
+			})
+		},
+	}
+}
+
+// statusRecorder recuerda el status que escribió el handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap permite a http.ResponseController llegar al writer original (Flush)
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
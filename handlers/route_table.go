@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gorilla/mux"
+)
+
+// RouteEntry es una fila de la tabla efectiva de rutas
+type RouteEntry struct {
+	Method     string   `json:"method"`
+	Path       string   `json:"path"`
+	Target     string   `json:"target"`
+	Middleware []string `json:"middleware"`
+	ShadowedBy string   `json:"shadowedBy,omitempty"`
+}
+
+// RouteTable registra cada method+path dado de alta en el router raíz y sus
+// subrouters, para poder detectar rutas inalcanzables y listar la tabla efectiva.
+type RouteTable struct {
+	known   map[*mux.Route]RouteEntry
+	entries []RouteEntry
+}
+
+// Middleware con nombre, para que la tabla de rutas muestre la cadena efectiva
+type Middleware struct {
+	Name string
+	Wrap func(http.Handler) http.Handler
+}
+
+// Registrar da de alta rutas en un router concreto, recordando qué cadena
+// de middleware (CORS, JWT, ...) aplica a ese router.
+type Registrar struct {
+	table      *RouteTable
+	router     *mux.Router
+	middleware []string
+
+	// authn, si no es nil, antepone a cada ruta la autenticación indicada en spec
+	authn func(spec AuthSpec) Middleware
+	spec  AuthSpec
+}
+
+func NewRouteTable() *RouteTable {
+	return &RouteTable{known: map[*mux.Route]RouteEntry{}}
+}
+
+// Router devuelve un Registrar para r. middleware son los nombres de la
+// cadena completa que envuelve a r (incluida la heredada del router padre).
+func (t *RouteTable) Router(r *mux.Router, middleware ...string) *Registrar {
+	return &Registrar{table: t, router: r, middleware: middleware}
+}
+
+// ProtectedRouter es como Router pero cada ruta registrada queda detrás de
+// authn(spec), donde spec es el elegido con WithAuth (vacío = JWT).
+func (t *RouteTable) ProtectedRouter(r *mux.Router, authn func(spec AuthSpec) Middleware, middleware ...string) *Registrar {
+	return &Registrar{table: t, router: r, middleware: middleware, authn: authn}
+}
+
+// WithAuth devuelve un Registrar igual a g pero que autentica según spec
+func (g *Registrar) WithAuth(spec AuthSpec) *Registrar {
+	c := *g
+	c.spec = spec
+	return &c
+}
+
+// Handle registra h para method+path. target describe a dónde va la petición.
+// mw se aplica solo a esta ruta, después de la cadena del router (el primero
+// de la lista es el más externo).
+func (g *Registrar) Handle(method, path, target string, h http.HandlerFunc, mw ...Middleware) *mux.Route {
+	if g.authn != nil {
+		mw = append([]Middleware{g.authn(g.spec)}, mw...)
+	}
+	names := append([]string(nil), g.middleware...)
+	var handler http.Handler = h
+	for i := len(mw) - 1; i >= 0; i-- {
+		handler = mw[i].Wrap(handler)
+	}
+	for _, m := range mw {
+		names = append(names, m.Name)
+	}
+
+	route := g.router.Handle(path, handler).Methods(method)
+	g.table.known[route] = RouteEntry{
+		Method:     method,
+		Path:       path,
+		Target:     target,
+		Middleware: names,
+	}
+	return route
+}
+
+// Check recorre root en el mismo orden en que mux evalúa las rutas y
+// devuelve un error por cada registro que nunca puede matchear porque otro
+// anterior (en cualquier subrouter) ya captura todas sus peticiones: el mismo
+// method y un path que lo cubre segmento a segmento (ver covers).
+func (t *RouteTable) Check(root *mux.Router) error {
+	var errs []error
+	t.entries = nil
+	var seen []RouteEntry
+
+	root.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		if route.GetHandler() == nil {
+			// subrouter: sus rutas hijas se visitan a continuación
+			return nil
+		}
+
+		entry, ok := t.known[route]
+		if !ok {
+			tpl, _ := route.GetPathTemplate()
+			methods, _ := route.GetMethods()
+			entry = RouteEntry{Method: strings.Join(methods, ","), Path: tpl, Target: "(unregistered)"}
+		}
+
+	check:
+		for _, m := range routeMethods(entry) {
+			for _, prev := range seen {
+				if !hasMethod(prev, m) || !covers(prev.Path, entry.Path) {
+					continue
+				}
+				entry.ShadowedBy = prev.Method + " " + prev.Path + " -> " + prev.Target
+				errs = append(errs, fmt.Errorf("%s %s -> %s is unreachable: shadowed by %s",
+					m, entry.Path, entry.Target, entry.ShadowedBy))
+				break check
+			}
+		}
+
+		seen = append(seen, entry)
+		t.entries = append(t.entries, entry)
+		return nil
+	})
+
+	return errors.Join(errs...)
+}
+
+// routeMethods devuelve los métodos de e, o "*" si acepta cualquiera
+func routeMethods(e RouteEntry) []string {
+	if e.Method == "" {
+		return []string{"*"}
+	}
+	return strings.Split(e.Method, ",")
+}
+
+// hasMethod indica si e captura peticiones con method m
+func hasMethod(e RouteEntry, m string) bool {
+	for _, em := range routeMethods(e) {
+		if em == m || em == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// covers indica si toda petición que matchea el template path también
+// matchea prev: mismo número de segmentos y, en cada uno, el de prev es
+// igual o una variable que acepta el de path. /users/{id} cubre /users/me;
+// /users/{id:[0-9]+} cubre /users/42 pero no /users/{id}.
+func covers(prev, path string) bool {
+	ps, qs := pathSegments(prev), pathSegments(path)
+	if len(ps) != len(qs) {
+		return false
+	}
+	for i := range ps {
+		if !segmentCovers(ps[i], qs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentCovers es covers para un único segmento del path
+func segmentCovers(prev, seg string) bool {
+	if normalizePath(prev) == normalizePath(seg) {
+		return true
+	}
+	if m := pathVarRe.FindStringSubmatch(prev); m != nil && m[0] == prev && m[2] == "" {
+		// {var} sin regex acepta cualquier segmento no vacío
+		return seg != ""
+	}
+	if pathVarRe.MatchString(seg) {
+		// una variable acotada no cubre otra con distinta regex (o sin ella)
+		return false
+	}
+	re, err := segmentRegexp(prev)
+	return err == nil && re.MatchString(seg)
+}
+
+// segmentRegexp arma la regex con que mux matchea un segmento con variables
+func segmentRegexp(seg string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	last := 0
+	for _, m := range pathVarRe.FindAllStringSubmatchIndex(seg, -1) {
+		b.WriteString(regexp.QuoteMeta(seg[last:m[0]]))
+		pattern := "[^/]+"
+		if m[4] >= 0 {
+			pattern = seg[m[4]+1 : m[5]]
+		}
+		b.WriteString("(?:" + pattern + ")")
+		last = m[1]
+	}
+	b.WriteString(regexp.QuoteMeta(seg[last:]) + "$")
+	return regexp.Compile(b.String())
+}
+
+// pathSegments parte un template por "/" sin cortar las regex de las variables
+func pathSegments(path string) []string {
+	var segs []string
+	depth, start := 0, 0
+	for i, c := range path {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+		case c == '/' && depth == 0:
+			segs = append(segs, path[start:i])
+			start = i + 1
+		}
+	}
+	return append(segs, path[start:])
+}
+
+// Entries devuelve la tabla efectiva calculada por el último Check
+func (t *RouteTable) Entries() []RouteEntry {
+	return t.entries
+}
+
+// Print escribe la tabla efectiva en formato texto alineado
+func (t *RouteTable) Print(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "METHOD\tPATH\tTARGET\tMIDDLEWARE\tSTATUS")
+	for _, e := range t.entries {
+		status := "ok"
+		if e.ShadowedBy != "" {
+			status = "shadowed by " + e.ShadowedBy
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.Method, e.Path, e.Target, strings.Join(e.Middleware, ","), status)
+	}
+	tw.Flush()
+}
+
+// HandleListRoutes responde con la tabla efectiva en JSON
+func (t *RouteTable) HandleListRoutes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"routes": t.entries,
+	})
+}
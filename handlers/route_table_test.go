@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func noop(w http.ResponseWriter, r *http.Request) {}
+
+func TestRouteTableCheck_DetectsShadowedSubrouterRoute(t *testing.T) {
+	r := mux.NewRouter()
+	routes := NewRouteTable()
+	public := routes.Router(r, "cors")
+	public.Handle("GET", "/users/{id}", "security:/api/v1/users/{id}", noop)
+
+	api := r.PathPrefix("/").Subrouter()
+	protected := routes.Router(api, "cors", "jwt")
+	protected.Handle("GET", "/users/{userId}", "HandleGetUserFull", noop)
+	protected.Handle("PUT", "/users/{id}", "HandleUpdateUserFull", noop)
+
+	err := routes.Check(r)
+	if err == nil {
+		t.Fatal("Expected shadowing error")
+	}
+	if !strings.Contains(err.Error(), "GET /users/{userId} -> HandleGetUserFull is unreachable") {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if strings.Contains(err.Error(), "PUT") {
+		t.Errorf("PUT route should not be reported, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	routes.Print(&buf)
+	if !strings.Contains(buf.String(), "cors,jwt") {
+		t.Errorf("Expected middleware chain in listing, got:\n%s", buf.String())
+	}
+}
+
+func TestRouteTableCheck_SubrouterOrderWins(t *testing.T) {
+	r := mux.NewRouter()
+	routes := NewRouteTable()
+	api := r.PathPrefix("/").Subrouter()
+	public := routes.Router(r)
+	public.Handle("GET", "/health", "Health", noop)
+
+	// Registrada después en el tiempo, pero el subrouter se evalúa antes
+	routes.Router(api, "jwt").Handle("GET", "/health", "Other", noop)
+
+	err := routes.Check(r)
+	if err == nil || !strings.Contains(err.Error(), "GET /health -> Health is unreachable") {
+		t.Errorf("Expected root route to be reported as shadowed, got %v", err)
+	}
+}
+
+func TestRouteTableCheck_NoConflicts(t *testing.T) {
+	r := mux.NewRouter()
+	routes := NewRouteTable()
+	g := routes.Router(r)
+	g.Handle("GET", "/users", "a", noop)
+	g.Handle("POST", "/users", "b", noop)
+
+	if err := routes.Check(r); err != nil {
+		t.Errorf("Expected no conflicts, got %v", err)
+	}
+	if len(routes.Entries()) != 2 {
+		t.Errorf("Expected 2 entries, got %d", len(routes.Entries()))
+	}
+}
+
+func TestRouteTableCheck_VariableShadowsLiteral(t *testing.T) {
+	r := mux.NewRouter()
+	routes := NewRouteTable()
+	g := routes.Router(r)
+	g.Handle("GET", "/users/{id}", "HandleGetUserFull", noop)
+	g.Handle("GET", "/users/me", "HandleMe", noop)
+	g.Handle("GET", "/orders/{id:[0-9]+}", "a", noop)
+	g.Handle("GET", "/orders/{id}", "b", noop)
+	g.Handle("GET", "/orders/42", "c", noop)
+
+	err := routes.Check(r)
+	if err == nil || !strings.Contains(err.Error(), "GET /users/me -> HandleMe is unreachable: shadowed by GET /users/{id} -> HandleGetUserFull") {
+		t.Errorf("Expected /users/me to be reported, got %v", err)
+	}
+	if strings.Contains(err.Error(), "/orders/{id} -> b") {
+		t.Errorf("A constrained variable should not shadow an unconstrained one, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "GET /orders/42 -> c is unreachable: shadowed by GET /orders/{id:[0-9]+} -> a") {
+		t.Errorf("Expected /orders/42 to be reported, got %v", err)
+	}
+}
+
+func TestCovers(t *testing.T) {
+	cases := []struct {
+		prev, path string
+		want       bool
+	}{
+		{"/users/{id}", "/users/{userId}", true},
+		{"/users/{id}", "/users/me", true},
+		{"/users/{id}", "/users/{id:[0-9]+}", true},
+		{"/users/{id:[0-9]+}", "/users/{id}", false},
+		{"/users/{id:[0-9]+}", "/users/{n:[0-9]+}", true},
+		{"/users/{id:[0-9]+}", "/users/me", false},
+		{"/users/{id:[a-z]+}", "/users/me", true},
+		{"/users/{id}", "/users/{id}/password", false},
+		{"/files/{name}.json", "/files/a.json", true},
+		{"/files/{name}.json", "/files/a.xml", false},
+		{"/files/{path:[a-z/]+}", "/files/{path:[a-z/]+}", true},
+	}
+	for _, c := range cases {
+		if got := covers(c.prev, c.path); got != c.want {
+			t.Errorf("covers(%q, %q): expected %v, got %v", c.prev, c.path, c.want, got)
+		}
+	}
+}
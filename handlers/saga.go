@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"servicio-gateway/client"
+	"servicio-gateway/compensation"
+)
+
+// Estados de un update compuesto (header X-Update-Status y details.state)
+const (
+	// applied: todos los upstreams aceptaron su parte
+	updateApplied = "applied"
+	// failed: ninguno la aceptó, no hay nada que deshacer
+	updateFailed = "failed"
+	// rolled_back: alguno falló y los que la habían aplicado se restauraron
+	updateRolledBack = "rolled_back"
+	// inconsistent: alguna restauración falló (quedó registrada en Compensations)
+	// o algún upstream no respondió y no se sabe si aplicó su parte
+	updateInconsistent = "inconsistent"
+)
+
+// compensationAttempts y compensationBackoff rigen los reintentos del PUT
+// que restaura un upstream (variable para los tests)
+var (
+	compensationAttempts = 3
+	compensationBackoff  = 200 * time.Millisecond
+)
+
+// updateStep es la parte de un PUT compuesto que va a un upstream. Sin Part
+// el upstream no se toca: su snapshot completa la respuesta.
+type updateStep struct {
+	Service string
+	URL     string
+	Part    map[string]interface{}
+
+	snapshot map[string]interface{}
+	result   upstreamResult
+}
+
+func (s *updateStep) applied() bool {
+	return s.result.Err == nil && s.result.Status >= 200 && s.result.Status < 300
+}
+
+// outcomeUnknown: el PUT salió pero no hubo respuesta (timeout, conexión
+// cortada), así que el upstream pudo haberlo aplicado. Un circuito abierto,
+// un error de TLS o uno al conectar significan que el PUT nunca llegó.
+func (s *updateStep) outcomeUnknown() bool {
+	err := s.result.Err
+	if err == nil {
+		return false
+	}
+	var openErr *client.CircuitOpenError
+	var tlsErr *client.TLSError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &openErr), errors.As(err, &tlsErr):
+		return false
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return false
+	}
+	return true
+}
+
+// stepFailure describe una parte rechazada (details.failed)
+type stepFailure struct {
+	sourceFailure
+	Status int             `json:"status,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+// notRestored es una parte aplicada que no se pudo deshacer (details.notRestored)
+type notRestored struct {
+	Source    string `json:"source"`
+	JournalID string `json:"journalId,omitempty"`
+	Error     string `json:"error"`
+}
+
+// updateDetails es el details del ErrorBody cuando el update no se aplicó.
+// Unknown son las partes sin respuesta, que pudieron haberse aplicado.
+type updateDetails struct {
+	State       string        `json:"state"`
+	Failed      []stepFailure `json:"failed"`
+	RolledBack  []string      `json:"rolledBack,omitempty"`
+	NotRestored []notRestored `json:"notRestored,omitempty"`
+	Unknown     []string      `json:"unknown,omitempty"`
+}
+
+// runUpdateSaga aplica steps como una saga: toma un snapshot de cada upstream,
+// manda las partes en paralelo y, si alguna falla, restaura con un PUT del
+// snapshot las que ya se habían aplicado. Escribe la respuesta en w; si todo
+// sale bien la arma respond con el cuerpo de cada upstream.
+func runUpdateSaga(w http.ResponseWriter, r *http.Request, steps []*updateStep, respond func(http.ResponseWriter, map[string][]byte)) {
+	// 1. Snapshot del estado previo; si no se puede leer no se toca nada
+	gets := make([]upstreamCall, len(steps))
+	for i, s := range steps {
+		gets[i] = upstreamCall{Service: s.Service, Method: "GET", URL: s.URL, Headers: upstreamHeaders(r, s.Service)}
+	}
+	snapshots, err := fanOut(r.Context(), gets...)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	for i, snap := range snapshots {
+		if snap.Status < 200 || snap.Status >= 300 {
+			w.WriteHeader(snap.Status)
+			w.Write(snap.Body)
+			return
+		}
+		// sin un snapshot legible el update no se podría deshacer
+		if steps[i].snapshot, err = decodeSource(steps[i].Service, snap.Body); err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+	}
+
+	// 2. Las partes en paralelo; un fallo no cancela a las demás (un PUT
+	// cortado a medias sería peor que uno completo que se puede deshacer)
+	var changed []*updateStep
+	var puts []upstreamCall
+	for i, s := range steps {
+		if len(s.Part) == 0 {
+			s.result = snapshots[i]
+			continue
+		}
+		changed = append(changed, s)
+		puts = append(puts, upstreamCall{
+			Service: s.Service, Method: "PUT", URL: s.URL,
+			Body: jsonMarshal(s.Part), Headers: upstreamHeaders(r, s.Service), Optional: true,
+		})
+	}
+	results, _ := fanOut(r.Context(), puts...)
+
+	// undo: lo que hay que restaurar si algo falla; una parte sin respuesta
+	// cuenta como fallida y también se restaura, por si se aplicó
+	var undo, failed, unknown []*updateStep
+	for i, s := range changed {
+		s.result = results[i]
+		switch {
+		case s.applied():
+			undo = append(undo, s)
+		case s.outcomeUnknown():
+			undo = append(undo, s)
+			failed = append(failed, s)
+			unknown = append(unknown, s)
+		default:
+			failed = append(failed, s)
+		}
+	}
+
+	if len(failed) == 0 {
+		bodies := map[string][]byte{}
+		for _, s := range steps {
+			bodies[s.Service] = s.result.Body
+		}
+		w.Header().Set("X-Update-Status", updateApplied)
+		respond(w, bodies)
+		return
+	}
+
+	// 3. Compensar lo aplicado
+	details := updateDetails{State: updateFailed}
+	for _, s := range failed {
+		details.Failed = append(details.Failed, describeFailure(s))
+	}
+	for _, s := range unknown {
+		details.Unknown = append(details.Unknown, s.Service)
+	}
+	operation := r.Method + " " + r.URL.Path
+	for _, s := range undo {
+		if journalID, err := compensate(r, operation, s); err != nil {
+			details.NotRestored = append(details.NotRestored, notRestored{Source: s.Service, JournalID: journalID, Error: err.Error()})
+		} else {
+			details.RolledBack = append(details.RolledBack, s.Service)
+		}
+	}
+
+	status, code, message := updateFailureStatus(failed[0]), "update_failed", "update was not applied"
+	switch {
+	case len(details.NotRestored) > 0:
+		details.State = updateInconsistent
+		status, code = http.StatusBadGateway, "update_inconsistent"
+		message = "update partially applied and could not be rolled back"
+	case len(details.Unknown) > 0:
+		// aunque la restauración haya salido bien, el PUT sin respuesta
+		// todavía puede aplicarse después en el upstream
+		details.State = updateInconsistent
+		status, code = http.StatusBadGateway, "update_inconsistent"
+		message = "update outcome unknown for some parts; they were restored but may still be applied"
+	case len(details.RolledBack) > 0:
+		details.State = updateRolledBack
+		code, message = "update_rolled_back", "update failed and applied parts were rolled back"
+	}
+	log.Printf("[saga] %s: %s\n", operation, details.State)
+	w.Header().Set("X-Update-Status", details.State)
+	WriteErrorDetails(w, status, code, message, details)
+}
+
+// updateFailureStatus: un 4xx del upstream se devuelve tal cual (el cliente
+// tiene que corregir algo); cualquier otro fallo es un 502
+func updateFailureStatus(s *updateStep) int {
+	if s.result.Err == nil && s.result.Status >= 400 && s.result.Status < 500 {
+		return s.result.Status
+	}
+	if s.result.Err != nil {
+		status, _ := upstreamErrorCode(s.result.Err)
+		return status
+	}
+	return http.StatusBadGateway
+}
+
+func describeFailure(s *updateStep) stepFailure {
+	if s.result.Err != nil {
+		_, code := upstreamErrorCode(s.result.Err)
+		return stepFailure{sourceFailure: sourceFailure{Source: s.Service, Error: code, Message: s.result.Err.Error()}}
+	}
+	f := stepFailure{
+		sourceFailure: sourceFailure{
+			Source:  s.Service,
+			Error:   "upstream_rejected",
+			Message: fmt.Sprintf("%s responded %d", s.Service, s.result.Status),
+		},
+		Status: s.result.Status,
+	}
+	if json.Valid(s.result.Body) {
+		f.Body = s.result.Body
+	}
+	return f
+}
+
+// restoreBody arma el PUT que deshace s: el valor previo de cada campo
+// enviado. Los que no estaban en el snapshot no se pueden restaurar.
+func restoreBody(s *updateStep) ([]byte, []string) {
+	restore := map[string]interface{}{}
+	var unrestorable []string
+	for k := range s.Part {
+		if v, ok := s.snapshot[k]; ok {
+			restore[k] = v
+		} else {
+			unrestorable = append(unrestorable, k)
+		}
+	}
+	sort.Strings(unrestorable)
+	return jsonMarshal(restore), unrestorable
+}
+
+// compensate restaura s reintentando; si no lo logra lo registra en
+// Compensations y devuelve el ID de la entrada junto con el error
+func compensate(r *http.Request, operation string, s *updateStep) (string, error) {
+	body, unrestorable := restoreBody(s)
+	// la restauración sigue aunque el cliente se haya ido, y no gasta del
+	// presupuesto de reintentos de la petición: tiene los suyos
+	ctx := client.WithRetryBudget(context.WithoutCancel(r.Context()), 0)
+	headers := upstreamHeaders(r, s.Service)
+
+	var lastErr error
+	attempt, backoff := 0, compensationBackoff
+	for attempt < compensationAttempts {
+		if attempt++; attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		actx, cancel := context.WithTimeout(ctx, CurrentConfig().CompositeTimeout.Std())
+		status, respBody, _, err := client.ProxyRequestContext(actx, s.Service, "PUT", s.URL, bytes.NewReader(body), headers)
+		cancel()
+		if err == nil && status >= 200 && status < 300 {
+			lastErr = nil
+			break
+		}
+		if err == nil {
+			err = fmt.Errorf("%s responded %d: %s", s.Service, status, respBody)
+		}
+		lastErr = err
+		log.Printf("[saga] %s: restoring %s, attempt %d/%d failed: %v\n", operation, s.Service, attempt, compensationAttempts, err)
+	}
+	if lastErr == nil && len(unrestorable) == 0 {
+		log.Printf("[saga] %s: %s restored\n", operation, s.Service)
+		return "", nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("fields not in snapshot cannot be restored: %v", unrestorable)
+	}
+
+	entry := compensation.Entry{
+		Operation:    operation,
+		Service:      s.Service,
+		Method:       "PUT",
+		URL:          s.URL,
+		Body:         body,
+		Unrestorable: unrestorable,
+		Attempts:     attempt,
+		Error:        lastErr.Error(),
+	}
+	if Compensations == nil {
+		log.Printf("[saga] %s: %s NOT restored (no journal): %+v\n", operation, s.Service, entry)
+		return "", lastErr
+	}
+	recorded, err := Compensations.Record(entry)
+	if err != nil {
+		log.Printf("[saga] %s: %s NOT restored and could not be journaled (%v): %+v\n", operation, s.Service, err, entry)
+		return "", lastErr
+	}
+	log.Printf("[saga] %s: %s NOT restored, journal entry %s\n", operation, s.Service, recorded.ID)
+	return recorded.ID, lastErr
+}
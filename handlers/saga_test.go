@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"servicio-gateway/compensation"
+)
+
+// statefulServer guarda un documento JSON: GET lo devuelve y PUT le mezcla
+// los campos recibidos. putStatus decide la respuesta de cada PUT (n empieza
+// en 1); hangUp aplica el PUT y corta la conexión sin responder. Los tests
+// leen el estado con get y received, que toman mu como el handler.
+type statefulServer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	state     map[string]interface{}
+	puts      []map[string]interface{}
+	putStatus func(n int) int
+}
+
+func newStatefulServer(t *testing.T, state map[string]interface{}, putStatus func(n int) int) *statefulServer {
+	s := &statefulServer{state: state, putStatus: putStatus}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == "PUT" {
+			var part map[string]interface{}
+			body, _ := io.ReadAll(r.Body)
+			json.Unmarshal(body, &part)
+			s.puts = append(s.puts, part)
+			status := s.putStatus(len(s.puts))
+			if status != http.StatusOK && status != hangUp {
+				w.WriteHeader(status)
+				w.Write([]byte(`{"error":"rejected"}`))
+				return
+			}
+			for k, v := range part {
+				s.state[k] = v
+			}
+			if status == hangUp {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(s.state)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// get devuelve el campo k del documento guardado
+func (s *statefulServer) get(k string) interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state[k]
+}
+
+// received devuelve los PUT recibidos hasta ahora
+func (s *statefulServer) received() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]map[string]interface{}(nil), s.puts...)
+}
+
+const hangUp = -1
+
+func always(status int) func(int) int {
+	return func(int) int { return status }
+}
+
+// updateUserFull arma los upstreams por env y llama a HandleUpdateUserFull
+func updateUserFull(t *testing.T, securityURL, profileURL, body string) *httptest.ResponseRecorder {
+	setEnv(t, "SECURITY_URL", securityURL)
+	setEnv(t, "PROFILE_URL", profileURL)
+	origJournal, origBackoff := Compensations, compensationBackoff
+	Compensations, compensationBackoff = compensation.NewMemoryJournal(), 0
+	t.Cleanup(func() {
+		Compensations, compensationBackoff = origJournal, origBackoff
+	})
+
+	req := httptest.NewRequest("PUT", "/users/42", bytes.NewBufferString(body))
+	req = mux.SetURLVars(req, map[string]string{"id": "42"})
+	w := httptest.NewRecorder()
+	HandleUpdateUserFull(w, req)
+	return w
+}
+
+func decodeUpdateDetails(t *testing.T, w *httptest.ResponseRecorder) (ErrorBody, updateDetails) {
+	var details updateDetails
+	body := ErrorBody{Details: &details}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Expected an error body, got %q", w.Body.String())
+	}
+	return body, details
+}
+
+func TestHandleUpdateUserFull_Applied(t *testing.T) {
+	security := newStatefulServer(t, map[string]interface{}{"email": "old@example.com"}, always(http.StatusOK))
+	profile := newStatefulServer(t, map[string]interface{}{"bio": "old"}, always(http.StatusOK))
+
+	w := updateUserFull(t, security.URL, profile.URL, `{"email":"new@example.com","bio":"new"}`)
+
+	if w.Code != http.StatusOK || w.Header().Get("X-Update-Status") != updateApplied {
+		t.Fatalf("Expected 200 applied, got %d %q", w.Code, w.Header().Get("X-Update-Status"))
+	}
+	var merged map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &merged)
+	if merged["email"] != "new@example.com" || merged["bio"] != "new" {
+		t.Errorf("Expected the merged updated user, got %v", merged)
+	}
+}
+
+func TestHandleUpdateUserFull_RollsBackSecurity(t *testing.T) {
+	security := newStatefulServer(t, map[string]interface{}{"email": "old@example.com", "username": "ana"}, always(http.StatusOK))
+	profile := newStatefulServer(t, map[string]interface{}{"bio": "old"}, always(http.StatusUnprocessableEntity))
+
+	w := updateUserFull(t, security.URL, profile.URL, `{"email":"new@example.com","bio":"new"}`)
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected the profile 422, got %d", w.Code)
+	}
+	if w.Header().Get("X-Update-Status") != updateRolledBack {
+		t.Errorf("Expected X-Update-Status rolled_back, got %q", w.Header().Get("X-Update-Status"))
+	}
+	body, details := decodeUpdateDetails(t, w)
+	if body.Code != "update_rolled_back" || details.State != updateRolledBack {
+		t.Errorf("Expected update_rolled_back, got %q / %q", body.Code, details.State)
+	}
+	if len(details.Failed) != 1 || details.Failed[0].Source != "profile" || details.Failed[0].Status != http.StatusUnprocessableEntity {
+		t.Errorf("Expected profile to be reported as failed, got %+v", details.Failed)
+	}
+	if len(details.RolledBack) != 1 || details.RolledBack[0] != "security" {
+		t.Errorf("Expected security to be rolled back, got %v", details.RolledBack)
+	}
+
+	if security.get("email") != "old@example.com" {
+		t.Errorf("Expected security email to be restored, got %v", security.get("email"))
+	}
+	// la restauración solo manda los campos que se cambiaron
+	puts := security.received()
+	if restore := puts[len(puts)-1]; len(restore) != 1 {
+		t.Errorf("Expected the compensation to send only email, got %v", restore)
+	}
+	if entries, _ := Compensations.Entries(); len(entries) != 0 {
+		t.Errorf("Expected no journal entries, got %d", len(entries))
+	}
+}
+
+func TestHandleUpdateUserFull_InconsistentWhenCompensationFails(t *testing.T) {
+	// el primer PUT (el update) sale bien, la restauración falla siempre
+	security := newStatefulServer(t, map[string]interface{}{"email": "old@example.com"}, func(n int) int {
+		if n == 1 {
+			return http.StatusOK
+		}
+		return http.StatusInternalServerError
+	})
+	profile := newStatefulServer(t, map[string]interface{}{"bio": "old"}, always(http.StatusBadRequest))
+
+	w := updateUserFull(t, security.URL, profile.URL, `{"email":"new@example.com","bio":"new"}`)
+
+	if w.Code != http.StatusBadGateway || w.Header().Get("X-Update-Status") != updateInconsistent {
+		t.Fatalf("Expected 502 inconsistent, got %d %q", w.Code, w.Header().Get("X-Update-Status"))
+	}
+	body, details := decodeUpdateDetails(t, w)
+	if body.Code != "update_inconsistent" || len(details.NotRestored) != 1 {
+		t.Fatalf("Expected one unrestored step, got %q %+v", body.Code, details.NotRestored)
+	}
+
+	entries, _ := Compensations.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("Expected 1 journal entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.ID != details.NotRestored[0].JournalID {
+		t.Errorf("Expected the response to reference journal entry %s, got %s", e.ID, details.NotRestored[0].JournalID)
+	}
+	if e.Service != "security" || e.Method != "PUT" || e.Attempts != compensationAttempts {
+		t.Errorf("Unexpected journal entry %+v", e)
+	}
+	if string(e.Body) != `{"email":"old@example.com"}` {
+		t.Errorf("Expected the journal to keep the restoring body, got %s", e.Body)
+	}
+}
+
+func TestHandleUpdateUserFull_PasswordIsUnrestorable(t *testing.T) {
+	// el snapshot nunca trae el password
+	security := newStatefulServer(t, map[string]interface{}{"email": "old@example.com"}, always(http.StatusOK))
+	profile := newStatefulServer(t, map[string]interface{}{"bio": "old"}, always(http.StatusBadRequest))
+
+	w := updateUserFull(t, security.URL, profile.URL, `{"email":"new@example.com","password":"s3cret","bio":"new"}`)
+
+	if w.Header().Get("X-Update-Status") != updateInconsistent {
+		t.Fatalf("Expected inconsistent, got %q", w.Header().Get("X-Update-Status"))
+	}
+	if security.get("email") != "old@example.com" {
+		t.Errorf("Expected the restorable fields to be restored anyway, got %v", security.get("email"))
+	}
+	entries, _ := Compensations.Entries()
+	if len(entries) != 1 || len(entries[0].Unrestorable) != 1 || entries[0].Unrestorable[0] != "password" {
+		t.Errorf("Expected password to be journaled as unrestorable, got %+v", entries)
+	}
+}
+
+func TestHandleUpdateUserFull_UnknownOutcomeIsInconsistent(t *testing.T) {
+	security := newStatefulServer(t, map[string]interface{}{"email": "old@example.com"}, always(http.StatusOK))
+	// profile aplica el PUT pero la respuesta nunca llega
+	profile := newStatefulServer(t, map[string]interface{}{"bio": "old"}, always(hangUp))
+
+	w := updateUserFull(t, security.URL, profile.URL, `{"email":"new@example.com","bio":"new"}`)
+
+	if w.Code != http.StatusBadGateway || w.Header().Get("X-Update-Status") != updateInconsistent {
+		t.Fatalf("Expected 502 inconsistent, got %d %q", w.Code, w.Header().Get("X-Update-Status"))
+	}
+	body, details := decodeUpdateDetails(t, w)
+	if body.Code != "update_inconsistent" || len(details.Unknown) != 1 || details.Unknown[0] != "profile" {
+		t.Errorf("Expected profile to be reported as unknown, got %q %+v", body.Code, details)
+	}
+	if security.get("email") != "old@example.com" {
+		t.Errorf("Expected security to be rolled back, got %v", security.get("email"))
+	}
+	// el PUT sin respuesta se aplicó: se intentó restaurar igual que uno aplicado
+	if profile.get("bio") != "old" {
+		t.Errorf("Expected the profile restore to be attempted, got %v", profile.get("bio"))
+	}
+	if entries, _ := Compensations.Entries(); len(entries) != 1 || entries[0].Service != "profile" {
+		t.Errorf("Expected the unconfirmed profile restore to be journaled, got %+v", entries)
+	}
+}
+
+func TestHandleUpdateUserFull_BothFailNothingToUndo(t *testing.T) {
+	security := newStatefulServer(t, map[string]interface{}{"email": "old@example.com"}, always(http.StatusConflict))
+	profile := newStatefulServer(t, map[string]interface{}{"bio": "old"}, always(http.StatusBadRequest))
+
+	w := updateUserFull(t, security.URL, profile.URL, `{"email":"new@example.com","bio":"new"}`)
+
+	if w.Header().Get("X-Update-Status") != updateFailed {
+		t.Errorf("Expected failed, got %q", w.Header().Get("X-Update-Status"))
+	}
+	if len(security.received()) != 1 || len(profile.received()) != 1 {
+		t.Errorf("Expected no compensations, got %d and %d PUTs", len(security.received()), len(profile.received()))
+	}
+}
+
+func TestHandleUpdateUserFull_InvalidSnapshotWritesNothing(t *testing.T) {
+	var securityPuts atomic.Int32
+	security := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			securityPuts.Add(1)
+		}
+		w.Write([]byte("<html>maintenance</html>"))
+	}))
+	defer security.Close()
+	profile := newStatefulServer(t, map[string]interface{}{"bio": "old"}, always(http.StatusOK))
+
+	w := updateUserFull(t, security.URL, profile.URL, `{"email":"new@example.com","bio":"new"}`)
+
+	var body ErrorBody
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusBadGateway || body.Code != "upstream_invalid_json" {
+		t.Errorf("Expected 502 upstream_invalid_json, got %d %s", w.Code, w.Body.String())
+	}
+	if securityPuts.Load() != 0 || len(profile.received()) != 0 {
+		t.Errorf("Expected no update without a usable snapshot, got %d and %d PUTs", securityPuts.Load(), len(profile.received()))
+	}
+}
+
+func TestHandleListCompensations(t *testing.T) {
+	orig := Compensations
+	defer func() { Compensations = orig }()
+
+	Compensations = nil
+	w := httptest.NewRecorder()
+	HandleListCompensations(w, httptest.NewRequest("GET", "/admin/compensations", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 without a journal, got %d", w.Code)
+	}
+
+	Compensations = compensation.NewMemoryJournal()
+	Compensations.Record(compensation.Entry{Service: "security"})
+	w = httptest.NewRecorder()
+	HandleListCompensations(w, httptest.NewRequest("GET", "/admin/compensations", nil))
+	var body struct {
+		Entries []compensation.Entry `json:"entries"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if w.Code != http.StatusOK || len(body.Entries) != 1 {
+		t.Errorf("Expected 1 entry, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"servicio-gateway/client"
+)
+
+// streamBufferSize es lo máximo que se retiene en memoria por petición
+const streamBufferSize = 32 * 1024
+
+// streamWriteIdle es cuánto puede tardar el cliente en aceptar cada bloque
+// del cuerpo. El plazo se renueva en cada escritura: un stream largo sigue
+// vivo, pero un cliente trabado libera el handler y la conexión al upstream.
+var streamWriteIdle = 15 * time.Second
+
+// proxyStream reenvía r a target sin bufferizar: el cuerpo de la petición y
+// el de la respuesta se copian a medida que llegan. Lo usan las rutas de paso
+// directo; los handlers compuestos siguen usando client.ProxyRequestContext.
+func proxyStream(w http.ResponseWriter, r *http.Request, service, method, target string) {
+	var body io.Reader
+	if r.ContentLength != 0 {
+		body = r.Body
+	}
+	req, err := http.NewRequestWithContext(r.Context(), method, target, body)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	req.ContentLength = r.ContentLength
+	req.Header = upstreamHeaders(r, service)
+
+	// sin timeout total: el cuerpo puede durar más que el timeout del upstream
+	resp, err := client.DoStream(service, req)
+	if err != nil {
+		writeUpstreamError(w, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	copyResponse(w, resp)
+}
+
+// copyResponse escribe status, headers, cuerpo y trailers de resp en w.
+// Las respuestas de largo desconocido (chunked) o text/event-stream se
+// vuelcan al cliente después de cada escritura.
+func copyResponse(w http.ResponseWriter, resp *http.Response) {
+	CopyHeaders(w.Header(), resp.Header)
+
+	// Los trailers se anuncian antes del status y se completan al final
+	announced := map[string]bool{}
+	for k := range resp.Trailer {
+		announced[k] = true
+		w.Header().Add("Trailer", k)
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	flush := resp.ContentLength == -1 || mediaType == "text/event-stream"
+	rc := http.NewResponseController(w)
+
+	buf := make([]byte, streamBufferSize)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			// en lugar del WriteTimeout del servidor, que cortaría el cuerpo
+			// igual que un timeout total
+			rc.SetWriteDeadline(time.Now().Add(streamWriteIdle))
+			if _, err := w.Write(buf[:n]); err != nil {
+				// el cliente se fue; cerrar resp.Body corta también al upstream
+				return
+			}
+			if flush {
+				rc.Flush()
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			log.Printf("[proxy] upstream body aborted after headers were sent: %v\n", readErr)
+			// Cortar la conexión para que el cliente no tome la respuesta como completa
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	// el cierre del cuerpo y los trailers se escriben al volver del handler
+	rc.SetWriteDeadline(time.Now().Add(streamWriteIdle))
+	for k, vv := range resp.Trailer {
+		if !announced[k] {
+			// trailer que el upstream no anunció: va con el prefijo especial
+			k = http.TrailerPrefix + k
+		}
+		w.Header()[k] = vv
+	}
+}
@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"servicio-gateway/client"
+	"servicio-gateway/config"
+)
+
+// bigBody sirve size bytes en bloques de 32KB sin armarlos en memoria
+func bigBody(size int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chunk := bytes.Repeat([]byte("x"), 32*1024)
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		for sent := int64(0); sent < size; sent += int64(len(chunk)) {
+			if rest := size - sent; rest < int64(len(chunk)) {
+				chunk = chunk[:rest]
+			}
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func useProfileUpstream(t testing.TB, h http.Handler) {
+	upstream := httptest.NewServer(h)
+	setEnv(t, "PROFILE_URL", upstream.URL)
+	t.Cleanup(upstream.Close)
+}
+
+func TestProxyStream_FlushesBeforeUpstreamFinishes(t *testing.T) {
+	release := make(chan struct{})
+	useProfileUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second\n"))
+	}))
+	defer close(release)
+
+	gateway := httptest.NewServer(MakeProxy("profile", "GET", "/stream"))
+	defer gateway.Close()
+
+	resp, err := http.Get(gateway.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	// Si el gateway bufferizara, esta lectura se bloquearía hasta el release
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil || line != "first\n" {
+		t.Errorf("Expected first chunk before the upstream finished, got %q (%v)", line, err)
+	}
+}
+
+func TestProxyStream_PropagatesTrailers(t *testing.T) {
+	useProfileUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Write([]byte("payload"))
+		w.Header().Set("X-Checksum", "abc123")
+	}))
+
+	gateway := httptest.NewServer(MakeProxy("profile", "GET", "/t"))
+	defer gateway.Close()
+
+	resp, err := http.Get(gateway.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "payload" {
+		t.Errorf("Expected 'payload', got '%s'", body)
+	}
+	if got := resp.Trailer.Get("X-Checksum"); got != "abc123" {
+		t.Errorf("Expected trailer 'abc123', got '%s'", got)
+	}
+}
+
+func TestProxyStream_StreamsRequestBody(t *testing.T) {
+	useProfileUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		w.Write([]byte(strconv.FormatInt(n, 10)))
+	}))
+
+	gateway := httptest.NewServer(MakeProxy("profile", "POST", "/upload"))
+	defer gateway.Close()
+
+	resp, err := http.Post(gateway.URL, "application/octet-stream", io.LimitReader(neverEnding('y'), 5<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != strconv.Itoa(5<<20) {
+		t.Errorf("Expected upstream to receive %d bytes, got %s", 5<<20, body)
+	}
+}
+
+// useProfileTimeout registra profile con un timeout total de timeout
+func useProfileTimeout(t *testing.T, timeout time.Duration) {
+	transport, err := client.NewTransport("profile", config.UpstreamConfig{
+		Transport: config.TransportConfig{Timeout: config.Duration(timeout)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := client.Upstreams
+	client.Upstreams = client.NewRegistry()
+	client.Upstreams.Register("profile", transport, nil, nil)
+	t.Cleanup(func() { client.Upstreams = orig })
+}
+
+func TestProxyStream_SlowBodyOutlivesClientTimeout(t *testing.T) {
+	useProfileTimeout(t, 100*time.Millisecond)
+	useStreamWriteIdle(t, 50*time.Millisecond)
+	useProfileUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 4; i++ {
+			w.Write([]byte("tick\n"))
+			w.(http.Flusher).Flush()
+			time.Sleep(75 * time.Millisecond)
+		}
+	}))
+
+	gateway := httptest.NewServer(MakeProxy("profile", "GET", "/events"))
+	defer gateway.Close()
+
+	resp, err := http.Get(gateway.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// 4 × 75ms: el cuerpo dura el triple del timeout del upstream y cada pausa
+	// supera streamWriteIdle, que solo cuenta mientras se escribe
+	if err != nil || string(body) != "tick\ntick\ntick\ntick\n" {
+		t.Errorf("Expected the whole body despite the 100ms timeout, got %q (%v)", body, err)
+	}
+}
+
+func TestProxyStream_HeaderTimeout(t *testing.T) {
+	useProfileTimeout(t, 50*time.Millisecond)
+	release := make(chan struct{})
+	defer close(release)
+	useProfileUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+
+	w := httptest.NewRecorder()
+	MakeProxy("profile", "GET", "/slow")(w, httptest.NewRequest("GET", "/slow", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("Expected 504 when the headers never arrive, got %d", w.Code)
+	}
+}
+
+// useStreamWriteIdle acorta streamWriteIdle durante el test
+func useStreamWriteIdle(t *testing.T, d time.Duration) {
+	orig := streamWriteIdle
+	streamWriteIdle = d
+	t.Cleanup(func() { streamWriteIdle = orig })
+}
+
+func TestProxyStream_StalledClientIsCutOff(t *testing.T) {
+	useStreamWriteIdle(t, 100*time.Millisecond)
+	upstreamDone := make(chan struct{})
+	useProfileUpstream(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(upstreamDone)
+		chunk := bytes.Repeat([]byte("x"), 32*1024)
+		for {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+		}
+	}))
+
+	handlerDone := make(chan struct{})
+	proxy := MakeProxy("profile", "GET", "/download")
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(handlerDone)
+		proxy(w, r)
+	}))
+	defer gateway.Close()
+
+	// un cliente que manda la petición y nunca lee la respuesta
+	conn, err := net.Dial("tcp", gateway.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("GET /download HTTP/1.1\r\nHost: gateway\r\n\r\n"))
+
+	for name, done := range map[string]chan struct{}{"handler": handlerDone, "upstream": upstreamDone} {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected the %s to be released once the client stalled", name)
+		}
+	}
+}
+
+func TestProxyStream_BoundedMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("transfers 100MB")
+	}
+	const size = 100 << 20
+	useProfileUpstream(t, bigBody(size))
+
+	gateway := httptest.NewServer(MakeProxy("profile", "GET", "/users"))
+	defer gateway.Close()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	resp, err := http.Get(gateway.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, _ := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	runtime.ReadMemStats(&after)
+
+	if n != size {
+		t.Fatalf("Expected %d bytes, got %d", size, n)
+	}
+	// Upstream, gateway y cliente corren en este proceso: todo lo asignado
+	// tiene que quedar muy por debajo del tamaño de la respuesta
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > size/4 {
+		t.Errorf("Expected bounded allocations while streaming, got %d MB", alloc>>20)
+	}
+}
+
+type neverEnding byte
+
+func (b neverEnding) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(b)
+	}
+	return len(p), nil
+}
+
+func benchmarkProxy(b *testing.B, h http.HandlerFunc) {
+	const size = 100 << 20
+	useProfileUpstream(b, bigBody(size))
+	gateway := httptest.NewServer(h)
+	defer gateway.Close()
+
+	b.SetBytes(size)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := http.Get(gateway.URL)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+}
+
+// go test ./handlers -run '^$' -bench Proxy100MB -benchmem
+func BenchmarkStreamingProxy100MB(b *testing.B) {
+	benchmarkProxy(b, MakeProxy("profile", "GET", "/users"))
+}
+
+// Referencia: el camino bufferizado que siguen usando los handlers compuestos
+func BenchmarkBufferedProxy100MB(b *testing.B) {
+	benchmarkProxy(b, func(w http.ResponseWriter, r *http.Request) {
+		status, body, headers, err := client.ProxyRequestTo("profile", "GET", CurrentConfig().ProfileURL+"/users", nil, http.Header{})
+		if err != nil {
+			writeUpstreamError(w, err)
+			return
+		}
+		CopyHeaders(w.Header(), headers)
+		w.WriteHeader(status)
+		w.Write(body)
+	})
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"servicio-gateway/client"
+)
+
+// HandleUpstreamStats muestra el estado del pool de conexiones de cada upstream
+func HandleUpstreamStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"upstreams": client.Upstreams.Stats(),
+	})
+}
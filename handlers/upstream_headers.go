@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"servicio-gateway/auth"
+	"servicio-gateway/identity"
+)
+
+// upstreamHeaders arma los headers que se mandan al servicio: los del
+// cliente sin hop-by-hop, API key ni identidad falsificable, con
+// X-Forwarded-*, más la identidad verificada (firmada si hay secreto) y el
+// Authorization solo si el servicio lo quiere.
+func upstreamHeaders(r *http.Request, service string) http.Header {
+	cfg := CurrentConfig()
+	h := r.Header.Clone()
+
+	stripHopByHop(h)
+	setForwardedHeaders(h, r, ClientIPResolver())
+	identity.Strip(h, cfg.Identity)
+	h.Del(cfg.APIKeys.Header)
+	if !cfg.ForwardToken(service) {
+		h.Del("Authorization")
+	}
+
+	if who, ok := auth.FromRequest(r); ok {
+		identity.Apply(h, who.Claims, cfg.Identity, time.Now())
+	}
+	return h
+}
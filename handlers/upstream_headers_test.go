@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"servicio-gateway/auth"
+)
+
+func TestMakeProxy_ForwardsVerifiedIdentityOnly(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	setEnv(t, "PROFILE_URL", upstream.URL)
+	setEnv(t, "PROFILE_FORWARD_TOKEN", "false")
+
+	req := httptest.NewRequest("GET", "/profiles/42", nil)
+	req.Header.Set("Authorization", "Bearer abc")
+	req.Header.Set("X-User-Id", "1")
+	req.Header.Set("X-User-Roles", "admin")
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{
+		Subject: "42",
+		Claims:  map[string]interface{}{"sub": "42", "email": "a@example.com"},
+	}))
+
+	MakeProxy("profile", "GET", "/api/v1/profiles/42")(httptest.NewRecorder(), req)
+
+	if got.Get("X-User-Id") != "42" {
+		t.Errorf("Expected X-User-Id '42', got '%s'", got.Get("X-User-Id"))
+	}
+	if got.Get("X-User-Roles") != "" {
+		t.Errorf("Expected spoofed X-User-Roles to be stripped, got '%s'", got.Get("X-User-Roles"))
+	}
+	if got.Get("Authorization") != "" {
+		t.Errorf("Expected Authorization not to be forwarded, got '%s'", got.Get("Authorization"))
+	}
+	if req.Header.Get("X-User-Id") != "1" {
+		t.Error("Expected inbound request headers to be left untouched")
+	}
+}
+
+func TestUpstreamHeaders_NeverForwardsAPIKey(t *testing.T) {
+	var got http.Header
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer upstream.Close()
+
+	setEnv(t, "SECURITY_URL", upstream.URL)
+	setEnv(t, "APIKEY_HEADER", "X-Client-Key")
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	req.Header.Set("X-Client-Key", "sk_live_secret")
+	req = req.WithContext(auth.WithPrincipal(req.Context(), &auth.Principal{Method: "apikey", APIKey: "billing"}))
+
+	MakeProxy("security", "GET", "/api/v1/users/42")(httptest.NewRecorder(), req)
+
+	if got == nil {
+		t.Fatal("Expected the request to reach the upstream")
+	}
+	if got.Get("X-Client-Key") != "" {
+		t.Errorf("Expected the API key not to be forwarded, got '%s'", got.Get("X-Client-Key"))
+	}
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	"servicio-gateway/config"
+)
+
+// userSchema es el reparto de campos del usuario compuesto entre upstreams
+// (config.CompositeUser): split lo aplica a un PUT y compose, al revés, a las
+// respuestas de los upstreams.
+type userSchema struct {
+	config.CompositeUserConfig
+}
+
+func currentUserSchema() userSchema {
+	return userSchema{CurrentConfig().CompositeUser}
+}
+
+// fieldErrors son los campos de un PUT que no se pueden aplicar
+type fieldErrors struct {
+	Unknown  []string `json:"unknown,omitempty"`
+	ReadOnly []string `json:"readOnly,omitempty"`
+}
+
+// split reparte payload entre los servicios dueños de cada campo, ya con el
+// nombre que usa cada upstream. Un objeto cuyo path no es un campo pero sí
+// contiene campos (profile en profile.address.city) se recorre por dentro.
+func (s userSchema) split(payload map[string]interface{}) (map[string]map[string]interface{}, fieldErrors) {
+	parts := map[string]map[string]interface{}{}
+	var errs fieldErrors
+	s.splitInto(parts, &errs, "", payload)
+	sort.Strings(errs.Unknown)
+	sort.Strings(errs.ReadOnly)
+	return parts, errs
+}
+
+func (s userSchema) splitInto(parts map[string]map[string]interface{}, errs *fieldErrors, prefix string, obj map[string]interface{}) {
+	for k, v := range obj {
+		path := joinPath(prefix, k)
+		if route, ok := s.Fields[path]; ok {
+			if route.ReadOnly {
+				errs.ReadOnly = append(errs.ReadOnly, path)
+				continue
+			}
+			if parts[route.Service] == nil {
+				parts[route.Service] = map[string]interface{}{}
+			}
+			setPath(parts[route.Service], route.UpstreamField(path), v)
+			continue
+		}
+		if child, ok := v.(map[string]interface{}); ok && s.hasFieldsUnder(path) {
+			s.splitInto(parts, errs, path, child)
+			continue
+		}
+		errs.Unknown = append(errs.Unknown, path)
+	}
+}
+
+// sameID indica si v, un valor decodificado de JSON, es el id de la URL
+func sameID(v interface{}, id string) bool {
+	switch v := v.(type) {
+	case string:
+		return v == id
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64) == id
+	}
+	return false
+}
+
+func (s userSchema) hasFieldsUnder(path string) bool {
+	for p := range s.Fields {
+		if strings.HasPrefix(p, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSource interpreta el cuerpo que devolvió service; un cuerpo vacío
+// (204) es un objeto vacío y cualquier otra cosa que no sea un objeto JSON
+// es un *invalidJSONError
+func decodeSource(service string, body []byte) (map[string]interface{}, error) {
+	doc := map[string]interface{}{}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return doc, nil
+	}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, &invalidJSONError{Service: service, Err: err}
+	}
+	if doc == nil {
+		return nil, &invalidJSONError{Service: service, Err: errors.New("null is not an object")}
+	}
+	return doc, nil
+}
+
+// compose decodifica el cuerpo de cada fuente (por servicio; las que faltan
+// se omiten) y los une según strategy
+func (s userSchema) compose(strategy string, bodies map[string][]byte) (map[string]interface{}, error) {
+	docs := map[string]map[string]interface{}{}
+	for service, body := range bodies {
+		doc, err := decodeSource(service, body)
+		if err != nil {
+			return nil, err
+		}
+		docs[service] = doc
+	}
+	return s.merge(strategy, docs), nil
+}
+
+// merge une los documentos de cada fuente según strategy (ver mergeStrategy)
+func (s userSchema) merge(strategy string, docs map[string]map[string]interface{}) map[string]interface{} {
+	if strategy == config.MergeNested {
+		return s.nested(docs)
+	}
+	return s.flat(docs)
+}
+
+// nested devuelve el documento de cada fuente tal cual, bajo su sección
+func (s userSchema) nested(docs map[string]map[string]interface{}) map[string]interface{} {
+	user := map[string]interface{}{}
+	for _, src := range s.Sources {
+		if doc, ok := docs[src.Service]; ok {
+			user[src.SectionName()] = doc
+		}
+	}
+	return user
+}
+
+// flat ubica cada campo del esquema en su path del gateway, leyéndolo de la
+// primera fuente de su From que lo tenga; lo que los upstreams devuelven fuera
+// del esquema pasa tal cual, sin pisar lo que ya está (gana la fuente anterior)
+func (s userSchema) flat(docs map[string]map[string]interface{}) map[string]interface{} {
+	user := map[string]interface{}{}
+	for path, route := range s.Fields {
+		found := false
+		for _, service := range route.ReadFrom() {
+			doc, ok := docs[service]
+			if !ok {
+				continue
+			}
+			// se quita de todas las fuentes para que no vuelva a aparecer abajo
+			if v, ok := takePath(doc, route.UpstreamField(path)); ok && !found {
+				setPath(user, path, v)
+				found = true
+			}
+		}
+	}
+	for _, src := range s.Sources {
+		for k, v := range docs[src.Service] {
+			if _, ok := user[k]; !ok {
+				user[k] = v
+			}
+		}
+	}
+	return user
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// setPath asigna v en la ruta con puntos path, creando los objetos intermedios
+func setPath(m map[string]interface{}, path string, v interface{}) {
+	segs := strings.Split(path, ".")
+	for _, seg := range segs[:len(segs)-1] {
+		child, ok := m[seg].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			m[seg] = child
+		}
+		m = child
+	}
+	m[segs[len(segs)-1]] = v
+}
+
+// takePath quita y devuelve el valor en path; los objetos que quedan vacíos
+// también se quitan
+func takePath(m map[string]interface{}, path string) (interface{}, bool) {
+	seg, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		v, ok := m[seg]
+		delete(m, seg)
+		return v, ok
+	}
+	child, ok := m[seg].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	v, ok := takePath(child, rest)
+	if len(child) == 0 {
+		delete(m, seg)
+	}
+	return v, ok
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"servicio-gateway/config"
+)
+
+func testSchema() userSchema {
+	return userSchema{config.CompositeUserConfig{
+		Sources: []config.CompositeSource{
+			{Service: "security", Path: "/users/{id}"},
+			{Service: "profile", Path: "/profiles/{id}"},
+		},
+		Fields: map[string]config.FieldRoute{
+			"id":                   {Service: "security", ReadOnly: true},
+			"email":                {Service: "security", Field: "mail"},
+			"profile.displayName":  {Service: "profile", Field: "name"},
+			"profile.address.city": {Service: "profile", Field: "address.city"},
+		},
+	}}
+}
+
+func TestUserSchema_Split(t *testing.T) {
+	var payload map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"email": "a@example.com",
+		"profile": {"displayName": "Ana", "address": {"city": "Lima", "zip": "15001"}},
+		"nickname": "x",
+		"id": "42"
+	}`), &payload)
+
+	parts, errs := testSchema().split(payload)
+
+	if !reflect.DeepEqual(errs.Unknown, []string{"nickname", "profile.address.zip"}) {
+		t.Errorf("Expected unknown nickname and profile.address.zip, got %v", errs.Unknown)
+	}
+	if !reflect.DeepEqual(errs.ReadOnly, []string{"id"}) {
+		t.Errorf("Expected read-only id, got %v", errs.ReadOnly)
+	}
+	if got := string(jsonMarshal(parts["security"])); got != `{"mail":"a@example.com"}` {
+		t.Errorf("Unexpected security part %s", got)
+	}
+	if got := string(jsonMarshal(parts["profile"])); got != `{"address":{"city":"Lima"},"name":"Ana"}` {
+		t.Errorf("Unexpected profile part %s", got)
+	}
+}
+
+func TestUserSchema_Compose(t *testing.T) {
+	user, err := testSchema().compose(config.MergeFlat, map[string][]byte{
+		"security": []byte(`{"id":"42","mail":"a@example.com","createdAt":"2024"}`),
+		"profile":  []byte(`{"id":"p-1","name":"Ana","address":{"city":"Lima"},"createdAt":"2025"}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"createdAt":"2024","email":"a@example.com","id":"42","profile":{"address":{"city":"Lima"},"displayName":"Ana"}}`
+	if got := string(jsonMarshal(user)); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestHandleUpdateUserFull_RejectsUnknownFields(t *testing.T) {
+	security := newStatefulServer(t, map[string]interface{}{}, always(http.StatusOK))
+	profile := newStatefulServer(t, map[string]interface{}{}, always(http.StatusOK))
+
+	w := updateUserFull(t, security.URL, profile.URL, `{"email":"a@example.com","shoeSize":42,"id":"7"}`)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", w.Code)
+	}
+	var fields fieldErrors
+	body := ErrorBody{Details: &fields}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body.Code != "unknown_fields" || !reflect.DeepEqual(fields.Unknown, []string{"shoeSize"}) || !reflect.DeepEqual(fields.ReadOnly, []string{"id"}) {
+		t.Errorf("Unexpected error body %s", w.Body.String())
+	}
+	if len(security.received()) != 0 || len(profile.received()) != 0 {
+		t.Error("Expected no upstream to be updated")
+	}
+}
+
+// useConfigFile publica en ConfigStore la configuración de data (YAML)
+func useConfigFile(t *testing.T, data string) {
+	path := filepath.Join(t.TempDir(), "gateway.yaml")
+	os.WriteFile(path, []byte(data), 0o644)
+	store, err := config.NewStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ConfigStore = store
+	t.Cleanup(func() { ConfigStore = nil })
+}
+
+// setEnv cambia una variable de entorno durante el test y descarta la
+// configuración ya leída del entorno para que CurrentConfig la vea
+func setEnv(t testing.TB, key, value string) {
+	t.Setenv(key, value)
+	envConfig.Store(nil)
+	t.Cleanup(func() { envConfig.Store(nil) })
+}
+
+func TestCompositeUser_ThirdUpstreamFromConfig(t *testing.T) {
+	security := newStatefulServer(t, map[string]interface{}{"id": "42", "email": "a@example.com"}, always(http.StatusOK))
+	prefs := newStatefulServer(t, map[string]interface{}{"lang": "es"}, always(http.StatusOK))
+
+	useConfigFile(t, `
+securityURL: `+security.URL+`
+compositeUser:
+  sources:
+    - service: security
+      path: /api/v1/users/{id}
+    - service: preferences
+      url: `+prefs.URL+`
+      path: /prefs/{id}
+  fields:
+    id: {service: security, readOnly: true}
+    email: {service: security}
+    settings.language: {service: preferences, field: lang}
+`)
+	origBackoff := compensationBackoff
+	compensationBackoff = 0
+	defer func() { compensationBackoff = origBackoff }()
+
+	req := httptest.NewRequest("PUT", "/users/42", strings.NewReader(`{"settings":{"language":"en"}}`))
+	w := httptest.NewRecorder()
+	HandleUpdateUserFull(w, mux.SetURLVars(req, map[string]string{"id": "42"}))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d %s", w.Code, w.Body.String())
+	}
+	if len(security.received()) != 0 || len(prefs.received()) != 1 || prefs.get("lang") != "en" {
+		t.Errorf("Expected only preferences to be updated, got %d/%d PUTs and %v", len(security.received()), len(prefs.received()), prefs.get("lang"))
+	}
+
+	req = httptest.NewRequest("GET", "/users/42", nil)
+	w = httptest.NewRecorder()
+	HandleGetUserFull(w, mux.SetURLVars(req, map[string]string{"id": "42"}))
+
+	want := `{"email":"a@example.com","id":"42","settings":{"language":"en"}}`
+	if got := w.Body.String(); got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestHandleUpdateUserFull_AcceptsMatchingID(t *testing.T) {
+	security := newStatefulServer(t, map[string]interface{}{"email": "old@example.com"}, always(http.StatusOK))
+	profile := newStatefulServer(t, map[string]interface{}{"bio": "old"}, always(http.StatusOK))
+
+	for _, body := range []string{`{"id":"42","email":"a@example.com"}`, `{"id":42,"email":"a@example.com"}`} {
+		w := updateUserFull(t, security.URL, profile.URL, body)
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected the path id to be accepted in %s, got %d %s", body, w.Code, w.Body.String())
+		}
+	}
+	for _, put := range security.received() {
+		if _, ok := put["id"]; ok {
+			t.Errorf("Expected the id not to be sent upstream, got %v", put)
+		}
+	}
+
+	w := updateUserFull(t, security.URL, profile.URL, `{"id":"43","email":"a@example.com"}`)
+	var errBody ErrorBody
+	json.Unmarshal(w.Body.Bytes(), &errBody)
+	if w.Code != http.StatusBadRequest || errBody.Code != "read_only_fields" {
+		t.Errorf("Expected another id to be read-only, got %d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,128 @@
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+// Headers de la firma. X-User-Signature tiene el formato
+//
+//	t=<unix>;h=<header1>,<header2>,...;v1=<hex hmac-sha256>
+//
+// donde el HMAC se calcula sobre "t:<unix>\n" seguido de "<header>:<valor>\n"
+// para cada header de h, en ese orden (nombres en minúscula).
+const SignatureHeader = "X-User-Signature"
+
+// Strip borra los headers de identidad (y la firma) que mande el cliente,
+// para que un upstream nunca reciba una identidad que no puso el gateway.
+func Strip(h http.Header, cfg config.IdentityConfig) {
+	for name := range cfg.Headers {
+		h.Del(name)
+	}
+	h.Del(SignatureHeader)
+}
+
+// Apply agrega los headers de identidad derivados de claims y, si hay
+// SigningSecret, la firma. Los claims ausentes no generan header.
+func Apply(h http.Header, claims map[string]interface{}, cfg config.IdentityConfig, now time.Time) {
+	var names []string
+	for name, claim := range cfg.Headers {
+		v := claimValue(claims[claim])
+		if v == "" {
+			continue
+		}
+		h.Set(name, v)
+		names = append(names, strings.ToLower(name))
+	}
+
+	if cfg.SigningSecret == "" || len(names) == 0 {
+		return
+	}
+
+	sort.Strings(names)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	mac := sign([]byte(cfg.SigningSecret), ts, names, h)
+	h.Set(SignatureHeader, "t="+ts+";h="+strings.Join(names, ",")+";v1="+mac)
+}
+
+// Verify comprueba la firma de h (lo que haría un upstream).
+// maxAge limita la antigüedad del timestamp firmado; 0 no la limita.
+func Verify(h http.Header, secret []byte, maxAge time.Duration, now time.Time) error {
+	raw := h.Get(SignatureHeader)
+	if raw == "" {
+		return errors.New("missing identity signature")
+	}
+
+	var ts, mac string
+	var names []string
+	for _, part := range strings.Split(raw, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts = v
+		case "h":
+			names = strings.Split(v, ",")
+		case "v1":
+			mac = v
+		}
+	}
+	if ts == "" || mac == "" || len(names) == 0 {
+		return errors.New("malformed identity signature")
+	}
+
+	if maxAge > 0 {
+		unix, err := strconv.ParseInt(ts, 10, 64)
+		if err != nil {
+			return errors.New("malformed identity signature timestamp")
+		}
+		if age := now.Sub(time.Unix(unix, 0)); age > maxAge || age < -maxAge {
+			return fmt.Errorf("identity signature too old (%s)", age)
+		}
+	}
+
+	expected := sign(secret, ts, names, h)
+	if !hmac.Equal([]byte(expected), []byte(mac)) {
+		return errors.New("identity signature mismatch")
+	}
+	return nil
+}
+
+func sign(secret []byte, ts string, names []string, h http.Header) string {
+	m := hmac.New(sha256.New, secret)
+	fmt.Fprintf(m, "t:%s\n", ts)
+	for _, name := range names {
+		fmt.Fprintf(m, "%s:%s\n", name, h.Get(name))
+	}
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// claimValue aplana un claim a texto de header: listas separadas por coma
+func claimValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, 0, len(t))
+		for _, item := range t {
+			parts = append(parts, claimValue(item))
+		}
+		return strings.Join(parts, ",")
+	case []string:
+		return strings.Join(t, ",")
+	}
+	return fmt.Sprint(v)
+}
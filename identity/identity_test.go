@@ -0,0 +1,66 @@
+package identity
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"servicio-gateway/config"
+)
+
+var testCfg = config.IdentityConfig{
+	Headers: map[string]string{
+		"X-User-Id":    "sub",
+		"X-User-Roles": "roles",
+		"X-User-Email": "email",
+	},
+	SigningSecret: "shared-secret",
+}
+
+func TestApplyAndVerify(t *testing.T) {
+	now := time.Now()
+	h := http.Header{}
+	Apply(h, map[string]interface{}{
+		"sub":   "42",
+		"roles": []interface{}{"user", "admin"},
+		"email": "a@example.com",
+	}, testCfg, now)
+
+	if h.Get("X-User-Id") != "42" || h.Get("X-User-Roles") != "user,admin" || h.Get("X-User-Email") != "a@example.com" {
+		t.Fatalf("Unexpected identity headers: %v", h)
+	}
+	if err := Verify(h, []byte("shared-secret"), time.Minute, now); err != nil {
+		t.Errorf("Expected signature to verify, got %v", err)
+	}
+
+	h.Set("X-User-Roles", "admin")
+	if err := Verify(h, []byte("shared-secret"), time.Minute, now); err == nil {
+		t.Error("Expected tampered header to fail verification")
+	}
+}
+
+func TestVerify_RejectsOldSignature(t *testing.T) {
+	then := time.Now().Add(-time.Hour)
+	h := http.Header{}
+	Apply(h, map[string]interface{}{"sub": "42"}, testCfg, then)
+
+	if err := Verify(h, []byte("shared-secret"), time.Minute, time.Now()); err == nil {
+		t.Error("Expected stale signature to be rejected")
+	}
+}
+
+func TestStrip(t *testing.T) {
+	h := http.Header{}
+	h.Set("X-User-Id", "spoofed")
+	h.Set(SignatureHeader, "t=1;h=x-user-id;v1=00")
+	h.Set("Accept", "application/json")
+
+	Strip(h, testCfg)
+
+	if h.Get("X-User-Id") != "" || h.Get(SignatureHeader) != "" {
+		t.Errorf("Expected client identity headers to be removed, got %v", h)
+	}
+	if h.Get("Accept") == "" {
+		t.Error("Expected unrelated headers to be kept")
+	}
+}
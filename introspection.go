@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"servicio-gateway/client"
+	"servicio-gateway/config"
+)
+
+// ---------------------------------------------------------
+// Validación de tokens opacos contra un endpoint RFC 7662
+// ---------------------------------------------------------
+
+var (
+	errTokenInactive            = errors.New("token is not active")
+	errIntrospectionUnavailable = errors.New("token introspection unavailable")
+)
+
+// Introspector llama al endpoint de introspección y cachea el resultado:
+// tokens activos hasta su exp (con tope MaxTTL), inactivos por NegativeTTL.
+// La caché se indexa por sha256 del token, nunca por el token en claro.
+type Introspector struct {
+	cfg config.IntrospectionConfig
+	now func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]introspectionEntry
+}
+
+type introspectionEntry struct {
+	claims jwt.MapClaims // nil = inactivo
+	until  time.Time
+}
+
+// maxIntrospectionEntries limita la caché; al llenarse se purgan vencidos
+const maxIntrospectionEntries = 10000
+
+// Introspector configurado; nil si no hay introspection.url
+var introspector *Introspector
+
+func NewIntrospector(cfg config.IntrospectionConfig) *Introspector {
+	return &Introspector{cfg: cfg, now: time.Now, cache: map[string]introspectionEntry{}}
+}
+
+// Introspect devuelve los claims del token con la misma forma que validateJWT
+func (in *Introspector) Introspect(ctx context.Context, token string) (jwt.MapClaims, error) {
+	sum := sha256.Sum256([]byte(token))
+	key := hex.EncodeToString(sum[:])
+	now := in.now()
+
+	in.mu.Lock()
+	entry, ok := in.cache[key]
+	in.mu.Unlock()
+	if ok && now.Before(entry.until) {
+		if entry.claims == nil {
+			return nil, errTokenInactive
+		}
+		return entry.claims, nil
+	}
+
+	claims, err := in.call(ctx, token)
+	if errors.Is(err, errIntrospectionUnavailable) {
+		// No se cachean fallos del endpoint: el próximo intento vuelve a preguntar
+		return nil, err
+	}
+
+	entry = introspectionEntry{claims: claims, until: now.Add(in.cfg.NegativeTTL.Std())}
+	if err == nil {
+		entry.until = now.Add(in.cfg.MaxTTL.Std())
+		if exp, _ := claims.GetExpirationTime(); exp != nil && exp.Time.Before(entry.until) {
+			entry.until = exp.Time
+		}
+	}
+	in.store(key, entry)
+
+	return claims, err
+}
+
+func (in *Introspector) store(key string, entry introspectionEntry) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if len(in.cache) >= maxIntrospectionEntries {
+		now := in.now()
+		for k, e := range in.cache {
+			if !now.Before(e.until) {
+				delete(in.cache, k)
+			}
+		}
+		if len(in.cache) >= maxIntrospectionEntries {
+			in.cache = map[string]introspectionEntry{}
+		}
+	}
+	in.cache[key] = entry
+}
+
+func (in *Introspector) call(ctx context.Context, token string) (jwt.MapClaims, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, "POST", in.cfg.URL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errIntrospectionUnavailable, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if in.cfg.ClientID != "" {
+		req.SetBasicAuth(in.cfg.ClientID, in.cfg.ClientSecret)
+	}
+
+	resp, err := client.HttpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errIntrospectionUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: endpoint returned status %d", errIntrospectionUnavailable, resp.StatusCode)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("%w: invalid response: %v", errIntrospectionUnavailable, err)
+	}
+
+	if active, _ := body["active"].(bool); !active {
+		return nil, errTokenInactive
+	}
+
+	claims := jwt.MapClaims{}
+	for k, v := range body {
+		if k != "active" {
+			claims[k] = v
+		}
+	}
+
+	// Un "active" con exp ya vencido se trata como inactivo
+	if exp, err := claims.GetExpirationTime(); err == nil && exp != nil && !in.now().Before(exp.Time) {
+		return nil, errTokenInactive
+	}
+	return claims, nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"servicio-gateway/config"
+	"servicio-gateway/handlers"
+)
+
+func introspectionServer(t *testing.T, calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		r.ParseForm()
+		if user, pass, _ := r.BasicAuth(); user != "gateway" || pass != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp := map[string]interface{}{"active": false}
+		if r.PostForm.Get("token") == "opaque-good" {
+			resp = map[string]interface{}{
+				"active": true,
+				"sub":    "42",
+				"scope":  "users:read",
+				"exp":    time.Now().Add(time.Hour).Unix(),
+			}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+func useIntrospector(t *testing.T, url string) {
+	introspector = NewIntrospector(config.IntrospectionConfig{
+		URL:          url,
+		ClientID:     "gateway",
+		ClientSecret: "s3cret",
+		NegativeTTL:  config.Duration(time.Minute),
+		MaxTTL:       config.Duration(time.Hour),
+	})
+	t.Cleanup(func() { introspector = nil })
+}
+
+func TestIntrospect_CachesPositiveAndNegative(t *testing.T) {
+	var calls int32
+	srv := introspectionServer(t, &calls)
+	defer srv.Close()
+	useIntrospector(t, srv.URL)
+
+	for i := 0; i < 3; i++ {
+		claims, err := validateToken(context.Background(), handlers.ValidatorIntrospection, "opaque-good")
+		if err != nil {
+			t.Fatalf("Expected active token, got %v", err)
+		}
+		if claims["sub"] != "42" {
+			t.Errorf("Expected sub '42', got '%v'", claims["sub"])
+		}
+		if _, err := validateToken(context.Background(), handlers.ValidatorIntrospection, "opaque-bad"); tokenErrorCode(err) != "token_inactive" {
+			t.Errorf("Expected token_inactive, got %v", err)
+		}
+	}
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("Expected 2 introspection calls thanks to caching, got %d", got)
+	}
+}
+
+func TestValidateToken_JWTThenIntrospectionFallback(t *testing.T) {
+	var calls int32
+	srv := introspectionServer(t, &calls)
+	defer srv.Close()
+	useIntrospector(t, srv.URL)
+
+	local := signHS256(t, jwt.MapClaims{"sub": "7", "exp": time.Now().Add(time.Hour).Unix()})
+	claims, err := validateToken(context.Background(), handlers.ValidatorJWTOrIntrospection, local)
+	if err != nil || claims["sub"] != "7" {
+		t.Fatalf("Expected local JWT to validate, got %v (%v)", claims, err)
+	}
+	if atomic.LoadInt32(&calls) != 0 {
+		t.Error("Expected valid JWT not to hit the introspection endpoint")
+	}
+
+	claims, err = validateToken(context.Background(), handlers.ValidatorJWTOrIntrospection, "opaque-good")
+	if err != nil || claims["sub"] != "42" {
+		t.Fatalf("Expected opaque token to fall back to introspection, got %v (%v)", claims, err)
+	}
+
+	expired := signHS256(t, jwt.MapClaims{"sub": "7", "exp": time.Now().Add(-time.Hour).Unix()})
+	if _, err := validateToken(context.Background(), handlers.ValidatorJWTOrIntrospection, expired); tokenErrorCode(err) != "token_expired" {
+		t.Errorf("Expected expired JWT not to fall back, got %v", err)
+	}
+}
+
+func TestAuthenticate_IntrospectionUnavailable(t *testing.T) {
+	useIntrospector(t, "http://127.0.0.1:1/introspect")
+
+	h := Authenticate(handlers.AuthSpec{Validator: handlers.ValidatorIntrospection}).Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called")
+	}))
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set("Authorization", "Bearer opaque-good")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 when the endpoint is down, got %d", w.Code)
+	}
+}
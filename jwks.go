@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"servicio-gateway/client"
+)
+
+// ---------------------------------------------------------
+// Caché de claves públicas leídas de un documento JWKS
+// ---------------------------------------------------------
+
+// jwk es una entrada de un documento JWKS (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwksKey es una clave pública ya decodificada
+type jwksKey struct {
+	alg string
+	key crypto.PublicKey
+}
+
+// JWKSCache guarda las claves por kid. Se refresca periódicamente (Run) y
+// a la fuerza cuando llega un kid desconocido, limitado a una vez por
+// minForcedRefresh para que tokens con kids inventados no saturen la fuente.
+type JWKSCache struct {
+	source           string
+	minForcedRefresh time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]jwksKey
+	lastRefresh time.Time
+}
+
+// NewJWKSCache crea la caché y hace la primera lectura.
+// source es una URL http(s) o una ruta de archivo (admite prefijo file://).
+func NewJWKSCache(source string) (*JWKSCache, error) {
+	c := &JWKSCache{
+		source:           source,
+		minForcedRefresh: 30 * time.Second,
+		keys:             map[string]jwksKey{},
+	}
+	if err := c.Refresh(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Key devuelve la clave con ese kid, refrescando el JWKS si no la conoce
+func (c *JWKSCache) Key(kid string) (jwksKey, error) {
+	c.mu.RLock()
+	k, ok := c.keys[kid]
+	last := c.lastRefresh
+	c.mu.RUnlock()
+	if ok {
+		return k, nil
+	}
+
+	if time.Since(last) >= c.minForcedRefresh {
+		if err := c.Refresh(); err != nil {
+			log.Printf("[jwks] forced refresh for kid %q failed: %v\n", kid, err)
+		}
+		c.mu.RLock()
+		k, ok = c.keys[kid]
+		c.mu.RUnlock()
+		if ok {
+			return k, nil
+		}
+	}
+
+	return jwksKey{}, fmt.Errorf("unknown key id %q", kid)
+}
+
+// Refresh vuelve a leer la fuente y reemplaza el conjunto de claves.
+// Si la lectura falla se conservan las claves anteriores.
+func (c *JWKSCache) Refresh() error {
+	data, err := c.read()
+	if err != nil {
+		c.mu.Lock()
+		c.lastRefresh = time.Now()
+		c.mu.Unlock()
+		return err
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		c.mu.Lock()
+		c.lastRefresh = time.Now()
+		c.mu.Unlock()
+		return err
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.lastRefresh = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+// Run refresca el JWKS cada interval hasta que ctx se cancela
+func (c *JWKSCache) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := c.Refresh(); err != nil {
+				log.Printf("[jwks] periodic refresh failed, keeping previous keys: %v\n", err)
+			}
+		}
+	}
+}
+
+func (c *JWKSCache) read() ([]byte, error) {
+	if strings.HasPrefix(c.source, "http://") || strings.HasPrefix(c.source, "https://") {
+		resp, err := client.HttpClient.Get(c.source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("jwks endpoint returned status %d", resp.StatusCode)
+		}
+		return io.ReadAll(resp.Body)
+	}
+	return os.ReadFile(strings.TrimPrefix(c.source, "file://"))
+}
+
+func parseJWKS(data []byte) (map[string]jwksKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid jwks document: %w", err)
+	}
+
+	keys := map[string]jwksKey{}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			log.Printf("[jwks] skipping key %q: %v\n", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = jwksKey{alg: k.Alg, key: pub}
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("jwks document has no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() < 3 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point is not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
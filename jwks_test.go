@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func rsaJWK(kid string, k *rsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "alg": "RS256", "use": "sig",
+		"n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+}
+
+func ecJWK(kid string, k *ecdsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))}
+}
+
+func edJWK(kid string, k ed25519.PublicKey) map[string]string {
+	return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64(k)}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signWithKid(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func useJWKS(t *testing.T, source string) *JWKSCache {
+	cache, err := NewJWKSCache(source)
+	if err != nil {
+		t.Fatalf("Expected JWKS to load, got %v", err)
+	}
+	cache.minForcedRefresh = 0
+	jwks = cache
+	t.Cleanup(func() { jwks = nil })
+	return cache
+}
+
+func TestValidateJWT_JWKSAlgorithms(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("rsa", &rsaKey.PublicKey), ecJWK("ec", &ecKey.PublicKey), edJWK("ed", edPub))
+	useJWKS(t, path)
+
+	tokens := map[string]string{
+		"RS256": signWithKid(t, jwt.SigningMethodRS256, "rsa", rsaKey),
+		"ES256": signWithKid(t, jwt.SigningMethodES256, "ec", ecKey),
+		"EdDSA": signWithKid(t, jwt.SigningMethodEdDSA, "ed", edPriv),
+	}
+	for alg, tok := range tokens {
+		claims, err := validateJWT(tok)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", alg, err)
+			continue
+		}
+		if claims["sub"] != "user-1" {
+			t.Errorf("%s: expected sub 'user-1', got '%v'", alg, claims["sub"])
+		}
+	}
+}
+
+func TestValidateJWT_JWKSRejectsHMACAndWrongKeyType(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("rsa", &rsaKey.PublicKey))
+	useJWKS(t, path)
+
+	hmacToken := signWithKid(t, jwt.SigningMethodHS256, "rsa", []byte("test-secret"))
+	if _, err := validateJWT(hmacToken); err == nil {
+		t.Error("Expected HMAC token to be rejected in jwks mode")
+	}
+
+	ecToken := signWithKid(t, jwt.SigningMethodES256, "rsa", ecKey)
+	if _, err := validateJWT(ecToken); err == nil {
+		t.Error("Expected ES256 token with RSA kid to be rejected")
+	}
+}
+
+func TestValidateJWT_JWKSKeyRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("k1", &oldKey.PublicKey))
+	useJWKS(t, path)
+
+	oldToken := signWithKid(t, jwt.SigningMethodRS256, "k1", oldKey)
+	if _, err := validateJWT(oldToken); err != nil {
+		t.Fatalf("Expected old key to validate, got %v", err)
+	}
+
+	// El emisor rota: publica k2 y retira k1
+	writeJWKS(t, path, rsaJWK("k2", &newKey.PublicKey))
+
+	newToken := signWithKid(t, jwt.SigningMethodRS256, "k2", newKey)
+	if _, err := validateJWT(newToken); err != nil {
+		t.Errorf("Expected unknown kid to force a refresh and validate, got %v", err)
+	}
+	if _, err := validateJWT(oldToken); err == nil {
+		t.Error("Expected token signed with retired key to be rejected")
+	}
+}
+
+func TestJWKSCache_ForcedRefreshIsRateLimited(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{rsaJWK("k1", &rsaKey.PublicKey)},
+		})
+	}))
+	defer srv.Close()
+
+	cache, err := NewJWKSCache(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected JWKS to load, got %v", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := cache.Key("unknown"); err == nil {
+			t.Error("Expected unknown kid to fail")
+		}
+	}
+	if got := atomic.LoadInt32(&fetches); got != 1 {
+		t.Errorf("Expected forced refreshes to be rate limited (1 fetch), got %d", got)
+	}
+}
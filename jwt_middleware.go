@@ -1,20 +1,45 @@
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"context"
 	"github.com/golang-jwt/jwt/v5"
+
+	"servicio-gateway/config"
+	"servicio-gateway/handlers"
+	"servicio-gateway/revocation"
 )
 
 // Clave secreta cargada por ENV
 var jwtSecret []byte
 
+// Claves públicas para jwt.mode=jwks; nil significa verificación HMAC con jwtSecret
+var jwks *JWKSCache
+
+// Reglas de iss/aud/alg/leeway (vacías = sin restricción, como antes)
+var jwtRules config.JWTConfig
+
+// Tokens revocados (por jti o por subject); nil = sin revocación
+var revocations revocation.Store
+
+var (
+	errMissingAuthorization = errors.New("missing Authorization header")
+	errInvalidAuthorization = errors.New("invalid Authorization format (use Bearer <token>)")
+	errAlgorithmNotAllowed  = errors.New("signing algorithm not allowed")
+	errTokenRevoked         = errors.New("token has been revoked")
+)
+
 func init() {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
@@ -24,18 +49,38 @@ func init() {
 	jwtSecret = []byte(secret)
 }
 
+// ---------------------------------------------------------
+// Elegir verificación HMAC o JWKS según la configuración
+// ---------------------------------------------------------
+func configureJWT(ctx context.Context, cfg config.JWTConfig) error {
+	jwtRules = cfg
+	if cfg.Mode != "jwks" {
+		jwks = nil
+		return nil
+	}
+
+	cache, err := NewJWKSCache(cfg.JWKSURL)
+	if err != nil {
+		return err
+	}
+	jwks = cache
+	go cache.Run(ctx, cfg.JWKSRefresh.Std())
+	log.Printf("[jwt] verifying tokens with JWKS from %s (refresh every %s)\n", cfg.JWKSURL, cfg.JWKSRefresh)
+	return nil
+}
+
 // ---------------------------------------------------------
 // Extraer token desde header Authorization
 // ---------------------------------------------------------
 func extractToken(r *http.Request) (string, error) {
 	auth := r.Header.Get("Authorization")
 	if auth == "" {
-		return "", errors.New("missing Authorization header")
+		return "", errMissingAuthorization
 	}
 
 	parts := strings.Split(auth, " ")
 	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-		return "", errors.New("invalid Authorization format (use Bearer <token>)")
+		return "", errInvalidAuthorization
 	}
 
 	return parts[1], nil
@@ -46,13 +91,12 @@ func extractToken(r *http.Request) (string, error) {
 // ---------------------------------------------------------
 func validateJWT(tokenString string) (jwt.MapClaims, error) {
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validar método de firma
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("invalid signing method")
-		}
-		return jwtSecret, nil
-	})
+	opts := []jwt.ParserOption{jwt.WithLeeway(jwtRules.Leeway.Std())}
+	if len(jwtRules.Audiences) > 0 {
+		opts = append(opts, jwt.WithAudience(jwtRules.Audiences...))
+	}
+
+	token, err := jwt.Parse(tokenString, jwtKeyFunc, opts...)
 
 	if err != nil {
 		return nil, err
@@ -63,43 +107,157 @@ func validateJWT(tokenString string) (jwt.MapClaims, error) {
 		return nil, errors.New("invalid token claims")
 	}
 
+	// jwt.WithIssuer solo acepta un emisor; aquí se admite una lista
+	if len(jwtRules.Issuers) > 0 {
+		iss, _ := claims.GetIssuer()
+		if !containsString(jwtRules.Issuers, iss) {
+			return nil, fmt.Errorf("%w: %q", jwt.ErrTokenInvalidIssuer, iss)
+		}
+	}
+
 	return claims, nil
 }
 
+// ---------------------------------------------------------
+// Resolver la clave de verificación según el modo
+// ---------------------------------------------------------
+func jwtKeyFunc(token *jwt.Token) (interface{}, error) {
+	if len(jwtRules.Algorithms) > 0 && !containsString(jwtRules.Algorithms, token.Method.Alg()) {
+		return nil, fmt.Errorf("%w: %s", errAlgorithmNotAllowed, token.Method.Alg())
+	}
+
+	if jwks == nil {
+		// Validar método de firma
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("invalid signing method")
+		}
+		return jwtSecret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	k, err := jwks.Key(kid)
+	if err != nil {
+		return nil, err
+	}
+	if k.alg != "" && k.alg != token.Method.Alg() {
+		return nil, errors.New("signing method does not match key algorithm")
+	}
+
+	// El tipo de clave tiene que corresponder al algoritmo (nunca HMAC ni none)
+	ok := false
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok = k.key.(*rsa.PublicKey)
+	case *jwt.SigningMethodECDSA:
+		_, ok = k.key.(*ecdsa.PublicKey)
+	case *jwt.SigningMethodEd25519:
+		_, ok = k.key.(ed25519.PublicKey)
+	}
+	if !ok {
+		return nil, errors.New("invalid signing method")
+	}
+	return k.key, nil
+}
+
 // ---------------------------------------------------------
 // Middleware: validar JWT y meter claims en el contexto
 // ---------------------------------------------------------
 func JWTMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return authMiddleware(handlers.AuthSpec{Validator: handlers.ValidatorJWT}, next)
+}
 
-		tokenString, err := extractToken(r)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusUnauthorized)
-			return
+// ---------------------------------------------------------
+// Validar según el modo: JWT local, introspección o JWT con
+// respaldo de introspección para tokens que no son JWT propios
+// ---------------------------------------------------------
+func validateToken(ctx context.Context, validator, tokenString string) (jwt.MapClaims, error) {
+	switch validator {
+	case handlers.ValidatorIntrospection:
+		if introspector == nil {
+			return nil, fmt.Errorf("%w: not configured", errIntrospectionUnavailable)
 		}
+		return introspector.Introspect(ctx, tokenString)
 
+	case handlers.ValidatorJWTOrIntrospection:
 		claims, err := validateJWT(tokenString)
-		if err != nil {
-			http.Error(w, "invalid token: "+err.Error(), http.StatusUnauthorized)
-			return
+		// Solo se recurre a la introspección si el token no es un JWT
+		// verificable; un JWT propio vencido o con otra audiencia se rechaza.
+		if err == nil || introspector == nil ||
+			!(errors.Is(err, jwt.ErrTokenMalformed) || errors.Is(err, jwt.ErrTokenUnverifiable)) {
+			return claims, err
 		}
+		return introspector.Introspect(ctx, tokenString)
+	}
 
-		// Insertar claims en el contexto
-		ctx := context.WithValue(r.Context(), "tokenData", claims)
-
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	return validateJWT(tokenString)
 }
 
 // ---------------------------------------------------------
-// Helper para obtener los claims en cualquier handler
+// Consultar el almacén de revocaciones (jti y subject+iat)
 // ---------------------------------------------------------
-func GetTokenData(r *http.Request) map[string]interface{} {
-	claims := r.Context().Value("tokenData")
-	if claims == nil {
+func checkRevoked(claims jwt.MapClaims) error {
+	if revocations == nil {
 		return nil
 	}
-	return claims.(jwt.MapClaims)
+
+	jti, _ := claims["jti"].(string)
+	sub, _ := claims.GetSubject()
+	var iat time.Time
+	if t, err := claims.GetIssuedAt(); err == nil && t != nil {
+		iat = t.Time
+	}
+
+	revoked, err := revocations.IsRevoked(jti, sub, iat)
+	if err != nil {
+		// Si no se puede consultar, se rechaza: es preferible a aceptar un token revocado
+		log.Printf("[jwt] revocation check failed: %v\n", err)
+		return errTokenRevoked
+	}
+	if revoked {
+		return errTokenRevoked
+	}
+	return nil
+}
+
+// ---------------------------------------------------------
+// Código estable para cada motivo de rechazo (cuerpo JSON del 401)
+// ---------------------------------------------------------
+func tokenErrorCode(err error) string {
+	switch {
+	case errors.Is(err, errMissingAuthorization):
+		return "token_missing"
+	case errors.Is(err, errInvalidAuthorization), errors.Is(err, jwt.ErrTokenMalformed):
+		return "token_malformed"
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "token_expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return "token_not_yet_valid"
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return "token_wrong_audience"
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return "token_wrong_issuer"
+	case errors.Is(err, errAlgorithmNotAllowed):
+		return "token_algorithm_not_allowed"
+	case errors.Is(err, errTokenRevoked):
+		return "token_revoked"
+	case errors.Is(err, errTokenInactive):
+		return "token_inactive"
+	}
+	return "token_invalid"
+}
+
+func writeUnauthorized(w http.ResponseWriter, code, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token", error_description="`+code+`"`)
+	handlers.WriteError(w, http.StatusUnauthorized, code, message)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
 
 // ---------------------------------------------------------
@@ -1,12 +1,17 @@
 package main
 
 import (
+	"encoding/json"
+	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+
+	"servicio-gateway/config"
+	"servicio-gateway/revocation"
 )
 
 func TestExtractToken_Success(t *testing.T) {
@@ -81,4 +86,121 @@ func TestValidateJWT_InvalidToken(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error for invalid token")
 	}
-}
\ No newline at end of file
+}
+
+func signHS256(t *testing.T, claims jwt.MapClaims) string {
+	jwtSecret = []byte("test-secret")
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(jwtSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestJWTMiddleware_ErrorCodes(t *testing.T) {
+	jwtRules = config.JWTConfig{
+		Issuers:    []string{"https://security.local"},
+		Audiences:  []string{"gateway"},
+		Algorithms: []string{"HS256"},
+		Leeway:     config.Duration(5 * time.Second),
+	}
+	defer func() { jwtRules = config.JWTConfig{} }()
+
+	now := time.Now()
+	valid := jwt.MapClaims{"iss": "https://security.local", "aud": "gateway", "exp": now.Add(time.Hour).Unix()}
+	with := func(k string, v interface{}) jwt.MapClaims {
+		c := jwt.MapClaims{}
+		for kk, vv := range valid {
+			c[kk] = vv
+		}
+		c[k] = v
+		return c
+	}
+
+	cases := map[string]struct {
+		header string
+		code   string
+	}{
+		"missing":       {"", "token_missing"},
+		"bad format":    {"Token abc", "token_malformed"},
+		"expired":       {"Bearer " + signHS256(t, with("exp", now.Add(-time.Minute).Unix())), "token_expired"},
+		"not yet valid": {"Bearer " + signHS256(t, with("nbf", now.Add(time.Minute).Unix())), "token_not_yet_valid"},
+		"wrong aud":     {"Bearer " + signHS256(t, with("aud", "billing")), "token_wrong_audience"},
+		"wrong iss":     {"Bearer " + signHS256(t, with("iss", "https://other.local")), "token_wrong_issuer"},
+	}
+
+	handler := JWTMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called")
+	}))
+
+	for name, tc := range cases {
+		req := httptest.NewRequest("GET", "/test", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, w.Code)
+		}
+		var body map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s: expected JSON body, got %q", name, w.Body.String())
+			continue
+		}
+		if body["error"] != tc.code {
+			t.Errorf("%s: expected code '%s', got '%v'", name, tc.code, body["error"])
+		}
+	}
+}
+
+func TestJWTMiddleware_LeewayAndAllowedAlgorithms(t *testing.T) {
+	jwtRules = config.JWTConfig{Leeway: config.Duration(time.Minute)}
+	defer func() { jwtRules = config.JWTConfig{} }()
+
+	// Vencido hace 10s pero dentro del leeway de 1m
+	tok := signHS256(t, jwt.MapClaims{"exp": time.Now().Add(-10 * time.Second).Unix()})
+	if _, err := validateJWT(tok); err != nil {
+		t.Errorf("Expected token within leeway to be valid, got %v", err)
+	}
+
+	jwtRules.Algorithms = []string{"HS512"}
+	_, err := validateJWT(tok)
+	if code := tokenErrorCode(err); code != "token_algorithm_not_allowed" {
+		t.Errorf("Expected token_algorithm_not_allowed, got %s (%v)", code, err)
+	}
+}
+
+func TestJWTMiddleware_RevokedToken(t *testing.T) {
+	store := revocation.NewMemoryStore(time.Hour)
+	revocations = store
+	defer func() { revocations = nil }()
+
+	issued := time.Now().Add(-time.Minute)
+	tok := signHS256(t, jwt.MapClaims{"sub": "42", "jti": "abc", "iat": issued.Unix(), "exp": time.Now().Add(time.Hour).Unix()})
+
+	handler := JWTMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	call := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := call(); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 before revocation, got %d", w.Code)
+	}
+
+	store.RevokeSubject("42", time.Now())
+	w := call()
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 after revocation, got %d", w.Code)
+	}
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["error"] != "token_revoked" {
+		t.Errorf("Expected code 'token_revoked', got '%v'", body["error"])
+	}
+}
@@ -1,48 +1,175 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/gorilla/mux"
 
+	"servicio-gateway/apikey"
+	"servicio-gateway/authz"
+	"servicio-gateway/certs"
 	"servicio-gateway/client"
+	"servicio-gateway/clientip"
+	"servicio-gateway/compensation"
 	"servicio-gateway/config"
 	"servicio-gateway/handlers"
+	"servicio-gateway/revocation"
 )
 
 func main() {
-	cfg := config.LoadConfigFromEnv()
+	printRoutes := flag.Bool("routes", false, "imprime la tabla efectiva de rutas y termina")
+	hashKey := flag.String("hash-apikey", "", "imprime el hash a guardar en el archivo de API keys y termina")
+	flag.Parse()
+
+	if *hashKey != "" {
+		fmt.Println(apikey.Hash(*hashKey))
+		return
+	}
+
+	// Configuración: entorno + CONFIG_FILE opcional, recargable en caliente
+	store, err := config.NewStore(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("invalid configuration: %v", err)
+	}
+	handlers.ConfigStore = store
+	cfg := store.Current()
+
+	// Manifiesto de rutas (ROUTES_FILE o el embebido por defecto)
+	manifest, err := handlers.LoadRouteManifest(cfg.RoutesFile, *cfg)
+	if err != nil {
+		log.Fatalf("invalid route manifest: %v", err)
+	}
 
 	// Configurar cliente http global
 	client.HttpClient = &http.Client{Timeout: 10 * time.Second}
 
+	// Un cliente por upstream con su pool, timeouts, reintentos y TLS (CA, mTLS, SNI...);
+	// una recarga de configuración rearma los upstreams que cambiaron
+	if err := client.Upstreams.Configure(*cfg); err != nil {
+		log.Fatalf("invalid upstream configuration: %v", err)
+	}
+	store.OnReload(func(_, next *config.Config) error {
+		return client.Upstreams.Configure(*next)
+	})
+	go certs.Watch(context.Background(), 5*time.Second, client.Upstreams)
+
+	// Verificación de JWT: HMAC (JWT_SECRET) o claves públicas de un JWKS
+	if err := configureJWT(context.Background(), cfg.JWT); err != nil {
+		log.Fatalf("invalid jwt configuration: %v", err)
+	}
+
+	// Introspección RFC 7662 para rutas con validator introspection
+	if cfg.Introspection.URL != "" {
+		introspector = NewIntrospector(cfg.Introspection)
+	}
+
+	// Revocación de tokens: en memoria o persistida en REVOCATION_FILE
+	if cfg.Revocation.File != "" {
+		fileStore, err := revocation.OpenFileStore(cfg.Revocation.File, cfg.Revocation.SubjectTTL.Std())
+		if err != nil {
+			log.Fatalf("cannot open revocation file: %v", err)
+		}
+		revocations = fileStore
+	} else {
+		revocations = revocation.NewMemoryStore(cfg.Revocation.SubjectTTL.Std())
+	}
+	handlers.Revocations = revocations
+
+	// Compensaciones de PUT /users/{id} que no se pudieron aplicar
+	if cfg.CompensationJournal != "" {
+		journal, err := compensation.OpenFileJournal(cfg.CompensationJournal)
+		if err != nil {
+			log.Fatalf("cannot open compensation journal: %v", err)
+		}
+		handlers.Compensations = journal
+	} else {
+		log.Println("[WARN] COMPENSATION_JOURNAL_FILE not set, failed compensations are kept in memory only")
+		handlers.Compensations = compensation.NewMemoryJournal()
+	}
+
+	// API keys para clientes máquina (rutas con apiKey: either|both)
+	if cfg.APIKeys.File != "" {
+		apiKeys, err = apikey.Load(cfg.APIKeys.File)
+		if err != nil {
+			log.Fatalf("invalid api keys file: %v", err)
+		}
+		handlers.APIKeys = apiKeys
+	}
+
 	r := mux.NewRouter()
+	routes := handlers.NewRouteTable()
+
+	// IP real del cliente (detrás de TRUSTED_PROXIES) para logs y rate limiting
+	r.Use(clientip.Middleware(handlers.ClientIPResolver))
+
+	// Presupuesto de reintentos a upstreams por petición entrante (RETRY_BUDGET)
+	r.Use(client.RetryBudgetMiddleware(func() int { return *handlers.CurrentConfig().RetryBudget }))
 
 	// CORS middleware (func CORS defined in root cors.go)
 	r.Use(CORS)
+	public := routes.Router(r, "clientip", "retrybudget", "cors")
 
 	// Register public routes (auth, user CRUD proxies)
-	handlers.RegisterUserServiceRoutes(r)
+	handlers.RegisterUserServiceRoutes(public, manifest)
+	// User listing: public pass-through like the old manifest route; ?include=profile
+	// reads profiles, which are protected, so those requests must authenticate
+	// (including only the primary source, e.g. include=account, stays public)
+	public.Handle("GET", "/users", "HandleListUsers", handlers.HandleListUsers,
+		handlers.AuthenticateWhen(handlers.ListIncludesOtherSources, Authenticate(handlers.AuthSpec{})))
 
-	// Protected subrouter (jwt)
+	// Protected subrouter: each route authenticates with its validator (jwt by default)
 	api := r.PathPrefix("/").Subrouter()
-	api.Use(JWTMiddleware)
+	protected := routes.ProtectedRouter(api, Authenticate, "clientip", "retrybudget", "cors")
 
 	// Profile routes (protected)
-	handlers.RegisterProfileRoutes(api)
+	handlers.RegisterProfileRoutes(protected)
+
+	// Manifest routes declared with auth: true
+	handlers.RegisterManifestRoutes(protected, manifest, true)
 
-	// Composite endpoints (protected)
-	api.HandleFunc("/users/{id}", handlers.HandleGetUserFull).Methods("GET")
-	api.HandleFunc("/users/{id}", handlers.HandleUpdateUserFull).Methods("PUT")
-	api.HandleFunc("/users/{id}", handlers.HandleDeleteUser).Methods("DELETE")
+	// Composite endpoints (protected); only the owner (or an admin) may modify a user
+	ownerOnly := handlers.RequirePolicy(authz.Policy{Owner: "id"})
+	protected.Handle("GET", "/users/{id}", "HandleGetUserFull", handlers.HandleGetUserFull)
+	protected.Handle("PUT", "/users/{id}", "HandleUpdateUserFull", handlers.HandleUpdateUserFull, ownerOnly)
+	protected.Handle("DELETE", "/users/{id}", "HandleDeleteUser", handlers.HandleDeleteUser, ownerOnly)
+
+	// Admin endpoints (protected, role admin)
+	adminOnly := handlers.RequirePolicy(authz.Policy{Roles: []string{"admin"}})
+	protected.Handle("GET", "/admin/routes", "RouteTable", routes.HandleListRoutes, adminOnly)
+	protected.Handle("GET", "/admin/config", "HandleConfigStatus", handlers.HandleConfigStatus, adminOnly)
+	protected.Handle("POST", "/admin/config/reload", "HandleConfigReload", handlers.HandleConfigReload, adminOnly)
+	protected.Handle("POST", "/admin/revocations", "HandleRevoke", handlers.HandleRevoke, adminOnly)
+	protected.Handle("GET", "/admin/apikeys", "HandleAPIKeyUsage", handlers.HandleAPIKeyUsage, adminOnly)
+	protected.Handle("GET", "/admin/upstreams", "HandleUpstreamStats", handlers.HandleUpstreamStats, adminOnly)
+	protected.Handle("GET", "/admin/compensations", "HandleListCompensations", handlers.HandleListCompensations, adminOnly)
 
 	// Health endpoints (public)
-	r.HandleFunc("/health", handlers.Health).Methods("GET")
-	r.HandleFunc("/ready", handlers.Health).Methods("GET")
-	r.HandleFunc("/live", handlers.Health).Methods("GET")
+	public.Handle("GET", "/health", "Health", handlers.Health)
+	public.Handle("GET", "/ready", "Health", handlers.Health)
+	public.Handle("GET", "/live", "Health", handlers.Health)
+
+	// Rutas inalcanzables (method+path ya capturado antes) impiden arrancar
+	routeErr := routes.Check(r)
+	if *printRoutes {
+		routes.Print(os.Stdout)
+		if routeErr != nil {
+			os.Exit(1)
+		}
+		return
+	}
+	if routeErr != nil {
+		log.Fatalf("route table has unreachable routes:\n%v", routeErr)
+	}
+
+	// Recarga en SIGHUP o cuando cambia CONFIG_FILE
+	go store.Watch(context.Background(), 5*time.Second)
 
 	addr := fmt.Sprintf(":%s", cfg.Port)
 	log.Printf("Gateway escuchando en %s", addr)
@@ -55,7 +182,48 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// HTTPS (y mTLS opcional) si hay certificado; los archivos se releen al cambiar
+	if cfg.TLS.CertFile != "" {
+		tlsConfig, files, err := serverTLSConfig(cfg.TLS)
+		if err != nil {
+			log.Fatalf("invalid tls configuration: %v", err)
+		}
+		srv.TLSConfig = tlsConfig
+		go certs.Watch(context.Background(), 5*time.Second, files...)
+		log.Printf("TLS habilitado (client auth: %s)", cfg.TLS.ClientAuth)
+		err = srv.ListenAndServeTLS("", "")
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatalf("failed to start server: %v", err)
+		}
+		return
+	}
+
 	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("failed to start server: %v", err)
 	}
 }
+
+// serverTLSConfig carga certificado, clave y CAs de cliente de cfg.
+// Devuelve también los archivos a vigilar para recargarlos en caliente.
+func serverTLSConfig(cfg config.TLSConfig) (*tls.Config, []certs.Reloadable, error) {
+	kp, err := certs.LoadKeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := []certs.Reloadable{kp}
+
+	var clientCAs *certs.CAPool
+	if cfg.ClientCAFile != "" {
+		clientCAs, err = certs.LoadCAPool(cfg.ClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, clientCAs)
+	}
+
+	clientAuth, err := certs.ParseClientAuth(cfg.ClientAuth)
+	if err != nil {
+		return nil, nil, err
+	}
+	return certs.ServerConfig(kp, clientCAs, clientAuth), files, nil
+}
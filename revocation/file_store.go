@@ -0,0 +1,75 @@
+package revocation
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileStore es un MemoryStore que persiste cada cambio en un archivo JSON,
+// para que las revocaciones sobrevivan a un reinicio del gateway.
+type FileStore struct {
+	*MemoryStore
+	path string
+	mu   sync.Mutex
+}
+
+// OpenFileStore carga path si existe (si no, empieza vacío)
+func OpenFileStore(path string, subjectTTL time.Duration) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(subjectTTL), path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
+	s.restore(snap)
+	return s, nil
+}
+
+func (s *FileStore) RevokeToken(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.MemoryStore.RevokeToken(jti, expiresAt)
+	return s.save()
+}
+
+func (s *FileStore) RevokeSubject(subject string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.MemoryStore.RevokeSubject(subject, before)
+	return s.save()
+}
+
+// save escribe a un temporal y renombra, para no dejar el archivo a medias
+func (s *FileStore) save() error {
+	data, err := json.MarshalIndent(s.Snapshot(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".revocations-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,138 @@
+package revocation
+
+import (
+	"sync"
+	"time"
+)
+
+// Store guarda tokens revocados por jti y subjects con una fecha
+// "revocado antes de": cualquier token de ese subject emitido hasta esa
+// fecha deja de ser válido.
+type Store interface {
+	// RevokeToken revoca el token jti; basta con recordarlo hasta su exp
+	RevokeToken(jti string, expiresAt time.Time) error
+	// RevokeSubject revoca los tokens de subject emitidos hasta before
+	RevokeSubject(subject string, before time.Time) error
+	// IsRevoked indica si un token (jti, subject, iat) fue revocado.
+	// iat cero (token sin iat) con el subject revocado cuenta como revocado.
+	IsRevoked(jti, subject string, issuedAt time.Time) (bool, error)
+}
+
+// Snapshot es el contenido completo de un Store (también el formato del archivo)
+type Snapshot struct {
+	Tokens   map[string]time.Time         `json:"tokens"`
+	Subjects map[string]SubjectRevocation `json:"subjects"`
+}
+
+// SubjectRevocation: tokens emitidos hasta Before están revocados;
+// la entrada se olvida en Until (cuando ya no puede quedar ningún token vivo)
+type SubjectRevocation struct {
+	Before time.Time `json:"before"`
+	Until  time.Time `json:"until"`
+}
+
+// MemoryStore es un Store en memoria con expiración de entradas.
+// subjectTTL debe ser al menos la vida máxima de un token.
+type MemoryStore struct {
+	subjectTTL time.Duration
+	now        func() time.Time
+
+	mu       sync.RWMutex
+	tokens   map[string]time.Time
+	subjects map[string]SubjectRevocation
+}
+
+func NewMemoryStore(subjectTTL time.Duration) *MemoryStore {
+	return &MemoryStore{
+		subjectTTL: subjectTTL,
+		now:        time.Now,
+		tokens:     map[string]time.Time{},
+		subjects:   map[string]SubjectRevocation{},
+	}
+}
+
+func (s *MemoryStore) RevokeToken(jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	if expiresAt.IsZero() {
+		expiresAt = s.now().Add(s.subjectTTL)
+	}
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryStore) RevokeSubject(subject string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.purge()
+	if prev, ok := s.subjects[subject]; ok && prev.Before.After(before) {
+		before = prev.Before
+	}
+	s.subjects[subject] = SubjectRevocation{Before: before, Until: before.Add(s.subjectTTL)}
+	return nil
+}
+
+func (s *MemoryStore) IsRevoked(jti, subject string, issuedAt time.Time) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := s.now()
+
+	if jti != "" {
+		if until, ok := s.tokens[jti]; ok && now.Before(until) {
+			return true, nil
+		}
+	}
+	if subject != "" {
+		if rev, ok := s.subjects[subject]; ok && now.Before(rev.Until) {
+			// iat tiene resolución de segundos: un token emitido en el mismo
+			// segundo que la revocación también se considera revocado
+			if issuedAt.IsZero() || issuedAt.Unix() <= rev.Before.Unix() {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// Snapshot devuelve una copia de las entradas vigentes
+func (s *MemoryStore) Snapshot() Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := Snapshot{Tokens: map[string]time.Time{}, Subjects: map[string]SubjectRevocation{}}
+	for k, v := range s.tokens {
+		out.Tokens[k] = v
+	}
+	for k, v := range s.subjects {
+		out.Subjects[k] = v
+	}
+	return out
+}
+
+// restore carga un Snapshot descartando lo ya vencido
+func (s *MemoryStore) restore(snap Snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, v := range snap.Tokens {
+		s.tokens[k] = v
+	}
+	for k, v := range snap.Subjects {
+		s.subjects[k] = v
+	}
+	s.purge()
+}
+
+// purge borra entradas vencidas; se llama con mu tomado
+func (s *MemoryStore) purge() {
+	now := s.now()
+	for k, until := range s.tokens {
+		if !now.Before(until) {
+			delete(s.tokens, k)
+		}
+	}
+	for k, rev := range s.subjects {
+		if !now.Before(rev.Until) {
+			delete(s.subjects, k)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package revocation
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_TokenExpires(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewMemoryStore(time.Hour)
+	s.now = func() time.Time { return now }
+
+	s.RevokeToken("jti-1", now.Add(time.Minute))
+
+	if revoked, _ := s.IsRevoked("jti-1", "", time.Time{}); !revoked {
+		t.Error("Expected jti to be revoked")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if revoked, _ := s.IsRevoked("jti-1", "", time.Time{}); revoked {
+		t.Error("Expected jti revocation to expire with the token")
+	}
+}
+
+func TestMemoryStore_SubjectRevokedBefore(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := NewMemoryStore(time.Hour)
+	s.now = func() time.Time { return now }
+
+	s.RevokeSubject("42", now)
+
+	if revoked, _ := s.IsRevoked("", "42", now.Add(-time.Minute)); !revoked {
+		t.Error("Expected token issued before revocation to be revoked")
+	}
+	if revoked, _ := s.IsRevoked("", "42", now.Add(time.Second)); revoked {
+		t.Error("Expected token issued after revocation to be valid")
+	}
+	if revoked, _ := s.IsRevoked("", "7", now.Add(-time.Minute)); revoked {
+		t.Error("Expected other subjects to be unaffected")
+	}
+
+	now = now.Add(2 * time.Hour)
+	if revoked, _ := s.IsRevoked("", "42", now.Add(-3*time.Hour)); revoked {
+		t.Error("Expected subject revocation to be forgotten after the TTL")
+	}
+}
+
+func TestFileStore_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.json")
+
+	s, err := OpenFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	before := time.Now()
+	s.RevokeSubject("42", before)
+	s.RevokeToken("jti-1", before.Add(time.Hour))
+
+	reopened, err := OpenFileStore(path, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if revoked, _ := reopened.IsRevoked("", "42", before.Add(-time.Minute)); !revoked {
+		t.Error("Expected subject revocation to be persisted")
+	}
+	if revoked, _ := reopened.IsRevoked("jti-1", "", time.Time{}); !revoked {
+		t.Error("Expected jti revocation to be persisted")
+	}
+}